@@ -0,0 +1,232 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// assertion is a parsed -assert expression: two operands compared with
+// ==, !=, <, <=, > or >=. An operand is `result` followed by a -select
+// style path, len() of one, or a literal: a number, a quoted string,
+// true, false, null, or a bare word, which is a string.
+type assertion struct {
+	source      string
+	left, right assertOperand
+	op          string
+}
+
+type assertOperand struct {
+	source  string
+	path    string // for result operands, without the leading dot
+	isPath  bool
+	length  bool // len() of the path
+	literal any
+}
+
+// assertOperators are tried in order, so the two-character ones are found
+// before their prefixes.
+var assertOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func parseAssertion(s string) (*assertion, error) {
+	i, op := findOperator(s)
+	if i < 0 {
+		return nil, fmt.Errorf("invalid assertion %q: want <operand> <op> <operand> with one of %s", s, strings.Join(assertOperators, " "))
+	}
+	left, err := parseAssertOperand(strings.TrimSpace(s[:i]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid assertion %q: %w", s, err)
+	}
+	right, err := parseAssertOperand(strings.TrimSpace(s[i+len(op):]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid assertion %q: %w", s, err)
+	}
+	return &assertion{source: s, left: left, right: right, op: op}, nil
+}
+
+// findOperator returns the position of the first operator outside quotes.
+func findOperator(s string) (int, string) {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' && quote == '"' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		default:
+			for _, op := range assertOperators {
+				if strings.HasPrefix(s[i:], op) {
+					return i, op
+				}
+			}
+		}
+	}
+	return -1, ""
+}
+
+func parseAssertOperand(s string) (assertOperand, error) {
+	operand := assertOperand{source: s}
+	if inner, ok := strings.CutPrefix(s, "len("); ok {
+		inner, ok = strings.CutSuffix(inner, ")")
+		if !ok {
+			return operand, fmt.Errorf("missing ) in %q", s)
+		}
+		path, err := parseAssertOperand(strings.TrimSpace(inner))
+		if err != nil {
+			return operand, err
+		}
+		if !path.isPath {
+			return operand, fmt.Errorf("len() takes a result path, got %q", inner)
+		}
+		path.source = s
+		path.length = true
+		return path, nil
+	}
+
+	switch {
+	case s == "":
+		return operand, fmt.Errorf("missing operand")
+	case s == "result" || strings.HasPrefix(s, "result.") || strings.HasPrefix(s, "result["):
+		operand.isPath = true
+		operand.path = strings.TrimPrefix(strings.TrimPrefix(s, "result"), ".")
+		// Check the syntax of the path now rather than on every result.
+		if _, err := selectPath(nil, operand.path); err != nil && strings.HasPrefix(err.Error(), "invalid path") {
+			return operand, err
+		}
+	case s[0] == '"':
+		value, err := strconv.Unquote(s)
+		if err != nil {
+			return operand, fmt.Errorf("invalid string %s", s)
+		}
+		operand.literal = value
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return operand, fmt.Errorf("invalid string %s", s)
+		}
+		operand.literal = s[1 : len(s)-1]
+	case s == "true" || s == "false":
+		operand.literal = s == "true"
+	case s == "null":
+		operand.literal = nil
+	default:
+		if number, err := strconv.ParseFloat(s, 64); err == nil {
+			operand.literal = number
+		} else {
+			operand.literal = s
+		}
+	}
+	return operand, nil
+}
+
+// value returns the value of o for result. Numbers are float64, as JSON
+// numbers are decoded.
+func (o assertOperand) value(result any) (any, error) {
+	if !o.isPath {
+		return o.literal, nil
+	}
+	value, err := selectPath(result, o.path)
+	if err != nil || !o.length {
+		return value, err
+	}
+	switch v := value.(type) {
+	case nil:
+		return float64(0), nil
+	case []any:
+		return float64(len(v)), nil
+	case map[string]any:
+		return float64(len(v)), nil
+	case string:
+		return float64(len(v)), nil
+	}
+	return nil, fmt.Errorf("%s: cannot take the length of %s", o.source, assertValueText(value))
+}
+
+// check evaluates the assertion against result. It returns nil when it
+// holds, and otherwise an error saying what the result paths had.
+func (a *assertion) check(result any) error {
+	left, err := a.left.value(result)
+	if err != nil {
+		return err
+	}
+	right, err := a.right.value(result)
+	if err != nil {
+		return err
+	}
+	holds, err := compareAssertValues(left, a.op, right)
+	if err != nil {
+		return err
+	}
+	if holds {
+		return nil
+	}
+
+	var got []string
+	for _, side := range []struct {
+		operand assertOperand
+		value   any
+	}{{a.left, left}, {a.right, right}} {
+		if side.operand.isPath {
+			got = append(got, fmt.Sprintf("%s is %s", side.operand.source, assertValueText(side.value)))
+		}
+	}
+	if len(got) == 0 {
+		return fmt.Errorf("%s is false", a.source)
+	}
+	return fmt.Errorf("%s", strings.Join(got, ", "))
+}
+
+// compareAssertValues compares JSON values: any two with == and !=, and
+// two numbers or two strings with the ordering operators.
+func compareAssertValues(left any, op string, right any) (bool, error) {
+	switch op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	}
+
+	var c int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %s %s %s", assertValueText(left), op, assertValueText(right))
+		}
+		c = cmp.Compare(l, r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %s %s %s", assertValueText(left), op, assertValueText(right))
+		}
+		c = strings.Compare(l, r)
+	default:
+		return false, fmt.Errorf("cannot compare %s %s %s", assertValueText(left), op, assertValueText(right))
+	}
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default: // >=
+		return c >= 0, nil
+	}
+}
+
+// assertValueText renders v as compact JSON, shortened if long.
+func assertValueText(v any) string {
+	data, _ := json.Marshal(v)
+	text := string(data)
+	if len(text) > 80 {
+		text = text[:77] + "..."
+	}
+	return text
+}
@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestAssertion(t *testing.T) {
+	result := `{"contents": {"kind": "markdown", "value": "func main()"}, "items": [1, 2, 3], "name": "a < b"}`
+	testCases := []struct {
+		expr     string
+		expected string // the failure, "" when the assertion holds
+	}{
+		{`len(result.items) > 0`, ""},
+		{`len(result.items) == 3`, ""},
+		{`len(result.items) < 3`, "len(result.items) is 3"},
+		{`result.contents.kind == markdown`, ""},
+		{`result.contents.kind == "markdown"`, ""},
+		{`result.contents.kind != 'plaintext'`, ""},
+		{`result.contents.kind == plaintext`, `result.contents.kind is "markdown"`},
+		{`result.items[1] >= 2`, ""},
+		{`result.name == "a < b"`, ""},
+		{`result.missing == null`, `result path "missing" does not exist`},
+		{`result.contents.kind > 1`, `cannot compare "markdown" > 1`},
+		{`len(result.items[0]) > 0`, "len(result.items[0]): cannot take the length of 1"},
+		{`len(result.items) >= len(result.contents)`, ""},
+		{`len(result.items) < len(result.contents)`, "len(result.items) is 3, len(result.contents) is 2"},
+		{`1 > 2`, "1 > 2 is false"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			a, err := parseAssertion(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = a.check(decodeResult(t, result))
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestAssertion_NullResult(t *testing.T) {
+	a, err := parseAssertion("len(result) > 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.check(nil); err == nil || err.Error() != "len(result) is 0" {
+		t.Errorf("Expected a null result to have length 0, got %v", err)
+	}
+}
+
+func TestParseAssertion_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"len(result)",
+		"len(result) >",
+		"== 1",
+		"len(result > 0",
+		"len(3) > 0",
+		`result.kind == "markdown`,
+		"result[x] == 1",
+	} {
+		if _, err := parseAssertion(expr); err == nil {
+			t.Errorf("Expected an error for %q", expr)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// BatchRequest is one entry of a batch given as -params.
+type BatchRequest struct {
+	Method string `json:"method"`
+	Params any    `json:"params,omitempty"`
+}
+
+// parseBatch reports whether params is a batch: a JSON array whose entries
+// are all objects with a method.
+func parseBatch(params any) ([]BatchRequest, bool) {
+	entries, ok := params.([]any)
+	if !ok || len(entries) == 0 {
+		return nil, false
+	}
+
+	batch := make([]BatchRequest, 0, len(entries))
+	for _, entry := range entries {
+		object, ok := entry.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		method, ok := object["method"].(string)
+		if !ok || method == "" {
+			return nil, false
+		}
+		batch = append(batch, BatchRequest{Method: method, Params: object["params"]})
+	}
+	return batch, true
+}
+
+// SendBatch sends requests as a single JSON-RPC batch in one frame and waits
+// until every request has been answered. Responses are returned in the same
+// order as requests regardless of the order the server replies in.
+func (c *LSPClient) SendBatch(ctx context.Context, requests []BatchRequest) ([]*JSONRPCResponse, error) {
+	c.callMu.Lock()
+	defer c.callMu.Unlock()
+
+	batch := make([]JSONRPCRequest, len(requests))
+	positions := make(map[int]int, len(requests))
+	for i, r := range requests {
+		id := c.nextID()
+		batch[i] = JSONRPCRequest{
+			JSONRPC: c.jsonrpcField(),
+			ID:      &id,
+			Method:  r.Method,
+			Params:  r.Params,
+		}
+		positions[id] = i
+		c.logger.Debug("Sending LSP request in batch", "method", r.Method, "id", id)
+	}
+
+	batchBytes, err := json.Marshal(batch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal batch: %w", err)
+	}
+
+	if err := c.writeFrame(batchBytes); err != nil {
+		return nil, fmt.Errorf("failed to write batch: %w", err)
+	}
+	if c.dryRun {
+		return nil, nil
+	}
+	start := time.Now()
+
+	responses := make([]*JSONRPCResponse, len(requests))
+	remaining := len(requests)
+	for remaining > 0 {
+		content, err := c.readMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				for id, i := range positions {
+					if responses[i] == nil {
+						c.cancelRequest(id)
+					}
+				}
+				return nil, err
+			}
+			return nil, c.explainExit(err)
+		}
+
+		// Batch replies arrive as one array, but servers may also answer
+		// each request in its own message.
+		messages := []json.RawMessage{content}
+		if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '[' {
+			if err := json.Unmarshal(trimmed, &messages); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal batch response: %w", err)
+			}
+		}
+
+		for _, message := range messages {
+			response, err := c.dispatch(message)
+			if err != nil {
+				return nil, c.explainExit(err)
+			}
+			if response == nil {
+				continue
+			}
+
+			id, ok := response.ID.Int()
+			i, known := positions[id]
+			if !ok || !known || responses[i] != nil {
+				c.logger.Debug("Received unexpected response ID in batch, continuing to read", "received", response.ID)
+				continue
+			}
+			response.Duration = time.Since(start)
+			responses[i] = response
+			remaining--
+		}
+	}
+
+	return responses, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseBatch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		params   string
+		expected int
+	}{
+		{"batch", `[{"method":"textDocument/hover","params":{}},{"method":"textDocument/definition"}]`, 2},
+		{"object", `{"query":"main"}`, 0},
+		{"empty array", `[]`, 0},
+		{"array without methods", `[1,2]`, 0},
+		{"mixed entries", `[{"method":"a"},{"params":{}}]`, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var params any
+			if err := json.Unmarshal([]byte(tc.params), &params); err != nil {
+				t.Fatal(err)
+			}
+			batch, ok := parseBatch(params)
+			if ok != (tc.expected > 0) || len(batch) != tc.expected {
+				t.Errorf("Expected %d batch entries, got %d (ok=%v)", tc.expected, len(batch), ok)
+			}
+		})
+	}
+}
+
+func TestSendBatch_PreservesOrder(t *testing.T) {
+	client, serverConn := newPipeClient(t)
+
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		content, err := readTestFrame(reader)
+		if err != nil {
+			return
+		}
+		var batch []JSONRPCRequest
+		if err := json.Unmarshal(content, &batch); err != nil {
+			return
+		}
+
+		// Interleave a notification and answer in reverse order, the last
+		// request separately from the batch reply.
+		writeTestFrame(serverConn, map[string]any{"jsonrpc": "2.0", "method": "window/logMessage", "params": map[string]any{}})
+		var replies []JSONRPCResponse
+		for i := len(batch) - 2; i >= 0; i-- {
+			replies = append(replies, JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(*batch[i].ID), Result: batch[i].Method})
+		}
+		writeTestFrame(serverConn, replies)
+		last := batch[len(batch)-1]
+		writeTestFrame(serverConn, JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(*last.ID), Result: last.Method})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	requests := []BatchRequest{
+		{Method: "textDocument/hover"},
+		{Method: "textDocument/definition"},
+		{Method: "textDocument/references"},
+	}
+	responses, err := client.SendBatch(ctx, requests)
+	if err != nil {
+		t.Fatalf("SendBatch failed: %v", err)
+	}
+
+	for i, r := range requests {
+		if responses[i].Result != r.Method {
+			t.Errorf("Response %d: expected result %s, got %v", i, r.Method, responses[i].Result)
+		}
+	}
+}
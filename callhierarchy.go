@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// errNoCallHierarchyItem is returned when prepareCallHierarchy finds
+// nothing to follow up on at the position.
+var errNoCallHierarchyItem = errors.New("no call hierarchy item at this position (textDocument/prepareCallHierarchy returned no items)")
+
+type CallHierarchyItem struct {
+	Name           string  `json:"name"`
+	Kind           float64 `json:"kind"`
+	Detail         string  `json:"detail,omitempty"`
+	URI            string  `json:"uri"`
+	Range          Range   `json:"range"`
+	SelectionRange Range   `json:"selectionRange"`
+}
+
+// callHierarchyCall is a CallHierarchyIncomingCall (with From) or a
+// CallHierarchyOutgoingCall (with To).
+type callHierarchyCall struct {
+	From       *CallHierarchyItem `json:"from,omitempty"`
+	To         *CallHierarchyItem `json:"to,omitempty"`
+	FromRanges []Range            `json:"fromRanges"`
+}
+
+// isCallHierarchy reports whether method is one of the call hierarchy
+// requests.
+func isCallHierarchy(method string) bool {
+	return method == "textDocument/prepareCallHierarchy" || strings.HasPrefix(method, "callHierarchy/")
+}
+
+// callHierarchy runs textDocument/prepareCallHierarchy and, for the first
+// item it returns, callHierarchy/incomingCalls or outgoingCalls as
+// direction says. Like rename, it returns the method and response to
+// print: the calls, or prepareCallHierarchy when it failed with an error
+// response. No items is errNoCallHierarchyItem.
+func callHierarchy(send func(method string, params any) (*JSONRPCResponse, error), params any, direction string) (string, *JSONRPCResponse, error) {
+	const prepare = "textDocument/prepareCallHierarchy"
+	response, err := send(prepare, params)
+	switch {
+	case err != nil:
+		return prepare, nil, err
+	case response == nil:
+		// Dry run: there is no item to ask about.
+		return prepare, nil, nil
+	case response.Error != nil:
+		return prepare, response, nil
+	}
+	items, _ := response.Result.([]any)
+	if len(items) == 0 {
+		return prepare, response, errNoCallHierarchyItem
+	}
+	method := "callHierarchy/" + direction + "Calls"
+	response, err = send(method, map[string]any{"item": items[0]})
+	return method, response, err
+}
+
+// callHierarchyCalls extracts a CallHierarchyIncomingCall[] or
+// CallHierarchyOutgoingCall[] result as the item each call links to: the
+// caller or the callee. ok is false for other shapes.
+func callHierarchyCalls(result any) ([]CallHierarchyItem, bool) {
+	raw, ok := result.([]any)
+	if !ok {
+		return nil, false
+	}
+	data, _ := json.Marshal(raw)
+	var calls []callHierarchyCall
+	if err := json.Unmarshal(data, &calls); err != nil {
+		return nil, false
+	}
+	items := make([]CallHierarchyItem, 0, len(calls))
+	for _, call := range calls {
+		switch {
+		case call.From != nil:
+			items = append(items, *call.From)
+		case call.To != nil:
+			items = append(items, *call.To)
+		default:
+			return nil, false
+		}
+	}
+	return items, true
+}
+
+// formatCallHierarchyItems renders one aligned `name  kind  path:line:col
+// detail` line per item, pointing at its name. Paths are relative to root
+// when inside it and positions are 1-based.
+func formatCallHierarchyItems(items []CallHierarchyItem, root string) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, item := range items {
+		start := item.SelectionRange.Start
+		fmt.Fprintf(w, "%s\t%s\t%s:%d:%d\t%s\n", item.Name, symbolKindName(item.Kind), displayPath(item.URI, root), start.Line+1, start.Character+1, item.Detail)
+	}
+	w.Flush()
+
+	return trimCellPadding(b.String())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCallHierarchy(t *testing.T) {
+	params := textDocumentParams("/a.go", 1, 2)
+	item := map[string]any{"name": "f", "kind": float64(12), "uri": "file:///a.go"}
+
+	tests := []struct {
+		name           string
+		direction      string
+		prepareResult  *JSONRPCResponse
+		expectedMethod string
+		expectedErr    error
+		expectedSent   []string
+	}{
+		{
+			name:           "incoming",
+			direction:      "incoming",
+			prepareResult:  &JSONRPCResponse{Result: []any{item, map[string]any{"name": "g"}}},
+			expectedMethod: "callHierarchy/incomingCalls",
+			expectedSent:   []string{"textDocument/prepareCallHierarchy", "callHierarchy/incomingCalls"},
+		},
+		{
+			name:           "outgoing",
+			direction:      "outgoing",
+			prepareResult:  &JSONRPCResponse{Result: []any{item}},
+			expectedMethod: "callHierarchy/outgoingCalls",
+			expectedSent:   []string{"textDocument/prepareCallHierarchy", "callHierarchy/outgoingCalls"},
+		},
+		{
+			name:           "no items",
+			direction:      "incoming",
+			prepareResult:  &JSONRPCResponse{Result: []any{}},
+			expectedMethod: "textDocument/prepareCallHierarchy",
+			expectedErr:    errNoCallHierarchyItem,
+			expectedSent:   []string{"textDocument/prepareCallHierarchy"},
+		},
+		{
+			name:           "null",
+			direction:      "incoming",
+			prepareResult:  &JSONRPCResponse{},
+			expectedMethod: "textDocument/prepareCallHierarchy",
+			expectedErr:    errNoCallHierarchyItem,
+			expectedSent:   []string{"textDocument/prepareCallHierarchy"},
+		},
+		{
+			name:           "prepare error",
+			direction:      "incoming",
+			prepareResult:  &JSONRPCResponse{Error: &JSONRPCError{Code: -32601, Message: "not supported"}},
+			expectedMethod: "textDocument/prepareCallHierarchy",
+			expectedSent:   []string{"textDocument/prepareCallHierarchy"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []string
+			send := func(method string, p any) (*JSONRPCResponse, error) {
+				sent = append(sent, method)
+				if method == "textDocument/prepareCallHierarchy" {
+					return tt.prepareResult, nil
+				}
+				// The first item is the one asked about.
+				if got := p.(map[string]any)["item"].(map[string]any)["name"]; got != "f" {
+					t.Errorf("Expected item f, got %v", got)
+				}
+				return &JSONRPCResponse{Result: []any{}}, nil
+			}
+
+			method, _, err := callHierarchy(send, params, tt.direction)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if method != tt.expectedMethod {
+				t.Errorf("Expected method %s, got %s", tt.expectedMethod, method)
+			}
+			if !slices.Equal(sent, tt.expectedSent) {
+				t.Errorf("Expected requests %v, got %v", tt.expectedSent, sent)
+			}
+		})
+	}
+}
+
+func TestFormatCallHierarchyCalls(t *testing.T) {
+	root := filepath.FromSlash("/src")
+	incoming := decodeResult(t, `[
+		{"from":{"name":"main","kind":12,"uri":"file:///src/cmd/main.go","range":{"start":{"line":4,"character":0},"end":{"line":9,"character":1}},"selectionRange":{"start":{"line":4,"character":5},"end":{"line":4,"character":9}}},"fromRanges":[]},
+		{"from":{"name":"Serve","kind":6,"detail":"server.Server","uri":"file:///lib/server.go","range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"selectionRange":{"start":{"line":11,"character":17},"end":{"line":11,"character":22}}},"fromRanges":[]}
+	]`)
+	items, ok := callHierarchyCalls(incoming)
+	if !ok {
+		t.Fatal("Expected incoming calls")
+	}
+	expected := "main   Function  " + filepath.FromSlash("cmd/main.go") + ":5:6\n" +
+		"Serve  Method    " + filepath.FromSlash("/lib/server.go") + ":12:18  server.Server\n"
+	if got := formatCallHierarchyItems(items, root); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	outgoing := decodeResult(t, `[{"to":{"name":"helper","kind":12,"uri":"file:///src/a.go","range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"selectionRange":{"start":{"line":0,"character":5},"end":{"line":0,"character":11}}},"fromRanges":[]}]`)
+	if items, ok := callHierarchyCalls(outgoing); !ok || len(items) != 1 || items[0].Name != "helper" {
+		t.Errorf("Expected the callee helper, got %+v, %v", items, ok)
+	}
+
+	for _, result := range []string{`null`, `[{"fromRanges":[]}]`, `{"from":{}}`} {
+		if _, ok := callHierarchyCalls(decodeResult(t, result)); ok {
+			t.Errorf("Expected %s not to be call hierarchy calls", result)
+		}
+	}
+}
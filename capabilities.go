@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// capabilityFeature is one client feature that can be advertised on its
+// own. value builds the capability object set at each of paths, which are
+// dotted paths inside ClientCapabilities.
+type capabilityFeature struct {
+	paths []string
+	value func() map[string]any
+}
+
+func emptyCapability() map[string]any { return map[string]any{} }
+
+// capabilityFeatures are the pieces client capabilities are built from,
+// by the names -caps accepts.
+var capabilityFeatures = map[string]capabilityFeature{
+	"completion": {[]string{"textDocument.completion"}, func() map[string]any {
+		return map[string]any{"completionItem": map[string]any{"snippetSupport": true}}
+	}},
+	"hover": {[]string{"textDocument.hover"}, func() map[string]any {
+		return map[string]any{"contentFormat": []string{"markdown", "plaintext"}}
+	}},
+	"documentSymbol": {[]string{"textDocument.documentSymbol"}, emptyCapability},
+	"workspaceEdit": {[]string{"workspace.workspaceEdit"}, func() map[string]any {
+		return map[string]any{"documentChanges": true, "resourceOperations": []string{"create", "rename", "delete"}}
+	}},
+	"executeCommand":        {[]string{"workspace.executeCommand"}, emptyCapability},
+	"didChangeWatchedFiles": {[]string{"workspace.didChangeWatchedFiles"}, emptyCapability},
+	"workspaceSymbol":       {[]string{"textDocument.workspaceSymbol", "workspace.symbol"}, emptyCapability},
+	"signatureHelp": {[]string{"textDocument.signatureHelp"}, func() map[string]any {
+		return map[string]any{"signatureInformation": map[string]any{
+			"documentationFormat":    []string{"markdown", "plaintext"},
+			"parameterInformation":   map[string]any{"labelOffsetSupport": true},
+			"activeParameterSupport": true,
+		}}
+	}},
+	"declaration": {[]string{"textDocument.declaration"}, emptyCapability},
+	"definition":  {[]string{"textDocument.definition"}, emptyCapability},
+	"typeDefinition": {[]string{"textDocument.typeDefinition"}, func() map[string]any {
+		return map[string]any{"linkSupport": true}
+	}},
+	"implementation": {[]string{"textDocument.implementation"}, func() map[string]any {
+		return map[string]any{"linkSupport": true}
+	}},
+	"references":        {[]string{"textDocument.references"}, emptyCapability},
+	"documentHighlight": {[]string{"textDocument.documentHighlight"}, emptyCapability},
+	"codeAction":        {[]string{"textDocument.codeAction"}, emptyCapability},
+	"formatting":        {[]string{"textDocument.formatting"}, emptyCapability},
+	"rename": {[]string{"textDocument.rename"}, func() map[string]any {
+		return map[string]any{"prepareSupport": true}
+	}},
+	"semanticTokens": {[]string{"textDocument.semanticTokens"}, func() map[string]any {
+		return map[string]any{
+			"requests":       map[string]any{"full": map[string]any{"delta": true}, "range": true},
+			"tokenTypes":     standardTokenTypes,
+			"tokenModifiers": standardTokenModifiers,
+			"formats":        []string{"relative"},
+		}
+	}},
+	"documentLink": {[]string{"textDocument.documentLink"}, func() map[string]any {
+		return map[string]any{"tooltipSupport": true}
+	}},
+	// Without lineFoldingOnly servers may send character offsets too.
+	"foldingRange": {[]string{"textDocument.foldingRange"}, func() map[string]any {
+		return map[string]any{
+			"lineFoldingOnly":  false,
+			"foldingRangeKind": map[string]any{"valueSet": []string{"comment", "imports", "region"}},
+			"foldingRange":     map[string]any{"collapsedText": true},
+		}
+	}},
+	"callHierarchy":      {[]string{"textDocument.callHierarchy"}, emptyCapability},
+	"inlayHint":          {[]string{"textDocument.inlayHint"}, emptyCapability},
+	"publishDiagnostics": {[]string{"textDocument.publishDiagnostics"}, emptyCapability},
+	"diagnostic": {[]string{"textDocument.diagnostic"}, func() map[string]any {
+		return map[string]any{"relatedDocumentSupport": true}
+	}},
+	// The only general capability clsp sets, so it owns the object.
+	"positionEncodings": {[]string{"general"}, func() map[string]any {
+		return map[string]any{"positionEncodings": positionEncodings}
+	}},
+}
+
+// defaultCapabilityFeatures are advertised unless -caps says otherwise.
+var defaultCapabilityFeatures = []string{"completion", "hover", "signatureHelp", "documentSymbol", "workspaceSymbol", "positionEncodings"}
+
+// defaultClientCapabilities returns the capabilities clsp advertises unless
+// they are overridden with -caps or -capabilities-file.
+func defaultClientCapabilities() map[string]any {
+	capabilities, _ := buildClientCapabilities(defaultCapabilityFeatures)
+	return capabilities
+}
+
+// buildClientCapabilities returns capabilities advertising only the named
+// features.
+func buildClientCapabilities(features []string) (map[string]any, error) {
+	capabilities := make(map[string]any)
+	for _, name := range features {
+		feature, ok := capabilityFeatures[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown capability %q (known: %s)", name, strings.Join(slices.Sorted(maps.Keys(capabilityFeatures)), ", "))
+		}
+		for _, path := range feature.paths {
+			setCapability(capabilities, path, feature.value())
+		}
+	}
+	return capabilities, nil
+}
+
+// setCapability sets value at a dotted path, creating objects on the way.
+func setCapability(capabilities map[string]any, path string, value any) {
+	keys := strings.Split(path, ".")
+	current := capabilities
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			current[key] = next
+		}
+		current = next
+	}
+	current[keys[len(keys)-1]] = value
+}
+
+// parseCapsList parses the comma-separated -caps allowlist. "none"
+// advertises no capabilities at all.
+func parseCapsList(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "none" {
+		return nil, nil
+	}
+	var features []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			features = append(features, name)
+		}
+	}
+	if len(features) == 0 {
+		return nil, fmt.Errorf("empty -caps list")
+	}
+	return features, nil
+}
+
+// loadCapabilities reads a JSON object of client capabilities from path and
+// applies it to defaults according to mode ("merge" or "replace").
+func loadCapabilities(path, mode string, defaults map[string]any) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var capabilities map[string]any
+	if err := json.Unmarshal(data, &capabilities); err != nil {
+		return nil, fmt.Errorf("failed to parse capabilities JSON: %w", err)
+	}
+	return applyCapabilities(capabilities, mode, defaults)
+}
+
+// applyCapabilities merges capabilities into defaults or replaces them,
+// according to mode.
+func applyCapabilities(capabilities map[string]any, mode string, defaults map[string]any) (map[string]any, error) {
+	switch mode {
+	case "merge":
+		return mergeCapabilities(defaults, capabilities), nil
+	case "replace":
+		return capabilities, nil
+	default:
+		return nil, fmt.Errorf("unknown capabilities mode %q (want merge or replace)", mode)
+	}
+}
+
+// mergeCapabilities returns base with override applied on top. Objects are
+// merged recursively; any other override value, including arrays, replaces
+// the base value, and a null removes the key. Neither input is modified.
+func mergeCapabilities(base, override map[string]any) map[string]any {
+	merged := maps.Clone(base)
+	if merged == nil {
+		merged = make(map[string]any)
+	}
+	for key, value := range override {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		overrideMap, ok := value.(map[string]any)
+		if baseMap, baseOK := merged[key].(map[string]any); ok && baseOK {
+			merged[key] = mergeCapabilities(baseMap, overrideMap)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
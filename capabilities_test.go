@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergeCapabilities_NestedOverride(t *testing.T) {
+	var override map[string]any
+	err := json.Unmarshal([]byte(`{
+		"textDocument": {
+			"completion": {"completionItem": {"snippetSupport": false}},
+			"documentSymbol": {"hierarchicalDocumentSymbolSupport": true},
+			"hover": null
+		}
+	}`), &override)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := defaultClientCapabilities()
+	merged := mergeCapabilities(defaults, override)
+
+	textDocument := merged["textDocument"].(map[string]any)
+	completionItem := textDocument["completion"].(map[string]any)["completionItem"].(map[string]any)
+	if completionItem["snippetSupport"] != false {
+		t.Errorf("Expected snippetSupport override to take effect, got %v", completionItem["snippetSupport"])
+	}
+	if textDocument["documentSymbol"].(map[string]any)["hierarchicalDocumentSymbolSupport"] != true {
+		t.Error("Expected hierarchicalDocumentSymbolSupport to be added")
+	}
+	if _, ok := textDocument["hover"]; ok {
+		t.Error("Expected null to remove hover")
+	}
+	if _, ok := textDocument["workspaceSymbol"]; !ok {
+		t.Error("Expected untouched defaults to be kept")
+	}
+	if _, ok := merged["workspace"]; !ok {
+		t.Error("Expected untouched top-level defaults to be kept")
+	}
+
+	defaultCompletionItem := defaults["textDocument"].(map[string]any)["completion"].(map[string]any)["completionItem"].(map[string]any)
+	if defaultCompletionItem["snippetSupport"] != true {
+		t.Error("Expected defaults not to be modified")
+	}
+}
+
+func TestLoadCapabilities_Replace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "caps.json")
+	if err := os.WriteFile(path, []byte(`{"general":{"positionEncodings":["utf-8"]}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	capabilities, err := loadCapabilities(path, "replace", defaultClientCapabilities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := capabilities["textDocument"]; ok {
+		t.Error("Expected replace mode to drop the defaults")
+	}
+	if _, ok := capabilities["general"]; !ok {
+		t.Error("Expected replace mode to use the file's capabilities")
+	}
+
+	if _, err := loadCapabilities(path, "append", nil); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestBuildClientCapabilities(t *testing.T) {
+	features, err := parseCapsList("hover, definition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	capabilities, err := buildClientCapabilities(features)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(capabilities)
+	expected := `{"textDocument":{"definition":{},"hover":{"contentFormat":["markdown","plaintext"]}}}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	features, err = parseCapsList("none")
+	if err != nil || len(features) != 0 {
+		t.Fatalf("Expected no features for none, got %v (err=%v)", features, err)
+	}
+	if capabilities, _ := buildClientCapabilities(features); len(capabilities) != 0 {
+		t.Errorf("Expected empty capabilities, got %v", capabilities)
+	}
+
+	if _, err := buildClientCapabilities([]string{"hovr"}); err == nil || !strings.Contains(err.Error(), "hover") {
+		t.Errorf("Expected an unknown capability error listing known names, got %v", err)
+	}
+	if _, err := parseCapsList(" , "); err == nil {
+		t.Error("Expected an error for an empty list")
+	}
+}
+
+func TestDefaultClientCapabilities(t *testing.T) {
+	data, _ := json.Marshal(defaultClientCapabilities())
+	expected := `{"general":{"positionEncodings":["utf-8","utf-32","utf-16"]},"textDocument":{"completion":{"completionItem":{"snippetSupport":true}},"documentSymbol":{},"hover":{"contentFormat":["markdown","plaintext"]},"signatureHelp":{"signatureInformation":{"activeParameterSupport":true,"documentationFormat":["markdown","plaintext"],"parameterInformation":{"labelOffsetSupport":true}}},"workspaceSymbol":{}},"workspace":{"symbol":{}}}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+}
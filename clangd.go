@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// clangdCompileCommandsArg is the clangd flag naming the directory of
+// compile_commands.json. clangd also takes the directory as the
+// compilationDatabasePath initialization option, which -clangd-compile-commands
+// sets too, so it reaches a clangd clsp connects to rather than starts.
+const clangdCompileCommandsArg = "--compile-commands-dir"
+
+// clangdCompileCommandsDir returns dir as an absolute path, since clangd
+// resolves relative ones against its own working directory.
+func clangdCompileCommandsDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return abs, nil
+}
+
+// hasCompilationDatabase reports whether dir holds one of the files clangd
+// reads compile flags from.
+func hasCompilationDatabase(dir string) bool {
+	for _, name := range []string{"compile_commands.json", "compile_flags.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hasClangdCompileCommandsArg reports whether args already name a
+// compilation database directory, which clsp then leaves alone.
+func hasClangdCompileCommandsArg(args []string) bool {
+	for _, arg := range args {
+		if arg == clangdCompileCommandsArg || strings.HasPrefix(arg, clangdCompileCommandsArg+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeInitOptions adds options to the initializationOptions given with
+// -init-options, whose own values win on conflicts.
+func mergeInitOptions(explicit any, options map[string]any) (any, error) {
+	if explicit == nil {
+		return options, nil
+	}
+	object, ok := explicit.(map[string]any)
+	if !ok {
+		return nil, errors.New("initializationOptions must be a JSON object to be combined with -clangd-compile-commands")
+	}
+	return mergeCapabilities(options, object), nil
+}
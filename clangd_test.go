@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClangdCompileCommandsDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.Mkdir("build", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := clangdCompileCommandsDir("build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The temporary directory may be reached through a symlink.
+	expected, _ := filepath.EvalSymlinks(filepath.Join(dir, "build"))
+	if resolved, _ := filepath.EvalSymlinks(got); !filepath.IsAbs(got) || resolved != expected {
+		t.Errorf("Expected the absolute path of build, got %s", got)
+	}
+	if hasCompilationDatabase(got) {
+		t.Error("Expected no compilation database in an empty directory")
+	}
+	if err := os.WriteFile(filepath.Join(got, "compile_commands.json"), []byte("[]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !hasCompilationDatabase(got) {
+		t.Error("Expected compile_commands.json to be found")
+	}
+
+	if err := os.WriteFile("file", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{"missing", "file"} {
+		if _, err := clangdCompileCommandsDir(bad); err == nil {
+			t.Errorf("Expected an error for %s", bad)
+		}
+	}
+}
+
+func TestHasClangdCompileCommandsArg(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected bool
+	}{
+		{nil, false},
+		{[]string{"--log=verbose"}, false},
+		{[]string{"--compile-commands-dir=/src/build"}, true},
+		{[]string{"--compile-commands-dir", "/src/build"}, true},
+		{[]string{"--compile-commands-directory"}, false},
+	}
+	for _, tc := range testCases {
+		if got := hasClangdCompileCommandsArg(tc.args); got != tc.expected {
+			t.Errorf("Expected %v for %q, got %v", tc.expected, tc.args, got)
+		}
+	}
+}
+
+func TestMergeInitOptions(t *testing.T) {
+	options := map[string]any{"compilationDatabasePath": "/src/build"}
+	testCases := []struct {
+		name     string
+		explicit string
+		expected string
+	}{
+		{"none", `null`, `{"compilationDatabasePath":"/src/build"}`},
+		{"added to", `{"fallbackFlags":["-std=c++17"]}`, `{"compilationDatabasePath":"/src/build","fallbackFlags":["-std=c++17"]}`},
+		{"explicit wins", `{"compilationDatabasePath":"/other"}`, `{"compilationDatabasePath":"/other"}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			merged, err := mergeInitOptions(decodeResult(t, tc.explicit), options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := json.Marshal(merged)
+			if string(data) != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, data)
+			}
+		})
+	}
+
+	if _, err := mergeInitOptions([]any{"x"}, options); err == nil {
+		t.Error("Expected an error for initializationOptions that aren't an object")
+	}
+}
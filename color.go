@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ANSI colors for the parts of pretty-printed JSON.
+const (
+	colorReset   = "\x1b[0m"
+	colorKey     = "\x1b[34m" // blue
+	colorString  = "\x1b[32m" // green
+	colorNumber  = "\x1b[36m" // cyan
+	colorLiteral = "\x1b[35m" // magenta: true, false and null
+)
+
+// colorHighlight marks the active parameter of a signature.
+const colorHighlight = "\x1b[1;4m" // bold, underlined
+
+// useColor decides whether pretty output to f is colorized. auto colors
+// only terminals, and respects the NO_COLOR convention.
+func useColor(mode string, f *os.File) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return false, nil
+		}
+		return info.Mode()&os.ModeCharDevice != 0, nil
+	default:
+		return false, fmt.Errorf("invalid color mode %q (want auto, always or never)", mode)
+	}
+}
+
+// colorizeJSON adds ANSI colors to JSON text as produced by
+// json.MarshalIndent: keys, strings, numbers and literals each get their
+// own color. Whitespace and punctuation are left alone.
+func colorizeJSON(data string) string {
+	var b strings.Builder
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '"':
+			end := stringEnd(data, i)
+			color := colorString
+			if isKey(data, end) {
+				color = colorKey
+			}
+			b.WriteString(color + data[i:end] + colorReset)
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(data) && strings.IndexByte("0123456789.eE+-", data[end]) >= 0 {
+				end++
+			}
+			b.WriteString(colorNumber + data[i:end] + colorReset)
+			i = end
+		case c == 't' || c == 'f' || c == 'n':
+			end := i + 1
+			for end < len(data) && data[end] >= 'a' && data[end] <= 'z' {
+				end++
+			}
+			b.WriteString(colorLiteral + data[i:end] + colorReset)
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// stringEnd returns the index just past the JSON string starting at
+// data[start].
+func stringEnd(data string, start int) int {
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+// isKey reports whether the string ending at end is an object key, i.e.
+// is followed by a colon.
+func isKey(data string, end int) bool {
+	rest := strings.TrimLeft(data[end:], " \t\r\n")
+	return strings.HasPrefix(rest, ":")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func TestColorizeJSON(t *testing.T) {
+	data, _ := json.MarshalIndent(map[string]any{
+		"key":    `a "quoted": value`,
+		"n":      -1.5e3,
+		"ok":     true,
+		"none":   nil,
+		"nested": []any{1, "x", false},
+	}, "", "  ")
+
+	colored := colorizeJSON(string(data))
+	if got := ansiPattern.ReplaceAllString(colored, ""); got != string(data) {
+		t.Errorf("Expected colors to be the only change, got:\n%s", got)
+	}
+	for _, expected := range []string{
+		colorKey + `"key"` + colorReset,
+		colorString + `"a \"quoted\": value"` + colorReset,
+		colorNumber + "-1500" + colorReset,
+		colorLiteral + "true" + colorReset,
+		colorLiteral + "null" + colorReset,
+		colorString + `"x"` + colorReset,
+	} {
+		if !strings.Contains(colored, expected) {
+			t.Errorf("Expected %q in %q", expected, colored)
+		}
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		mode     string
+		expected bool
+	}{
+		{"always", true},
+		{"never", false},
+		{"auto", false}, // a regular file is not a terminal
+	}
+	for _, tt := range tests {
+		if got, err := useColor(tt.mode, file); err != nil || got != tt.expected {
+			t.Errorf("useColor(%q) = %v, %v; expected %v", tt.mode, got, err, tt.expected)
+		}
+	}
+	if _, err := useColor("sometimes", file); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
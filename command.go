@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+type ExecuteCommandParams struct {
+	Command   string `json:"command"`
+	Arguments []any  `json:"arguments,omitempty"`
+}
+
+// commandArgument parses a -command-arg value as JSON, so 3, true and
+// {"uri":"file:///a.go"} keep their types. Anything that isn't valid JSON
+// is taken as a plain string.
+func commandArgument(value string) any {
+	var arg any
+	if err := json.Unmarshal([]byte(value), &arg); err != nil {
+		return value
+	}
+	return arg
+}
+
+func executeCommandParams(command string, args []string) ExecuteCommandParams {
+	params := ExecuteCommandParams{Command: command}
+	for _, arg := range args {
+		params.Arguments = append(params.Arguments, commandArgument(arg))
+	}
+	return params
+}
+
+type ApplyWorkspaceEditResult struct {
+	Applied       bool   `json:"applied"`
+	FailureReason string `json:"failureReason,omitempty"`
+}
+
+// applyEditHandler answers the workspace/applyEdit requests servers send
+// while executing a command, which is how most commands change files. The
+// edit is printed like a -wait-for notification and, when apply is set,
+// applied with a summary to summary; otherwise the server is told it
+// wasn't applied.
+func applyEditHandler(opts outputOptions, apply bool, summary io.Writer) ServerRequestHandler {
+	return func(params json.RawMessage) (any, error) {
+		printServerRequest("workspace/applyEdit", params, opts)
+		if !apply {
+			return ApplyWorkspaceEditResult{FailureReason: "clsp was run without -apply"}, nil
+		}
+
+		var decoded any
+		json.Unmarshal(params, &decoded)
+		edit, ok := workspaceEdit(decoded)
+		if !ok {
+			return nil, &JSONRPCError{Code: -32602, Message: "params hold no WorkspaceEdit"}
+		}
+		if err := applyWorkspaceEdit(edit, opts.encoding(), summary); err != nil {
+			return ApplyWorkspaceEditResult{FailureReason: err.Error()}, nil
+		}
+		return ApplyWorkspaceEditResult{Applied: true}, nil
+	}
+}
+
+// printServerRequest prints a request the server sent, in the shape
+// printNotification uses for notifications.
+func printServerRequest(method string, params json.RawMessage, opts outputOptions) {
+	switch opts.format {
+	case "json", "ndjson":
+		writeJSONLine(os.Stdout, Notification{Method: method, Params: params})
+	case "raw":
+		fmt.Println(string(params))
+	default: // pretty
+		if !opts.quiet {
+			fmt.Printf("Server request %s:\n", method)
+		}
+		var decoded any
+		json.Unmarshal(params, &decoded)
+		printJSON(decoded, opts.color)
+	}
+}
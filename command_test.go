@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExecuteCommandParams(t *testing.T) {
+	params := executeCommandParams("gopls.tidy", []string{`{"URIs":["file:///a/go.mod"]}`, "3", "true", "file:///a/go.mod", `"quoted"`})
+	expected := ExecuteCommandParams{
+		Command: "gopls.tidy",
+		Arguments: []any{
+			map[string]any{"URIs": []any{"file:///a/go.mod"}},
+			float64(3),
+			true,
+			"file:///a/go.mod",
+			"quoted",
+		},
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, params)
+	}
+
+	data, _ := json.Marshal(executeCommandParams("gopls.run_govulncheck", nil))
+	if string(data) != `{"command":"gopls.run_govulncheck"}` {
+		t.Errorf("Expected no arguments field, got %s", data)
+	}
+}
+
+func TestApplyEditHandler(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"a.go": "package a\n"})
+	path := filepath.Join(dir, "a.go")
+	params, _ := json.Marshal(map[string]any{
+		"label": "tidy",
+		"edit": map[string]any{"changes": map[string]any{
+			PathToFileURI(path): []any{map[string]any{
+				"range":   map[string]any{"start": map[string]any{"line": 0, "character": 8}, "end": map[string]any{"line": 0, "character": 9}},
+				"newText": "b",
+			}},
+		}},
+	})
+	opts := outputOptions{format: "raw"}
+
+	result, err := applyEditHandler(opts, false, &bytes.Buffer{})(params)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r := result.(ApplyWorkspaceEditResult); r.Applied || r.FailureReason == "" {
+		t.Errorf("Expected the edit to be refused without -apply, got %+v", r)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "package a\n" {
+		t.Errorf("Expected the file to be untouched, got %q", data)
+	}
+
+	var summary bytes.Buffer
+	result, err = applyEditHandler(opts, true, &summary)(params)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r := result.(ApplyWorkspaceEditResult); !r.Applied {
+		t.Errorf("Expected the edit to be applied, got %+v", r)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "package b\n" {
+		t.Errorf("Expected the edited file, got %q", data)
+	}
+	if summary.Len() == 0 {
+		t.Error("Expected a summary of the applied edit")
+	}
+}
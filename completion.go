@@ -0,0 +1,107 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// completionKinds names the LSP CompletionItemKind values, which start at 1.
+var completionKinds = []string{
+	"", "Text", "Method", "Function", "Constructor", "Field", "Variable",
+	"Class", "Interface", "Module", "Property", "Unit", "Value", "Enum",
+	"Keyword", "Snippet", "Color", "File", "Reference", "Folder", "EnumMember",
+	"Constant", "Struct", "Event", "Operator", "TypeParameter",
+}
+
+func completionKindName(kind float64) string {
+	if i := int(kind); i > 0 && i < len(completionKinds) {
+		return completionKinds[i]
+	}
+	if kind == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(kind))
+}
+
+// completionItem is the part of a CompletionItem the completion format
+// prints.
+type completionItem struct {
+	Label    string
+	Kind     string
+	Detail   string
+	SortText string
+}
+
+// completionItems extracts the items of a textDocument/completion result,
+// which is either CompletionItem[] or a CompletionList. Items are sorted
+// by sortText, which defaults to the label. ok is false for other shapes.
+func completionItems(result any) (items []completionItem, incomplete bool, ok bool) {
+	var raw []any
+	switch r := result.(type) {
+	case []any:
+		raw = r
+	case map[string]any:
+		if raw, ok = r["items"].([]any); !ok {
+			return nil, false, false
+		}
+		incomplete, _ = r["isIncomplete"].(bool)
+	default:
+		return nil, false, false
+	}
+
+	items = make([]completionItem, 0, len(raw))
+	for _, entry := range raw {
+		object, ok := entry.(map[string]any)
+		if !ok {
+			return nil, false, false
+		}
+		label, ok := object["label"].(string)
+		if !ok {
+			return nil, false, false
+		}
+		kind, _ := object["kind"].(float64)
+		item := completionItem{Label: label, Kind: completionKindName(kind)}
+		item.Detail, _ = object["detail"].(string)
+		item.SortText, _ = object["sortText"].(string)
+		if item.SortText == "" {
+			item.SortText = label
+		}
+		items = append(items, item)
+	}
+	slices.SortStableFunc(items, func(a, b completionItem) int {
+		return cmp.Compare(a.SortText, b.SortText)
+	})
+	return items, incomplete, true
+}
+
+// formatCompletionItems renders one aligned `label  kind  detail` line per
+// item.
+func formatCompletionItems(items []completionItem) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, item := range items {
+		// Details can span lines (signatures); keep one line per item.
+		detail := strings.Join(strings.Fields(item.Detail), " ")
+		fmt.Fprintf(w, "%s\t%s\t%s\n", item.Label, item.Kind, detail)
+	}
+	w.Flush()
+
+	return trimCellPadding(b.String())
+}
+
+// trimCellPadding removes the spaces tabwriter pads the last cell of a line
+// with when it is empty, as it is for items without a detail.
+func trimCellPadding(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \n")
+		if line != "" {
+			lines[i] += "\n"
+		}
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCompletionItems(t *testing.T) {
+	testCases := []struct {
+		name       string
+		result     string
+		expected   string
+		incomplete bool
+		ok         bool
+	}{
+		{
+			"item array sorted by sortText",
+			`[{"label":"Println","kind":3,"detail":"func(a ...any)","sortText":"0002"},
+			  {"label":"Printf","kind":3,"detail":"func(format string,\n a ...any)","sortText":"0001"},
+			  {"label":"fmt","kind":9}]`,
+			"Printf   Function  func(format string, a ...any)\nPrintln  Function  func(a ...any)\nfmt      Module\n",
+			false,
+			true,
+		},
+		{
+			"completion list",
+			`{"isIncomplete":true,"items":[{"label":"b"},{"label":"a","kind":99}]}`,
+			"a  99\nb\n",
+			true,
+			true,
+		},
+		{"empty list", `{"isIncomplete":false,"items":[]}`, "", false, true},
+		{"hover", `{"contents":{"kind":"markdown","value":"x"}}`, "", false, false},
+		{"locations", `[{"uri":"file:///a.go"}]`, "", false, false},
+		{"null", `null`, "", false, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var result any
+			if err := json.Unmarshal([]byte(tc.result), &result); err != nil {
+				t.Fatal(err)
+			}
+			items, incomplete, ok := completionItems(result)
+			if ok != tc.ok || incomplete != tc.incomplete {
+				t.Fatalf("Expected ok=%v incomplete=%v, got ok=%v incomplete=%v", tc.ok, tc.incomplete, ok, incomplete)
+			}
+			if got := formatCompletionItems(items); got != tc.expected {
+				t.Errorf("Expected:\n%q\ngot:\n%q", tc.expected, got)
+			}
+		})
+	}
+}
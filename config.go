@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// configFileName is the project config looked up from the current
+// directory upwards when -config isn't given.
+const configFileName = ".clsp.json"
+
+// Config holds per-project defaults. Command-line flags override every
+// field.
+type Config struct {
+	Server       string         `json:"server"`
+	Args         []string       `json:"args"`
+	Root         string         `json:"root"`         // relative to the config file
+	Capabilities map[string]any `json:"capabilities"` // applied like -capabilities-file
+	Timeout      string         `json:"timeout"`      // a Go duration such as "60s"
+
+	timeout time.Duration
+}
+
+// findConfig returns the path of the nearest .clsp.json in dir or one of
+// its parents, or "" if there is none.
+func findConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, configFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// loadConfig reads a config file. A relative root is resolved against the
+// directory the file is in, so the config works from any subdirectory.
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+
+	if cfg.Timeout != "" {
+		cfg.timeout, err = time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+	if cfg.Root != "" && !isURI(cfg.Root) && !filepath.IsAbs(cfg.Root) {
+		cfg.Root = filepath.Join(filepath.Dir(path), cfg.Root)
+	}
+	return &cfg, nil
+}
+
+// serverArgs returns the arguments to start the server with: args, from
+// -args and -arg, or the config's args when neither those flags nor
+// -server were given. The config's args belong to its server, so they are
+// dropped when -server names another one.
+func (c *Config) serverArgs(args []string, explicit map[string]bool) []string {
+	if len(c.Args) > 0 && !explicit["server"] && !explicit["args"] && !explicit["arg"] {
+		return c.Args
+	}
+	return args
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindConfig(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if path, err := findConfig(nested); err != nil || strings.HasPrefix(path, root) {
+		t.Fatalf("Expected no config under %s, got %q (err=%v)", root, path, err)
+	}
+
+	configPath := filepath.Join(root, configFileName)
+	if err := os.WriteFile(configPath, []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path, err := findConfig(nested)
+	if err != nil || path != configPath {
+		t.Errorf("Expected %s, got %q (err=%v)", configPath, path, err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, configFileName)
+	content := `{
+		"server": "gopls",
+		"args": ["serve", "-rpc.trace"],
+		"root": "src",
+		"capabilities": {"textDocument": {"hover": {"contentFormat": ["plaintext"]}}},
+		"timeout": "1m"
+	}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if cfg.Server != "gopls" || len(cfg.Args) != 2 || cfg.Args[1] != "-rpc.trace" {
+		t.Errorf("Unexpected server/args: %s %v", cfg.Server, cfg.Args)
+	}
+	if expected := filepath.Join(dir, "src"); cfg.Root != expected {
+		t.Errorf("Expected root %s, got %s", expected, cfg.Root)
+	}
+	if cfg.timeout != time.Minute {
+		t.Errorf("Expected timeout 1m, got %v", cfg.timeout)
+	}
+	if cfg.Capabilities["textDocument"] == nil {
+		t.Errorf("Expected capabilities, got %v", cfg.Capabilities)
+	}
+}
+
+func TestConfigServerArgs(t *testing.T) {
+	cfg := &Config{Server: "gopls", Args: []string{"serve"}}
+	tests := []struct {
+		name     string
+		args     []string
+		explicit map[string]bool
+		expected []string
+	}{
+		{"from the config", nil, map[string]bool{}, []string{"serve"}},
+		{"-args wins", []string{"-rpc.trace"}, map[string]bool{"args": true}, []string{"-rpc.trace"}},
+		{"-arg wins", []string{"x"}, map[string]bool{"arg": true}, []string{"x"}},
+		{"-server drops the config's args", nil, map[string]bool{"server": true}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.serverArgs(tt.args, tt.explicit); !slices.Equal(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	dir := t.TempDir()
+	testCases := map[string]string{
+		"bad json":    `{`,
+		"bad timeout": `{"timeout":"soon"}`,
+	}
+	for name, content := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name+".json")
+			os.WriteFile(path, []byte(content), 0o644)
+			if _, err := loadConfig(path); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
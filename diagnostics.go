@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultDiagnosticsWindow is how long diagnostics are collected when
+// -method textDocument/publishDiagnostics is used without -wait-diagnostics.
+const defaultDiagnosticsWindow = 3 * time.Second
+
+type PublishDiagnosticsParams struct {
+	URI         string `json:"uri"`
+	Version     *int   `json:"version,omitempty"`
+	Diagnostics []any  `json:"diagnostics"`
+}
+
+// diagnosticsCollector records textDocument/publishDiagnostics notifications.
+// Servers often publish in several batches; each publish replaces the
+// previous diagnostics for its URI, as the spec requires, so after the
+// window the collector holds the final state for every URI seen.
+type diagnosticsCollector struct {
+	mu    sync.Mutex
+	byURI map[string][]any
+}
+
+func collectDiagnostics(client *LSPClient) *diagnosticsCollector {
+	d := &diagnosticsCollector{byURI: make(map[string][]any)}
+	client.OnNotification("textDocument/publishDiagnostics", d.handle)
+	return d
+}
+
+func (d *diagnosticsCollector) handle(params json.RawMessage) {
+	var p PublishDiagnosticsParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return
+	}
+	if p.Diagnostics == nil {
+		p.Diagnostics = []any{}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.byURI[p.URI] = p.Diagnostics
+}
+
+// Diagnostics returns the collected diagnostics keyed by document URI.
+func (d *diagnosticsCollector) Diagnostics() map[string][]any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return maps.Clone(d.byURI)
+}
+
+func printDiagnostics(diagnostics map[string][]any, opts outputOptions) {
+	switch opts.format {
+	case "json", "raw":
+		data, _ := json.Marshal(diagnostics)
+		fmt.Println(string(data))
+	case "ndjson":
+		// One line per document keeps the stream greppable.
+		for _, uri := range slices.Sorted(maps.Keys(diagnostics)) {
+			writeJSONLine(os.Stdout, PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics[uri]})
+		}
+	default: // pretty
+		if !opts.quiet {
+			fmt.Println("Diagnostics:")
+		}
+		printJSON(diagnostics, opts.color)
+	}
+}
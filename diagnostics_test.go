@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDiagnosticsCollector_MultipleBatches(t *testing.T) {
+	client, serverConn := newPipeClient(t)
+	diagnostics := collectDiagnostics(client)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w := bufio.NewWriter(serverConn)
+		publish := func(uri string, messages ...string) {
+			items := []any{}
+			for _, m := range messages {
+				items = append(items, map[string]any{"message": m})
+			}
+			writeTestFrame(w, map[string]any{
+				"jsonrpc": "2.0",
+				"method":  "textDocument/publishDiagnostics",
+				"params":  map[string]any{"uri": uri, "diagnostics": items},
+			})
+			w.Flush()
+		}
+		publish("file:///a.go")
+		publish("file:///b.go", "unused variable")
+		publish("file:///a.go", "undefined: foo", "missing return")
+		writeTestFrame(w, map[string]any{"jsonrpc": "2.0", "method": "window/logMessage", "params": map[string]any{"type": 3, "message": "done"}})
+		w.Flush()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := client.Listen(ctx); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	<-done
+
+	got := diagnostics.Diagnostics()
+	if len(got) != 2 {
+		t.Fatalf("Expected diagnostics for 2 URIs, got %d", len(got))
+	}
+	if len(got["file:///a.go"]) != 2 {
+		t.Errorf("Expected the last batch for a.go to win, got %v", got["file:///a.go"])
+	}
+	data, _ := json.Marshal(got["file:///b.go"])
+	if string(data) != `[{"message":"unused variable"}]` {
+		t.Errorf("Unexpected diagnostics for b.go: %s", data)
+	}
+}
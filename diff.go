@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// diffContext is how many unchanged lines surround each hunk.
+const diffContext = 3
+
+type diffKind int
+
+const (
+	diffEqual diffKind = iota
+	diffDelete
+	diffInsert
+)
+
+type diffOp struct {
+	kind diffKind
+	line string
+}
+
+// splitLines splits text into lines that keep their "\n", so a missing
+// newline at the end of the text shows in the diff.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script turning a into b, computed
+// with Myers' algorithm.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, slices.Clone(v))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // down: insert
+			} else {
+				x = v[offset+k-1] + 1 // right: delete
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk back through the rounds, collecting the script in reverse.
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{diffEqual, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{diffInsert, b[y-1]})
+			} else {
+				ops = append(ops, diffOp{diffDelete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	slices.Reverse(ops)
+	return ops
+}
+
+// unifiedDiff returns the changes from a to b in unified diff format, or
+// "" if there are none.
+func unifiedDiff(oldName, newName, a, b string) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	for i := 0; i < len(ops); {
+		if ops[i].kind == diffEqual {
+			i++
+			continue
+		}
+		// A hunk runs from diffContext lines before the first change to
+		// diffContext lines after the last change that is within
+		// 2*diffContext lines of the previous one.
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != diffEqual {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext, len(ops))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		writeHunk(&out, ops, start, end)
+		i = end
+	}
+	return out.String()
+}
+
+// writeHunk writes ops[start:end] as one hunk.
+func writeHunk(out *strings.Builder, ops []diffOp, start, end int) {
+	// Line numbers are 1-based; an empty range is numbered by the line
+	// before it.
+	aLine, bLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != diffInsert {
+			aLine++
+		}
+		if op.kind != diffDelete {
+			bLine++
+		}
+	}
+	aLen, bLen := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != diffInsert {
+			aLen++
+		}
+		if op.kind != diffDelete {
+			bLen++
+		}
+	}
+	if aLen == 0 {
+		aLine--
+	}
+	if bLen == 0 {
+		bLine--
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aLine, aLen), hunkRange(bLine, bLen))
+	for _, op := range ops[start:end] {
+		prefix := map[diffKind]string{diffEqual: " ", diffDelete: "-", diffInsert: "+"}[op.kind]
+		out.WriteString(prefix + op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(line, length int) string {
+	if length == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, length)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{
+			"change",
+			"a\nb\nc\n", "a\nB\nc\n",
+			"--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"from empty",
+			"", "a\n",
+			"--- a/f\n+++ b/f\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			"missing final newline",
+			"a\nb", "a\nb\n",
+			"--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("a/f", "b/f", tt.a, tt.b); got != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff_Hunks(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d\n", i))
+	}
+	a := strings.Join(lines, "")
+	lines[1] = "changed 2\n"
+	lines[17] = "changed 18\n"
+	b := strings.Join(lines, "")
+
+	diff := unifiedDiff("a/f", "b/f", a, b)
+	if n := strings.Count(diff, "@@ -"); n != 2 {
+		t.Fatalf("Expected two hunks for distant changes, got:\n%s", diff)
+	}
+	for _, header := range []string{"@@ -1,5 +1,5 @@", "@@ -15,6 +15,6 @@"} {
+		if !strings.Contains(diff, header) {
+			t.Errorf("Expected %s in:\n%s", header, diff)
+		}
+	}
+
+	// Changes at most 2*diffContext lines apart share a hunk.
+	lines[1+2*diffContext+1] = "changed\n"
+	if diff := unifiedDiff("a/f", "b/f", a, strings.Join(lines, "")); strings.Count(diff, "@@ -") != 2 || !strings.Contains(diff, "@@ -1,12 +1,12 @@") {
+		t.Errorf("Expected nearby changes to be merged, got:\n%s", diff)
+	}
+}
+
+func TestDiffLines_RoundTrip(t *testing.T) {
+	a := splitLines("a\nb\nc\nd\ne\n")
+	b := splitLines("x\nb\nd\ne\ny\nz\n")
+	var gotA, gotB []string
+	for _, op := range diffLines(a, b) {
+		if op.kind != diffInsert {
+			gotA = append(gotA, op.line)
+		}
+		if op.kind != diffDelete {
+			gotB = append(gotB, op.line)
+		}
+	}
+	if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+		t.Errorf("Edit script doesn't reproduce both sides: %q %q", gotA, gotB)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type TextDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type DidOpenTextDocumentParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+type VersionedTextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+}
+
+// TextDocumentContentChangeEvent replaces the whole document when Range is
+// nil and only the given range otherwise.
+type TextDocumentContentChangeEvent struct {
+	Range *Range `json:"range,omitempty"`
+	Text  string `json:"text"`
+}
+
+type DidChangeTextDocumentParams struct {
+	TextDocument   VersionedTextDocumentIdentifier  `json:"textDocument"`
+	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+type DidCloseTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// languageIDs maps file extensions to LSP language identifiers.
+var languageIDs = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".jsx":   "javascriptreact",
+	".ts":    "typescript",
+	".tsx":   "typescriptreact",
+	".rs":    "rust",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".cxx":   "cpp",
+	".hpp":   "cpp",
+	".java":  "java",
+	".kt":    "kotlin",
+	".cs":    "csharp",
+	".rb":    "ruby",
+	".php":   "php",
+	".swift": "swift",
+	".lua":   "lua",
+	".zig":   "zig",
+	".sh":    "shellscript",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".md":    "markdown",
+	".html":  "html",
+	".css":   "css",
+}
+
+// languageIDForPath returns the LSP language identifier for path, falling
+// back to plaintext for unknown extensions.
+func languageIDForPath(path string) string {
+	switch base := filepath.Base(path); base {
+	case "go.mod", "go.sum", "go.work":
+		return base
+	}
+	if id, ok := languageIDs[strings.ToLower(filepath.Ext(path))]; ok {
+		return id
+	}
+	return "plaintext"
+}
+
+// textDocumentItemFromFile reads path and builds the item sent with
+// textDocument/didOpen.
+func textDocumentItemFromFile(path string) (TextDocumentItem, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return TextDocumentItem{}, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	text, err := os.ReadFile(absPath)
+	if err != nil {
+		return TextDocumentItem{}, err
+	}
+	return TextDocumentItem{
+		URI:        PathToFileURI(absPath),
+		LanguageID: languageIDForPath(absPath),
+		Version:    1,
+		Text:       string(text),
+	}, nil
+}
+
+// textDocumentItemFromReader builds a didOpen item whose text is read from
+// r instead of a file, as for an editor buffer that hasn't been saved.
+// target is a URI or a path, which need not exist. An empty languageID is
+// derived from target's extension.
+func textDocumentItemFromReader(r io.Reader, target, languageID string) (TextDocumentItem, error) {
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return TextDocumentItem{}, err
+	}
+	uri := target
+	if !isURI(target) {
+		uri = PathToFileURI(target)
+	}
+	if languageID == "" {
+		languageID = languageIDForPath(target)
+	}
+	return TextDocumentItem{URI: uri, LanguageID: languageID, Version: 1, Text: string(text)}, nil
+}
+
+// parseContentChange parses a TextDocumentContentChangeEvent given as JSON.
+func parseContentChange(s string) (TextDocumentContentChangeEvent, error) {
+	var change TextDocumentContentChangeEvent
+	if err := json.Unmarshal([]byte(s), &change); err != nil {
+		return change, fmt.Errorf("invalid content change %q: %w", s, err)
+	}
+	return change, nil
+}
+
+// DidOpen tells the server that item is open so that following requests see
+// its contents. The document's version is tracked for later DidChange calls.
+func (c *LSPClient) DidOpen(item TextDocumentItem) error {
+	c.mu.Lock()
+	if c.versions == nil {
+		c.versions = make(map[string]int)
+	}
+	c.versions[item.URI] = item.Version
+	if c.texts == nil {
+		c.texts = make(map[string]string)
+	}
+	c.texts[item.URI] = item.Text
+	c.mu.Unlock()
+
+	return c.SendNotification("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: item})
+}
+
+// DidChange sends changes to the open document uri, tagged with a version
+// one higher than the last one sent for it.
+func (c *LSPClient) DidChange(uri string, changes ...TextDocumentContentChangeEvent) error {
+	encoding := c.PositionEncoding()
+	c.mu.Lock()
+	version, ok := c.versions[uri]
+	if ok {
+		version++
+		c.versions[uri] = version
+		c.texts[uri] = applyContentChanges(c.texts[uri], changes, encoding)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("document %s is not open", uri)
+	}
+
+	return c.SendNotification("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: version},
+		ContentChanges: changes,
+	})
+}
+
+// DidClose tells the server that the open document uri is closed and stops
+// tracking its version.
+func (c *LSPClient) DidClose(uri string) error {
+	c.mu.Lock()
+	_, ok := c.versions[uri]
+	delete(c.versions, uri)
+	delete(c.texts, uri)
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("document %s is not open", uri)
+	}
+
+	return c.SendNotification("textDocument/didClose", DidCloseTextDocumentParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+	})
+}
+
+// DocumentText returns the content of an open document as the server
+// sees it, with all changes applied.
+func (c *LSPClient) DocumentText(uri string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	text, ok := c.texts[uri]
+	return text, ok
+}
+
+// applyContentChanges applies content change events to text in order;
+// unlike TextEdits, each one refers to the result of the previous one.
+// Positions are in encoding.
+func applyContentChanges(text string, changes []TextDocumentContentChangeEvent, encoding string) string {
+	for _, change := range changes {
+		if change.Range == nil {
+			text = change.Text
+			continue
+		}
+		start, end := positionOffset(text, change.Range.Start, encoding), positionOffset(text, change.Range.End, encoding)
+		if end < start {
+			continue // the server will reject it too
+		}
+		text = text[:start] + change.Text + text[end:]
+	}
+	return text
+}
+
+// OpenDocuments returns the URIs of the documents opened with DidOpen and
+// not closed since, sorted.
+func (c *LSPClient) OpenDocuments() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Sorted(maps.Keys(c.versions))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLanguageIDForPath(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"main.go", "go"},
+		{"/src/pkg/script.py", "python"},
+		{"component.TSX", "typescriptreact"},
+		{"lib.rs", "rust"},
+		{"include/foo.hpp", "cpp"},
+		{"/repo/go.mod", "go.mod"},
+		{"notes.txt", "plaintext"},
+		{"Makefile", "plaintext"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			if got := languageIDForPath(tc.path); got != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestTextDocumentItemFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := textDocumentItemFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to build text document item: %v", err)
+	}
+
+	if !strings.HasPrefix(item.URI, "file://") || !strings.HasSuffix(item.URI, "/main.go") {
+		t.Errorf("Unexpected URI %s", item.URI)
+	}
+	if item.LanguageID != "go" {
+		t.Errorf("Expected languageId go, got %s", item.LanguageID)
+	}
+	if item.Version != 1 {
+		t.Errorf("Expected version 1, got %d", item.Version)
+	}
+	if item.Text != "package main\n" {
+		t.Errorf("Unexpected text %q", item.Text)
+	}
+}
+
+func TestTextDocumentItemFromReader(t *testing.T) {
+	testCases := []struct {
+		target, languageID string
+		uri, expectedID    string
+	}{
+		{"/virtual/main.go", "", "file:///virtual/main.go", "go"},
+		{"untitled:Untitled-1", "python", "untitled:Untitled-1", "python"},
+		{"file:///virtual/lib.rs", "", "file:///virtual/lib.rs", "rust"},
+	}
+	for _, tc := range testCases {
+		item, err := textDocumentItemFromReader(strings.NewReader("unsaved\n"), tc.target, tc.languageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.URI != tc.uri || item.LanguageID != tc.expectedID || item.Version != 1 || item.Text != "unsaved\n" {
+			t.Errorf("Unexpected item for %s: %+v", tc.target, item)
+		}
+	}
+}
+
+func TestLSPClient_DidChangeVersions(t *testing.T) {
+	client, serverConn := newPipeClient(t)
+
+	versions := make(chan int, 3)
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		for range 3 {
+			content, err := readTestFrame(reader)
+			if err != nil {
+				return
+			}
+			var notification struct {
+				Params struct {
+					TextDocument VersionedTextDocumentIdentifier `json:"textDocument"`
+				} `json:"params"`
+			}
+			json.Unmarshal(content, &notification)
+			versions <- notification.Params.TextDocument.Version
+		}
+	}()
+
+	uri := "file:///test.go"
+	if err := client.DidChange(uri, TextDocumentContentChangeEvent{Text: "x"}); err == nil {
+		t.Error("Expected an error changing a document that isn't open")
+	}
+
+	if err := client.DidOpen(TextDocumentItem{URI: uri, LanguageID: "go", Version: 1, Text: "package main\n"}); err != nil {
+		t.Fatal(err)
+	}
+	full := TextDocumentContentChangeEvent{Text: "package main\n\nfunc main() {}\n"}
+	incremental := TextDocumentContentChangeEvent{
+		Range: &Range{Start: Position{Line: 0, Character: 8}, End: Position{Line: 0, Character: 12}},
+		Text:  "other",
+	}
+	for _, change := range []TextDocumentContentChangeEvent{full, incremental} {
+		if err := client.DidChange(uri, change); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range []int{1, 2, 3} {
+		if got := <-versions; got != expected {
+			t.Errorf("Expected version %d, got %d", expected, got)
+		}
+	}
+}
+
+func TestParseContentChange(t *testing.T) {
+	change, err := parseContentChange(`{"range":{"start":{"line":1,"character":2},"end":{"line":1,"character":4}},"text":"ab"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Range == nil || change.Range.Start.Line != 1 || change.Range.End.Character != 4 || change.Text != "ab" {
+		t.Errorf("Unexpected change %+v", change)
+	}
+
+	change, err = parseContentChange(`{"text":"full"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Range != nil {
+		t.Error("Expected a full-document change to have no range")
+	}
+
+	if _, err := parseContentChange(`not json`); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
+
+func TestLSPClient_DidClose(t *testing.T) {
+	client, serverConn := newPipeClient(t)
+
+	methods := make(chan string, 4)
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		for range 4 {
+			content, err := readTestFrame(reader)
+			if err != nil {
+				return
+			}
+			var notification struct {
+				Method string `json:"method"`
+			}
+			json.Unmarshal(content, &notification)
+			methods <- notification.Method
+		}
+	}()
+
+	if err := client.DidClose("file:///a.go"); err == nil {
+		t.Error("Expected an error closing a document that isn't open")
+	}
+	for _, uri := range []string{"file:///b.go", "file:///a.go"} {
+		if err := client.DidOpen(TextDocumentItem{URI: uri, LanguageID: "go", Version: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := client.OpenDocuments(); !slices.Equal(got, []string{"file:///a.go", "file:///b.go"}) {
+		t.Errorf("Unexpected open documents %v", got)
+	}
+
+	for _, uri := range client.OpenDocuments() {
+		if err := client.DidClose(uri); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := client.OpenDocuments(); len(got) != 0 {
+		t.Errorf("Expected no open documents, got %v", got)
+	}
+	if err := client.DidClose("file:///a.go"); err == nil {
+		t.Error("Expected an error closing a document twice")
+	}
+
+	for _, expected := range []string{"textDocument/didOpen", "textDocument/didOpen", "textDocument/didClose", "textDocument/didClose"} {
+		if got := <-methods; got != expected {
+			t.Errorf("Expected %s, got %s", expected, got)
+		}
+	}
+}
+
+func TestApplyContentChanges(t *testing.T) {
+	changes := []TextDocumentContentChangeEvent{
+		{Range: &Range{Start: Position{Line: 0, Character: 0}, End: Position{Line: 0, Character: 1}}, Text: "x"},
+		// Refers to the text after the first change.
+		{Range: &Range{Start: Position{Line: 0, Character: 1}, End: Position{Line: 0, Character: 1}}, Text: "y"},
+	}
+	if got := applyContentChanges("abc\n", changes, encodingUTF16); got != "xybc\n" {
+		t.Errorf("Unexpected text %q", got)
+	}
+
+	full := append(changes, TextDocumentContentChangeEvent{Text: "new\n"})
+	if got := applyContentChanges("abc\n", full, encodingUTF16); got != "new\n" {
+		t.Errorf("Expected a change without range to replace the text, got %q", got)
+	}
+}
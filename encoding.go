@@ -0,0 +1,42 @@
+package main
+
+// Position encodings, which say what Position.Character counts. LSP 3.17
+// lets the client offer several in general.positionEncodings and the
+// server pick one; servers that don't pick use UTF-16.
+const (
+	encodingUTF8  = "utf-8"  // bytes
+	encodingUTF16 = "utf-16" // UTF-16 code units, the default
+	encodingUTF32 = "utf-32" // Unicode code points
+)
+
+// positionEncodings are the encodings clsp offers, most preferred first.
+// UTF-8 comes first because its characters are byte offsets, which is
+// what grep and rg print as columns and what -pos is usually given.
+var positionEncodings = []string{encodingUTF8, encodingUTF32, encodingUTF16}
+
+// PositionEncoding returns the position encoding the server chose in its
+// initialize result, or UTF-16 when it chose none or hasn't been
+// initialized.
+func (c *LSPClient) PositionEncoding() string {
+	encoding, _ := c.ServerCapabilities()["positionEncoding"].(string)
+	switch encoding {
+	case encodingUTF8, encodingUTF32:
+		return encoding
+	}
+	return encodingUTF16
+}
+
+// runeUnits returns how many code units r takes up in encoding. An empty
+// encoding means UTF-16.
+func runeUnits(r rune, size int, encoding string) int {
+	switch encoding {
+	case encodingUTF8:
+		return size
+	case encodingUTF32:
+		return 1
+	}
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
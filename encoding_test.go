@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestLSPClient_PositionEncoding(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities map[string]any
+		expected     string
+	}{
+		{"utf-8", map[string]any{"positionEncoding": "utf-8"}, encodingUTF8},
+		{"utf-32", map[string]any{"positionEncoding": "utf-32"}, encodingUTF32},
+		{"not chosen", map[string]any{}, encodingUTF16},
+		{"unknown", map[string]any{"positionEncoding": "utf-7"}, encodingUTF16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &LSPClient{initializeResult: &InitializeResult{Capabilities: tt.capabilities}}
+			if got := client.PositionEncoding(); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	if got := (&LSPClient{}).PositionEncoding(); got != encodingUTF16 {
+		t.Errorf("Expected utf-16 before initialization, got %s", got)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stderrTailLines is how many of the server's last stderr lines are kept
+// to explain a crash.
+const stderrTailLines = 10
+
+// exitWaitTimeout bounds how long a failed read waits for the server
+// process to be reaped before giving up on reporting how it exited.
+const exitWaitTimeout = 500 * time.Millisecond
+
+// closeWaitTimeout bounds how long Close waits for the server to exit,
+// after the exit notification or, with -no-exit, its pipes closing,
+// before killing it.
+var closeWaitTimeout = 5 * time.Second
+
+// lineTail keeps the last n lines written to it.
+type lineTail struct {
+	mu    sync.Mutex
+	n     int
+	lines []string
+}
+
+func (t *lineTail) add(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.n {
+		t.lines = t.lines[len(t.lines)-t.n:]
+	}
+}
+
+func (t *lineTail) get() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...)
+}
+
+// waitProcess reaps the server subprocess as soon as it exits, so a read
+// that fails because the server crashed can say how it exited.
+func (c *LSPClient) waitProcess() {
+	// Wait closes stderr, so let the forwarder see EOF first.
+	<-c.stderrDone
+	c.waitErr = c.cmd.Wait()
+	close(c.exited)
+}
+
+// hasExited reports whether the server subprocess has been reaped.
+func (c *LSPClient) hasExited() bool {
+	if c.exited == nil {
+		return false
+	}
+	select {
+	case <-c.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkExit interprets how the server exited after the exit notification.
+// The spec has a server exit with code 0 after a successful shutdown and
+// with 1 when exit came without one, so only other outcomes, including
+// being killed by a signal, are errors.
+func checkExit(shutdownOK bool, waitErr error) error {
+	var exitErr *exec.ExitError
+	if waitErr == nil || !errors.As(waitErr, &exitErr) {
+		return waitErr
+	}
+	if !shutdownOK && exitErr.ExitCode() == 1 {
+		return nil
+	}
+	return fmt.Errorf("server exited abnormally: %w", waitErr)
+}
+
+// waitWithoutExit waits for a server that was shut down without the exit
+// notification to exit on its own after its pipes were closed, killing it
+// if it doesn't. The spec defines no exit code for this, so any one is
+// accepted; only having to kill the server, or it dying from a signal, is
+// an error.
+func (c *LSPClient) waitWithoutExit() error {
+	if !c.waitExited(closeWaitTimeout) {
+		return fmt.Errorf("server did not exit within %v of its pipes closing and was killed", closeWaitTimeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(c.waitErr, &exitErr) && exitErr.ExitCode() >= 0 {
+		return nil
+	}
+	return c.waitErr
+}
+
+// waitExited waits up to d for the server subprocess to exit. If it
+// doesn't, its process group is killed and waitExited returns false once
+// it has been reaped.
+func (c *LSPClient) waitExited(d time.Duration) bool {
+	select {
+	case <-c.exited:
+		return true
+	case <-time.After(d):
+		c.kill()
+		<-c.exited
+		return false
+	}
+}
+
+// kill kills the server subprocess and its process group, unless it has
+// already exited. Unlike Abort it works while Close is in progress, which
+// is what a second Ctrl-C needs.
+func (c *LSPClient) kill() {
+	if c.cmd == nil || c.hasExited() {
+		return
+	}
+	if err := killProcessGroup(c.cmd); err != nil {
+		c.logger.Warn("Failed to kill LSP server", "error", err)
+	}
+}
+
+// serverExitError is a read failure caused by the server process exiting.
+// It unwraps to the read error, so the connection still counts as lost.
+type serverExitError struct {
+	err      error
+	status   string // as reported by exec, e.g. "exit status 2"
+	ExitCode int    // -1 if the server was killed by a signal
+	Stderr   []string
+}
+
+func (e *serverExitError) Error() string {
+	msg := fmt.Sprintf("%v: server exited (%s)", e.err, e.status)
+	if len(e.Stderr) > 0 {
+		msg += "; last server stderr:\n  " + strings.Join(e.Stderr, "\n  ")
+	}
+	return msg
+}
+
+func (e *serverExitError) Unwrap() error {
+	return e.err
+}
+
+// explainExit adds the exit status and the last lines of stderr to a read
+// error if the server subprocess has exited. Other errors, and clients
+// without a subprocess, are returned unchanged.
+func (c *LSPClient) explainExit(err error) error {
+	if c.exited == nil {
+		return err
+	}
+	select {
+	case <-c.exited:
+	case <-time.After(exitWaitTimeout):
+		return err
+	}
+
+	status := "exit status 0"
+	if c.waitErr != nil {
+		status = c.waitErr.Error()
+	}
+	return &serverExitError{
+		err:      err,
+		status:   status,
+		ExitCode: c.cmd.ProcessState.ExitCode(),
+		Stderr:   c.stderrTail.get(),
+	}
+}
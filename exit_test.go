@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLSPClient_ReportsServerExit(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	script := "read -r line; for i in 1 2 3 4 5 6 7 8 9 10 11 12; do echo line $i >&2; done; echo 'panic: boom' >&2; exit 3"
+	client, err := NewLSPClient(context.Background(), ServerCommand{Path: "sh", Args: []string{"-c", script}}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Abort()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = client.SendRequest(ctx, "textDocument/hover", nil)
+
+	var exitErr *serverExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Expected a server exit error, got %v", err)
+	}
+	if exitErr.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", exitErr.ExitCode)
+	}
+	if len(exitErr.Stderr) != stderrTailLines || exitErr.Stderr[len(exitErr.Stderr)-1] != "panic: boom" {
+		t.Errorf("Expected the last %d stderr lines, got %q", stderrTailLines, exitErr.Stderr)
+	}
+	if !strings.Contains(err.Error(), "exit status 3") || !strings.Contains(err.Error(), "panic: boom") {
+		t.Errorf("Expected the exit status and stderr in %q", err)
+	}
+	if !isConnectionLost(err) {
+		t.Error("Expected the error to still count as a lost connection")
+	}
+}
+
+func TestLineTail(t *testing.T) {
+	tail := &lineTail{n: 2}
+	for _, line := range []string{"a", "b", "c"} {
+		tail.add(line)
+	}
+	if got := tail.get(); len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Errorf("Expected [b c], got %q", got)
+	}
+}
+
+func TestLSPClient_ReportsServerExitDuringBatch(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	script := "read -r line; echo 'panic: boom' >&2; exit 3"
+	client, err := NewLSPClient(context.Background(), ServerCommand{Path: "sh", Args: []string{"-c", script}}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Abort()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = client.SendBatch(ctx, []BatchRequest{{Method: "textDocument/hover"}, {Method: "textDocument/definition"}})
+
+	var exitErr *serverExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Expected a server exit error, got %v", err)
+	}
+	if exitErr.ExitCode != 3 || !strings.Contains(err.Error(), "panic: boom") {
+		t.Errorf("Expected exit code 3 and the server's stderr, got %v", err)
+	}
+}
+
+// TestHelperServer is not a real test: run as a subprocess with
+// CLSP_HELPER_SERVER set, it acts as a server for the Close and run
+// tests. The value picks the behavior:
+//
+//	answering       like conformant, and answer other requests: hover
+//	                with {"contents":"hover text"}, definition with an
+//	                error and anything else with null
+//	conformant      exit with 0 after shutdown, 1 without it
+//	shutdown-error  answer shutdown with an error, then behave conformantly
+//	crash-on-exit   exit with 3 after shutdown
+//	hang-on-exit    exit with 2 once stdin closes, and never on exit
+//	ignore-eof      keep running after stdin closes
+func TestHelperServer(t *testing.T) {
+	mode := os.Getenv("CLSP_HELPER_SERVER")
+	if mode == "" {
+		return
+	}
+	reader := bufio.NewReader(os.Stdin)
+	shutdown := false
+	for {
+		content, err := readTestFrame(reader)
+		if err != nil {
+			switch mode {
+			case "hang-on-exit":
+				os.Exit(2)
+			case "ignore-eof":
+				time.Sleep(time.Hour)
+			}
+			os.Exit(1)
+		}
+		var request JSONRPCRequest
+		json.Unmarshal(content, &request)
+		switch request.Method {
+		case "shutdown":
+			response := JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(*request.ID)}
+			if mode == "shutdown-error" {
+				response.Error = &JSONRPCError{Code: -32603, Message: "cannot shut down"}
+			} else {
+				shutdown = true
+			}
+			writeTestFrame(os.Stdout, response)
+		case "exit":
+			switch {
+			case mode == "hang-on-exit":
+				time.Sleep(time.Hour)
+			case mode == "crash-on-exit":
+				os.Exit(3)
+			case shutdown:
+				os.Exit(0)
+			default:
+				os.Exit(1)
+			}
+		default:
+			if mode == "answering" && request.ID != nil {
+				writeTestFrame(os.Stdout, helperAnswer(request))
+			}
+		}
+	}
+}
+
+func helperAnswer(request JSONRPCRequest) JSONRPCResponse {
+	response := JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(*request.ID)}
+	switch request.Method {
+	case "initialize":
+		response.Result = map[string]any{"capabilities": map[string]any{}}
+	case "textDocument/hover":
+		response.Result = map[string]any{"contents": "hover text"}
+	case "textDocument/definition":
+		response.Error = &JSONRPCError{Code: -32603, Message: "no definition here"}
+	}
+	return response
+}
+
+func startHelperServer(t *testing.T, mode string) *LSPClient {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	client, err := NewLSPClient(context.Background(), ServerCommand{
+		Path: os.Args[0],
+		Args: []string{"-test.run=^TestHelperServer$"},
+		Env:  []string{"CLSP_HELPER_SERVER=" + mode},
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestLSPClient_CloseExitStatus(t *testing.T) {
+	tests := []struct {
+		mode      string
+		expectErr bool
+	}{
+		{"conformant", false},
+		{"shutdown-error", false}, // exit code 1 is expected without a shutdown
+		{"crash-on-exit", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			client := startHelperServer(t, tt.mode)
+			err := client.Close()
+			if tt.expectErr != (err != nil) {
+				t.Errorf("Expected error %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestLSPClient_CloseWithoutExit(t *testing.T) {
+	defer func(timeout time.Duration) { closeWaitTimeout = timeout }(closeWaitTimeout)
+	closeWaitTimeout = time.Second
+
+	tests := []struct {
+		mode      string
+		expectErr bool
+	}{
+		{"hang-on-exit", false}, // would hang if exit were sent
+		{"conformant", false},   // exit code 1 after EOF is accepted
+		{"ignore-eof", true},    // killed after closeWaitTimeout
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			client := startHelperServer(t, tt.mode)
+			client.skipExit = true
+			err := client.Close()
+			if tt.expectErr != (err != nil) {
+				t.Errorf("Expected error %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestLSPClient_CloseKillsServerIgnoringExit(t *testing.T) {
+	defer func(timeout time.Duration) { closeWaitTimeout = timeout }(closeWaitTimeout)
+	closeWaitTimeout = time.Second
+
+	client := startHelperServer(t, "hang-on-exit")
+	closed := make(chan error, 1)
+	go func() { closed <- client.Close() }()
+	select {
+	case err := <-closed:
+		if err == nil {
+			t.Error("Expected an error for a server that had to be killed")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close did not return for a server ignoring exit")
+	}
+	if !client.hasExited() {
+		t.Fatal("Expected the server process to be reaped")
+	}
+	if err := client.cmd.Process.Signal(syscall.Signal(0)); err == nil {
+		t.Error("Expected the server process to be gone")
+	}
+}
+
+func TestCheckExit(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	exitWith := func(code string) error {
+		return exec.Command("sh", "-c", "exit "+code).Run()
+	}
+
+	tests := []struct {
+		name       string
+		shutdownOK bool
+		waitErr    error
+		expectErr  bool
+	}{
+		{"clean", true, nil, false},
+		{"exit 1 after shutdown", true, exitWith("1"), true},
+		{"exit 1 without shutdown", false, exitWith("1"), false},
+		{"exit 2 without shutdown", false, exitWith("2"), true},
+		{"other error", false, errors.New("wait failed"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkExit(tt.shutdownOK, tt.waitErr); tt.expectErr != (err != nil) {
+				t.Errorf("Expected error %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeReply is a scripted answer to one request. Messages, such as
+// notifications or responses to other ids, are written first; then the
+// response carries Result or Error unless NoReply is set, and is followed
+// by After. Raw is written as is instead of the response, for replies
+// that break off mid-frame.
+type fakeReply struct {
+	Messages []any
+	Result   any
+	Error    *JSONRPCError
+	NoReply  bool
+	Raw      string
+	After    []any
+}
+
+// fakeMessage is a message the fake server received from the client.
+type fakeMessage struct {
+	Method string
+	ID     *int
+	Params json.RawMessage
+}
+
+// fakeServer is an in-process language server for end-to-end tests. It
+// talks Content-Length framing over a pair of io.Pipes and answers
+// requests from per-method scripts; requests without a script get a null
+// result, and initialize an empty set of capabilities.
+type fakeServer struct {
+	r    *bufio.Reader
+	w    *io.PipeWriter
+	done chan struct{}
+
+	mu       sync.Mutex
+	replies  map[string][]fakeReply
+	received []fakeMessage
+}
+
+// newFakeServer returns a client connected to a new fake server. The
+// connection is torn down when the test ends.
+func newFakeServer(t *testing.T) (*LSPClient, *fakeServer) {
+	t.Helper()
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	s := &fakeServer{
+		r:       bufio.NewReader(serverReader),
+		w:       serverWriter,
+		done:    make(chan struct{}),
+		replies: make(map[string][]fakeReply),
+	}
+	go s.serve()
+
+	transport := &stdioTransport{stdin: clientWriter, stdout: clientReader}
+	t.Cleanup(func() {
+		transport.Close()
+		serverReader.Close()
+		<-s.done
+	})
+	return &LSPClient{
+		transport: transport,
+		reader:    bufio.NewReader(transport),
+		id:        1,
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}, s
+}
+
+// on queues replies for method; each request uses up the next one.
+func (s *fakeServer) on(method string, replies ...fakeReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies[method] = append(s.replies[method], replies...)
+}
+
+// messages waits for the client to hang up and returns everything it sent.
+func (s *fakeServer) messages() []fakeMessage {
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.received)
+}
+
+func (s *fakeServer) serve() {
+	defer close(s.done)
+	defer s.w.Close()
+	for {
+		content, err := readTestFrame(s.r)
+		if err != nil {
+			return
+		}
+		var message fakeMessage
+		json.Unmarshal(content, &message)
+
+		s.mu.Lock()
+		s.received = append(s.received, message)
+		reply, scripted := fakeReply{}, false
+		if queue := s.replies[message.Method]; len(queue) > 0 {
+			reply, scripted = queue[0], true
+			s.replies[message.Method] = queue[1:]
+		}
+		s.mu.Unlock()
+
+		if message.ID == nil {
+			continue
+		}
+		if !scripted && message.Method == "initialize" {
+			reply.Result = InitializeResult{Capabilities: map[string]any{}}
+		}
+		for _, m := range reply.Messages {
+			if err := writeTestFrame(s.w, m); err != nil {
+				return
+			}
+		}
+		if reply.Raw != "" {
+			if _, err := io.WriteString(s.w, reply.Raw); err != nil {
+				return
+			}
+		} else if !reply.NoReply {
+			response := JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(*message.ID), Result: reply.Result, Error: reply.Error}
+			if err := writeTestFrame(s.w, response); err != nil {
+				return
+			}
+		}
+		for _, m := range reply.After {
+			if err := writeTestFrame(s.w, m); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func fakeMethods(messages []fakeMessage) []string {
+	var methods []string
+	for _, m := range messages {
+		methods = append(methods, m.Method)
+	}
+	return methods
+}
+
+func TestFakeServer_Lifecycle(t *testing.T) {
+	client, server := newFakeServer(t)
+	server.on("initialize", fakeReply{Result: InitializeResult{
+		Capabilities: map[string]any{"hoverProvider": true},
+		ServerInfo:   &ServerInfo{Name: "fake"},
+	}})
+	server.on("textDocument/hover", fakeReply{Result: map[string]any{"contents": "hello"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Initialize(ctx, newInitializeParams("file:///tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if client.ServerCapabilities()["hoverProvider"] != true {
+		t.Errorf("Unexpected capabilities %v", client.ServerCapabilities())
+	}
+
+	response, err := client.SendRequest(ctx, "textDocument/hover", textDocumentParams("main.go", 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := response.Result.(map[string]any); result["contents"] != "hello" {
+		t.Errorf("Unexpected result %v", response.Result)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"initialize", "initialized", "textDocument/hover", "shutdown", "exit"}
+	if got := fakeMethods(server.messages()); !slices.Equal(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestFakeServer_SkipsNotificationsAndOtherIDs(t *testing.T) {
+	client, server := newFakeServer(t)
+	server.on("test/method", fakeReply{
+		Messages: []any{
+			map[string]any{"jsonrpc": "2.0", "method": "window/logMessage", "params": map[string]any{"type": 3, "message": "working"}},
+			JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(99), Result: "stale"},
+			JSONRPCResponse{JSONRPC: "2.0", ID: StringID("other"), Result: "wrong id"},
+		},
+		Result: "right",
+	})
+
+	var logged []string
+	client.OnNotification("window/logMessage", func(params json.RawMessage) {
+		logged = append(logged, string(params))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.SendRequest(ctx, "test/method", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Result != "right" {
+		t.Errorf("Expected the matching response, got %v", response.Result)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "working") {
+		t.Errorf("Expected the notification to reach its handler, got %v", logged)
+	}
+}
+
+func TestFakeServer_ErrorResponse(t *testing.T) {
+	client, server := newFakeServer(t)
+	server.on("test/method", fakeReply{Error: &JSONRPCError{Code: -32602, Message: "bad params"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.SendRequest(ctx, "test/method", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Error == nil || response.Error.Code != -32602 {
+		t.Errorf("Expected an InvalidParams error, got %+v", response)
+	}
+}
+
+func TestFakeServer_Timeout(t *testing.T) {
+	client, server := newFakeServer(t)
+	server.on("test/slow", fakeReply{NoReply: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.SendRequest(ctx, "test/slow", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a deadline error, got %v", err)
+	}
+
+	client.transport.Close()
+	messages := server.messages()
+	if got := fakeMethods(messages); !slices.Equal(got, []string{"test/slow", "$/cancelRequest"}) {
+		t.Fatalf("Expected the request to be cancelled, got %v", got)
+	}
+	var cancelled CancelParams
+	json.Unmarshal(messages[1].Params, &cancelled)
+	if cancelled.ID != *messages[0].ID {
+		t.Errorf("Expected $/cancelRequest for id %d, got %d", *messages[0].ID, cancelled.ID)
+	}
+}
+
+// A request that timed out leaves the client usable: the next request,
+// with a fresh deadline, gets its own answer even when the server answers
+// the abandoned one late.
+func TestFakeServer_TimeoutKeepsClientUsable(t *testing.T) {
+	client, server := newFakeServer(t)
+	server.on("test/slow", fakeReply{NoReply: true})
+	server.on("test/next", fakeReply{
+		Messages: []any{JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(1), Result: "late"}},
+		Result:   "next",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, err := client.SendRequest(ctx, "test/slow", nil)
+	cancel()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a deadline error, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	response, err := client.SendRequest(ctx, "test/next", nil)
+	if err != nil {
+		t.Fatalf("Expected the client to survive the timeout, got %v", err)
+	}
+	if response.Result != "next" {
+		t.Errorf("Expected the result of test/next, got %v", response.Result)
+	}
+}
+
+// A server that stalls mid-frame, before the end of the headers or after
+// announcing a body it never sends, can't hold the client past its
+// deadline.
+func TestFakeServer_StalledFrameTimesOut(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"headers", "Content-Length: 40\r\n"},
+		{"body", "Content-Length: 40\r\n\r\n"},
+		{"partial body", "Content-Length: 40\r\n\r\n{\"jsonrpc\":\"2.0\","},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := newFakeServer(t)
+			server.on("test/stall", fakeReply{Raw: tt.raw})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			done := make(chan error, 1)
+			go func() {
+				_, err := client.SendRequest(ctx, "test/stall", nil)
+				done <- err
+			}()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("Expected a deadline error, got %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("SendRequest blocked past its deadline on a stalled frame")
+			}
+		})
+	}
+}
+
+// chunkedTransport writes in small pieces, yielding between them, the way
+// a large write to a pipe may be split. Writes that aren't serialized then
+// interleave.
+type chunkedTransport struct {
+	io.ReadWriteCloser
+	size int
+}
+
+func (t *chunkedTransport) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(t.size, len(p))
+		if _, err := t.ReadWriteCloser.Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+		runtime.Gosched()
+	}
+	return written, nil
+}
+
+// Notifications sent from other goroutines while a request waits for its
+// response arrive as whole frames.
+func TestFakeServer_NotificationsDuringRequest(t *testing.T) {
+	client, server := newFakeServer(t)
+	client.transport = &chunkedTransport{ReadWriteCloser: client.transport, size: 8}
+	server.on("test/slow", fakeReply{NoReply: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pending := make(chan error, 1)
+	go func() {
+		_, err := client.SendRequest(ctx, "test/slow", nil)
+		pending <- err
+	}()
+
+	const senders = 8
+	var wg sync.WaitGroup
+	for i := range senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			text := strings.Repeat(string(rune('a'+i)), 200)
+			if err := client.SendNotification("test/note", map[string]any{"text": text}); err != nil {
+				t.Errorf("SendNotification failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+	<-pending
+
+	client.transport.Close()
+	notes := 0
+	for _, m := range server.messages() {
+		if m.Method != "test/note" {
+			continue
+		}
+		notes++
+		var params struct{ Text string }
+		if err := json.Unmarshal(m.Params, &params); err != nil || len(params.Text) != 200 || strings.Count(params.Text, params.Text[:1]) != 200 {
+			t.Errorf("Expected an intact notification, got %s", m.Params)
+		}
+	}
+	if notes != senders {
+		t.Errorf("Expected %d notifications, got %d", senders, notes)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "strings"
+
+// stringSliceFlag is a flag.Value that collects every occurrence of a
+// repeatable flag in order.
+type stringSliceFlag []string
+
+func (f *stringSliceFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringSliceFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// serverArguments combines the comma-separated -args value with the -arg
+// values: the -args entries come first, followed by each -arg in order.
+// Only -arg can carry an argument containing a comma.
+func serverArguments(commaSeparated string, args []string) []string {
+	var result []string
+	if commaSeparated != "" {
+		for _, arg := range strings.Split(commaSeparated, ",") {
+			result = append(result, strings.TrimSpace(arg))
+		}
+	}
+	return append(result, args...)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"testing"
+)
+
+func TestServerArguments(t *testing.T) {
+	tests := []struct {
+		name           string
+		commaSeparated string
+		args           []string
+		expected       []string
+	}{
+		{"none", "", nil, nil},
+		{"comma-separated", "serve, -rpc.trace", nil, []string{"serve", "-rpc.trace"}},
+		{"arg with comma", "", []string{"-remote=auto,localhost:1234"}, []string{"-remote=auto,localhost:1234"}},
+		{"both", "serve", []string{"-remote=auto,localhost:1234", "-v"}, []string{"serve", "-remote=auto,localhost:1234", "-v"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serverArguments(tt.commaSeparated, tt.args); !slices.Equal(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStringSliceFlag(t *testing.T) {
+	var args stringSliceFlag
+	fs := flag.NewFlagSet("clsp", flag.ContinueOnError)
+	fs.Var(&args, "arg", "")
+	if err := fs.Parse([]string{"-arg", "-remote=auto,localhost:1234", "-arg", "serve"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"-remote=auto,localhost:1234", "serve"}; !slices.Equal(args, expected) {
+		t.Errorf("Expected %q, got %q", expected, args)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+type FoldingRange struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+	// StartCharacter and EndCharacter are only sent by servers that fold
+	// within lines, which clients opt into by not setting lineFoldingOnly.
+	StartCharacter *int   `json:"startCharacter,omitempty"`
+	EndCharacter   *int   `json:"endCharacter,omitempty"`
+	Kind           string `json:"kind,omitempty"` // comment, imports, region or a server's own
+	CollapsedText  string `json:"collapsedText,omitempty"`
+}
+
+// foldingRanges extracts a FoldingRange[] result.
+func foldingRanges(result any) ([]FoldingRange, bool) {
+	return decodeList[FoldingRange](result)
+}
+
+// start and end return where r starts and ends as a line and character.
+// A missing start character is the start of the line and a missing end
+// character the end of it.
+func (r FoldingRange) start() (int, int) {
+	if r.StartCharacter == nil {
+		return r.StartLine, 0
+	}
+	return r.StartLine, *r.StartCharacter
+}
+
+func (r FoldingRange) end() (int, int) {
+	if r.EndCharacter == nil {
+		return r.EndLine, math.MaxInt
+	}
+	return r.EndLine, *r.EndCharacter
+}
+
+// contains reports whether other lies within r.
+func (r FoldingRange) contains(other FoldingRange) bool {
+	rStartLine, rStartChar := r.start()
+	rEndLine, rEndChar := r.end()
+	oStartLine, oStartChar := other.start()
+	oEndLine, oEndChar := other.end()
+	return comparePosition(rStartLine, rStartChar, oStartLine, oStartChar) <= 0 &&
+		comparePosition(oEndLine, oEndChar, rEndLine, rEndChar) <= 0
+}
+
+func comparePosition(line1, char1, line2, char2 int) int {
+	return cmp.Or(cmp.Compare(line1, line2), cmp.Compare(char1, char2))
+}
+
+// label returns the 1-based span of r: `start-end` lines, or
+// `line:col-line:col` for a range with character offsets.
+func (r FoldingRange) label() string {
+	if r.StartCharacter == nil && r.EndCharacter == nil {
+		return fmt.Sprintf("%d-%d", r.StartLine+1, r.EndLine+1)
+	}
+	startLine, startChar := r.start()
+	label := fmt.Sprintf("%d:%d-%d", startLine+1, startChar+1, r.EndLine+1)
+	if r.EndCharacter != nil {
+		label += fmt.Sprintf(":%d", *r.EndCharacter+1)
+	}
+	return label
+}
+
+// formatFoldingRanges renders ranges as an outline: servers send a flat
+// list, and each range is indented under the ranges that contain it.
+// Lines read `start-end  kind  "collapsed text"`, 1-based, with the parts
+// the server didn't send left out.
+func formatFoldingRanges(ranges []FoldingRange) string {
+	if len(ranges) == 0 {
+		return "No folding ranges\n"
+	}
+	// Outer ranges first: by start, and the longer of two ranges that
+	// start together.
+	sorted := slices.Clone(ranges)
+	slices.SortStableFunc(sorted, func(a, b FoldingRange) int {
+		aLine, aChar := a.start()
+		bLine, bChar := b.start()
+		if c := comparePosition(aLine, aChar, bLine, bChar); c != 0 {
+			return c
+		}
+		aEndLine, aEndChar := a.end()
+		bEndLine, bEndChar := b.end()
+		return comparePosition(bEndLine, bEndChar, aEndLine, aEndChar)
+	})
+
+	var b strings.Builder
+	var parents []FoldingRange
+	for _, r := range sorted {
+		for len(parents) > 0 && !parents[len(parents)-1].contains(r) {
+			parents = parents[:len(parents)-1]
+		}
+		line := strings.Repeat("  ", len(parents)) + r.label()
+		if r.Kind != "" {
+			line += "  " + r.Kind
+		}
+		if r.CollapsedText != "" {
+			line += fmt.Sprintf("  %q", r.CollapsedText)
+		}
+		b.WriteString(line + "\n")
+		parents = append(parents, r)
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestFoldingRanges(t *testing.T) {
+	testCases := []struct {
+		name     string
+		result   string
+		expected string
+		ok       bool
+	}{
+		{
+			name: "lines only",
+			result: `[
+				{"startLine": 10, "endLine": 40},
+				{"startLine": 2, "endLine": 6, "kind": "imports"},
+				{"startLine": 12, "endLine": 20},
+				{"startLine": 0, "endLine": 1, "kind": "comment"},
+				{"startLine": 14, "endLine": 16, "kind": "region", "collapsedText": "setup"},
+				{"startLine": 25, "endLine": 39}
+			]`,
+			expected: "1-2  comment\n3-7  imports\n11-41\n  13-21\n    15-17  region  \"setup\"\n  26-40\n",
+			ok:       true,
+		},
+		{
+			name: "character offsets",
+			result: `[
+				{"startLine": 3, "startCharacter": 20, "endLine": 3, "endCharacter": 40},
+				{"startLine": 3, "startCharacter": 10, "endLine": 8, "endCharacter": 1},
+				{"startLine": 3, "startCharacter": 42, "endLine": 5}
+			]`,
+			expected: "4:11-9:2\n  4:21-4:41\n  4:43-6\n",
+			ok:       true,
+		},
+		{
+			name:     "same start",
+			result:   `[{"startLine": 1, "endLine": 3}, {"startLine": 1, "endLine": 9}]`,
+			expected: "2-10\n  2-4\n",
+			ok:       true,
+		},
+		{"null", `null`, "No folding ranges\n", true},
+		{"not ranges", `{"startLine": 1}`, "", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ranges, ok := foldingRanges(decodeResult(t, tc.result))
+			if ok != tc.ok {
+				t.Fatalf("Expected ok %v, got %v", tc.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			if got := formatFoldingRanges(ranges); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
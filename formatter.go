@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// resultFormatter prints a result in a form made for it. It returns
+// errUnformattable, without writing anything, for a result of a shape it
+// doesn't know, which is then printed by the next formatter that applies
+// or as pretty JSON.
+type resultFormatter func(result any, w io.Writer, opts outputOptions) (formatted, error)
+
+// formatted is what printResponse needs to know about a formatted result
+// besides its text.
+type formatted struct {
+	summary string // added to the "Response for" header, such as "3 items"
+	omitted int    // entries left out for -limit
+}
+
+var errUnformattable = errors.New("result has an unexpected shape")
+
+// formatterKey names the formatter of a format for a method. An empty
+// method is the format's formatter for any method.
+type formatterKey struct {
+	format string
+	method string
+}
+
+// The pretty format's list options are formatters too, under keys that
+// aren't -format values. See outputOptions.formats.
+const (
+	formatCallList    = "call-list"    // -call-hierarchy
+	formatLinkList    = "link-list"    // -resolve-links
+	formatFlatSymbols = "flat-symbols" // -flatten-symbols
+	formatRender      = "render"       // -render
+)
+
+// formatters holds the formatters of the output formats: those of the
+// text format by method, and the others for any method whose result has
+// the shape they know.
+var formatters = map[formatterKey]resultFormatter{
+	{"text", "textDocument/hover"}:          hoverFormatter,
+	{"text", "textDocument/completion"}:     completionFormatter,
+	{"text", "textDocument/signatureHelp"}:  signatureFormatter,
+	{"text", "textDocument/documentSymbol"}: symbolsFormatter,
+	{"text", "textDocument/references"}:     locationsFormatter,
+	{"text", "textDocument/definition"}:     locationsFormatter,
+	{"text", "textDocument/declaration"}:    locationsFormatter,
+	{"text", "textDocument/typeDefinition"}: locationsFormatter,
+	{"text", "textDocument/implementation"}: locationsFormatter,
+	{"text", "textDocument/diagnostic"}:     diagnosticsFormatter,
+	{"text", "workspace/diagnostic"}:        diagnosticsFormatter,
+	{"text", "callHierarchy/incomingCalls"}: callsFormatter,
+	{"text", "callHierarchy/outgoingCalls"}: callsFormatter,
+	{"text", "textDocument/documentLink"}:   documentLinksFormatter,
+	{"text", "textDocument/inlayHint"}:      inlayHintsFormatter,
+	{"text", "textDocument/foldingRange"}:   foldingRangesFormatter,
+
+	{"completion", ""}:  completionFormatter,
+	{"diff", ""}:        diffFormatter,
+	{"references", ""}:  locationsFormatter,
+	{"diagnostics", ""}: diagnosticsFormatter,
+	{"signature", ""}:   signatureFormatter,
+	{"tokens", ""}:      tokensFormatter,
+
+	{formatCallList, ""}:    callsFormatter,
+	{formatLinkList, ""}:    documentLinksFormatter,
+	{formatFlatSymbols, ""}: symbolsFormatter,
+	{formatRender, ""}:      hoverFormatter,
+}
+
+// formatterFor returns the formatter of format for method.
+func formatterFor(format, method string) (resultFormatter, bool) {
+	if f, ok := formatters[formatterKey{format, method}]; ok {
+		return f, true
+	}
+	f, ok := formatters[formatterKey{format, ""}]
+	return f, ok
+}
+
+// formats returns the formatters to try, in order, before printing a
+// result as JSON. Every format but the JSON ones falls back to pretty, so
+// the pretty list options apply to them too.
+func (o outputOptions) formats() []string {
+	var formats []string
+	switch o.format {
+	case "json", "ndjson", "raw":
+		return nil
+	case "pretty":
+	default:
+		formats = append(formats, o.format)
+	}
+	if o.callList {
+		formats = append(formats, formatCallList)
+	}
+	if o.linkList {
+		formats = append(formats, formatLinkList)
+	}
+	if o.flatSymbols {
+		formats = append(formats, formatFlatSymbols)
+	}
+	if o.render {
+		formats = append(formats, formatRender)
+	}
+	return formats
+}
+
+func hoverFormatter(result any, w io.Writer, opts outputOptions) (formatted, error) {
+	text, ok := hoverText(result)
+	if !ok {
+		return formatted{}, errUnformattable
+	}
+	if opts.stripFences {
+		text = stripMarkdownFences(text)
+	}
+	_, err := fmt.Fprintln(w, text)
+	return formatted{}, err
+}
+
+func completionFormatter(result any, w io.Writer, opts outputOptions) (formatted, error) {
+	items, incomplete, ok := completionItems(result)
+	if !ok {
+		return formatted{}, errUnformattable
+	}
+	out := formatted{summary: fmt.Sprintf("%d items", len(items))}
+	if incomplete {
+		out.summary += ", incomplete"
+	}
+	items, out.omitted = truncate(items, opts.limit)
+	_, err := io.WriteString(w, formatCompletionItems(items))
+	return out, err
+}
+
+func diffFormatter(result any, w io.Writer, opts outputOptions) (formatted, error) {
+	edits, ok := textEdits(result)
+	if !ok || opts.documentText == nil {
+		return formatted{}, errUnformattable
+	}
+	text, ok := opts.documentText(opts.documentURI)
+	if !ok {
+		return formatted{}, errUnformattable
+	}
+	diff, err := formatEditsDiff(text, edits, displayPath(opts.documentURI, opts.root), opts.encoding())
+	if err != nil {
+		return formatted{}, err
+	}
+	_, err = io.WriteString(w, diff)
+	return formatted{summary: fmt.Sprintf("%d edits", len(edits))}, err
+}
+
+func signatureFormatter(result any, w io.Writer, opts outputOptions) (formatted, error) {
+	help, ok := signatureHelp(result)
+	if !ok {
+		return formatted{}, errUnformattable
+	}
+	_, err := io.WriteString(w, formatSignatureHelp(help, opts.color, opts.encoding()))
+	return formatted{summary: fmt.Sprintf("%d signatures", len(help.Signatures))}, err
+}
+
+func symbolsFormatter(result any, w io.Writer, opts outputOptions) (formatted, error) {
+	symbols, ok := flattenSymbols(result)
+	if !ok {
+		return formatted{}, errUnformattable
+	}
+	var out formatted
+	symbols, out.omitted = truncate(symbols, opts.limit)
+	_, err := io.WriteString(w, formatSymbols(symbols))
+	return out, err
+}
+
+func locationsFormatter(result any, w io.Writer, opts outputOptions) (formatted, error) {
+	locs, ok := locations(result)
+	if !ok {
+		return formatted{}, errUnformattable
+	}
+	out := formatted{summary: fmt.Sprintf("%d locations in %d files", len(locs), countFiles(locs))}
+	// Keep the first locations in the order they are printed.
+	sortLocations(locs, opts.root)
+	locs, out.omitted = truncate(locs, opts.limit)
+	_, err := io.WriteString(w, formatLocations(locs, opts.root))
+	return out, err
+}
+
+func diagnosticsFormatter(result any, w io.Writer, opts outputOptions) (formatted, error) {
+	reports, ok := diagnosticReports(result)
+	if !ok {
+		return formatted{}, errUnformattable
+	}
+	_, err := io.WriteString(w, formatDiagnosticReports(reports))
+	return formatted{summary: fmt.Sprintf("%d diagnostics", countDiagnostics(reports))}, err
+}
+
+func tokensFormatter(result any, w io.Writer, opts outputOptions) (formatted, error) {
+	data, ok := semanticTokenData(result)
+	if !ok {
+		return formatted{}, errUnformattable
+	}
+	var legend SemanticTokensLegend
+	if opts.tokenLegend != nil {
+		legend, _ = opts.tokenLegend()
+	}
+	tokens := decodeSemanticTokens(data, legend)
+	out := formatted{summary: fmt.Sprintf("%d tokens", len(tokens))}
+	var text *string
+	if opts.documentText != nil {
+		if t, ok := opts.documentText(opts.documentURI); ok {
+			text = &t
+		}
+	}
+	tokens, out.omitted = truncate(tokens, opts.limit)
+	_, err := io.WriteString(w, formatSemanticTokens(tokens, text, opts.encoding()))
+	return out, err
+}
+
+func callsFormatter(result any, w io.Writer, opts outputOptions) (formatted, error) {
+	items, ok := callHierarchyCalls(result)
+	if !ok {
+		return formatted{}, errUnformattable
+	}
+	if len(items) == 0 {
+		_, err := fmt.Fprintln(w, "No calls")
+		return formatted{}, err
+	}
+	var out formatted
+	items, out.omitted = truncate(items, opts.limit)
+	_, err := io.WriteString(w, formatCallHierarchyItems(items, opts.root))
+	return out, err
+}
+
+func documentLinksFormatter(result any, w io.Writer, opts outputOptions) (formatted, error) {
+	links, ok := documentLinks(result)
+	if !ok {
+		return formatted{}, errUnformattable
+	}
+	var out formatted
+	links, out.omitted = truncate(links, opts.limit)
+	_, err := io.WriteString(w, formatDocumentLinks(links))
+	return out, err
+}
+
+func inlayHintsFormatter(result any, w io.Writer, opts outputOptions) (formatted, error) {
+	hints, ok := inlayHints(result)
+	if !ok {
+		return formatted{}, errUnformattable
+	}
+	var out formatted
+	hints, out.omitted = truncate(hints, opts.limit)
+	_, err := io.WriteString(w, formatInlayHints(hints))
+	return out, err
+}
+
+func foldingRangesFormatter(result any, w io.Writer, opts outputOptions) (formatted, error) {
+	ranges, ok := foldingRanges(result)
+	if !ok {
+		return formatted{}, errUnformattable
+	}
+	var out formatted
+	ranges, out.omitted = truncate(ranges, opts.limit)
+	_, err := io.WriteString(w, formatFoldingRanges(ranges))
+	return out, err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFormatters(t *testing.T) {
+	testCases := []struct {
+		method   string
+		result   string
+		expected string
+	}{
+		{"textDocument/hover", `{"contents": {"kind": "plaintext", "value": "var x int"}}`, "var x int\n"},
+		{"textDocument/documentSymbol", `[{"name": "main", "kind": 12, "range": {"start": {"line": 2, "character": 0}}, "selectionRange": {"start": {"line": 2, "character": 5}}}]`, "main  Function  3:6\n"},
+		{"textDocument/definition", `[{"uri": "file:///src/a.go", "range": {"start": {"line": 0, "character": 3}, "end": {"line": 0, "character": 4}}}]`, "/src/a.go\n  1:4\n"},
+		{"textDocument/typeDefinition", `[{"targetUri": "file:///src/t.go", "targetRange": {"start": {"line": 4, "character": 0}}, "targetSelectionRange": {"start": {"line": 4, "character": 5}}}]`, "/src/t.go\n  5:6\n"},
+		{"textDocument/implementation", `[{"uri": "file:///src/b.go", "range": {"start": {"line": 9, "character": 1}}}, {"uri": "file:///src/a.go", "range": {"start": {"line": 2, "character": 0}}}]`, "/src/a.go\n  3:1\n/src/b.go\n  10:2\n"},
+		{"callHierarchy/incomingCalls", `[]`, "No calls\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.method, func(t *testing.T) {
+			f, ok := formatterFor("text", tc.method)
+			if !ok {
+				t.Fatalf("Expected a formatter for %s", tc.method)
+			}
+			var b strings.Builder
+			if _, err := f(decodeResult(t, tc.result), &b, outputOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, b.String())
+			}
+		})
+	}
+}
+
+func TestFormatters_Unformattable(t *testing.T) {
+	for key, f := range formatters {
+		var b strings.Builder
+		if _, err := f(decodeResult(t, `"unexpected"`), &b, outputOptions{}); !errors.Is(err, errUnformattable) || b.Len() != 0 {
+			t.Errorf("%v: expected errUnformattable and no output, got %v and %q", key, err, b.String())
+		}
+	}
+}
+
+func TestFormatters_Options(t *testing.T) {
+	result := decodeResult(t, `[{"uri": "file:///src/b.go", "range": {"start": {"line": 9, "character": 1}}}, {"uri": "file:///src/a.go", "range": {"start": {"line": 2, "character": 0}}}, {"uri": "file:///other/c.go", "range": {"start": {"line": 0, "character": 0}}}]`)
+	f, _ := formatterFor("text", "textDocument/references")
+	var b strings.Builder
+	out, err := f(result, &b, outputOptions{root: "/src", limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "/other/c.go\n  1:1\na.go\n  3:1\n"
+	if b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+	if out.summary != "3 locations in 3 files" || out.omitted != 1 {
+		t.Errorf("Expected the summary of all locations and 1 omitted, got %q and %d", out.summary, out.omitted)
+	}
+}
+
+func TestOutputOptionsFormats(t *testing.T) {
+	testCases := []struct {
+		opts     outputOptions
+		expected []string
+	}{
+		{outputOptions{format: "pretty"}, nil},
+		{outputOptions{format: "json", flatSymbols: true}, nil},
+		{outputOptions{format: "pretty", flatSymbols: true, render: true}, []string{formatFlatSymbols, formatRender}},
+		{outputOptions{format: "text", callList: true}, []string{"text", formatCallList}},
+		{outputOptions{format: "completion"}, []string{"completion"}},
+	}
+	for _, tc := range testCases {
+		if got := tc.opts.formats(); !slices.Equal(got, tc.expected) {
+			t.Errorf("%+v: expected %v, got %v", tc.opts, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// inlayHintKinds names the InlayHintKind values, which start at 1.
+var inlayHintKinds = []string{"", "Type", "Parameter"}
+
+type InlayHint struct {
+	Position Position `json:"position"`
+	// Label is a string or an array of InlayHintLabelPart, whose values
+	// are shown one after another.
+	Label        any  `json:"label"`
+	Kind         int  `json:"kind,omitempty"`
+	PaddingLeft  bool `json:"paddingLeft,omitempty"`
+	PaddingRight bool `json:"paddingRight,omitempty"`
+}
+
+// inlayHints extracts a textDocument/inlayHint result.
+func inlayHints(result any) ([]InlayHint, bool) {
+	hints, ok := decodeList[InlayHint](result)
+	if !ok {
+		return nil, false
+	}
+	for _, hint := range hints {
+		if _, ok := inlayHintLabel(hint.Label); !ok {
+			return nil, false
+		}
+	}
+	return hints, true
+}
+
+// inlayHintLabel returns the text of a label: the string itself, or the
+// values of its parts joined.
+func inlayHintLabel(label any) (string, bool) {
+	switch l := label.(type) {
+	case string:
+		return l, true
+	case []any:
+		var b strings.Builder
+		for _, part := range l {
+			p, ok := part.(map[string]any)
+			if !ok {
+				return "", false
+			}
+			value, ok := p["value"].(string)
+			if !ok {
+				return "", false
+			}
+			b.WriteString(value)
+		}
+		return b.String(), true
+	}
+	return "", false
+}
+
+// formatInlayHints renders one aligned `line:col  kind  label` line per
+// hint, with 1-based positions and the label as an editor would show it
+// inline, padding included.
+func formatInlayHints(hints []InlayHint) string {
+	if len(hints) == 0 {
+		return "No inlay hints\n"
+	}
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, hint := range hints {
+		kind := "-"
+		if hint.Kind > 0 && hint.Kind < len(inlayHintKinds) {
+			kind = inlayHintKinds[hint.Kind]
+		}
+		label, _ := inlayHintLabel(hint.Label)
+		if hint.PaddingLeft {
+			label = " " + label
+		}
+		if hint.PaddingRight {
+			label += " "
+		}
+		fmt.Fprintf(w, "%d:%d\t%s\t%q\n", hint.Position.Line+1, hint.Position.Character+1, kind, label)
+	}
+	w.Flush()
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestInlayHints(t *testing.T) {
+	testCases := []struct {
+		name     string
+		result   string
+		expected string
+		ok       bool
+	}{
+		{
+			name: "labels and parts",
+			result: `[
+				{"position": {"line": 4, "character": 9}, "label": "int", "kind": 1, "paddingLeft": true},
+				{"position": {"line": 5, "character": 12}, "label": [{"value": "format"}, {"value": ":", "tooltip": "x"}], "kind": 2, "paddingRight": true},
+				{"position": {"line": 6, "character": 0}, "label": "hint"}
+			]`,
+			expected: "5:10  Type       \" int\"\n6:13  Parameter  \"format: \"\n7:1   -          \"hint\"\n",
+			ok:       true,
+		},
+		{"null", `null`, "No inlay hints\n", true},
+		{"bad label", `[{"position": {"line": 0, "character": 0}, "label": [1]}]`, "", false},
+		{"not hints", `{"contents": "x"}`, "", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hints, ok := inlayHints(decodeResult(t, tc.result))
+			if ok != tc.ok {
+				t.Fatalf("Expected ok %v, got %v", tc.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			if got := formatInlayHints(hints); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
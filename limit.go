@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+)
+
+// truncate returns the first n elements of s and how many were dropped.
+// n <= 0 means no limit.
+func truncate[T any](s []T, n int) ([]T, int) {
+	if n <= 0 || len(s) <= n {
+		return s, 0
+	}
+	return s[:n], len(s) - n
+}
+
+// limitResult cuts an array result, or the items of a CompletionList, down
+// to its first n entries, so that JSON output stays valid. It returns the
+// new result and how many entries were dropped; other results are
+// returned as they are.
+func limitResult(result any, n int) (any, int) {
+	switch r := result.(type) {
+	case []any:
+		return truncate(r, n)
+	case map[string]any:
+		items, ok := r["items"].([]any)
+		if !ok {
+			return result, 0
+		}
+		items, omitted := truncate(items, n)
+		if omitted == 0 {
+			return result, 0
+		}
+		list := maps.Clone(r)
+		list["items"] = items
+		return list, omitted
+	}
+	return result, 0
+}
+
+// resultCount returns how many entries a result lists, for -count-only:
+// the length of an array result or of the items of a CompletionList or
+// diagnostic report, or the number of semantic tokens. null counts as 0;
+// ok is false for other results.
+func resultCount(result any) (int, bool) {
+	switch r := result.(type) {
+	case nil:
+		return 0, true
+	case []any:
+		return len(r), true
+	case map[string]any:
+		if items, ok := r["items"].([]any); ok {
+			return len(items), true
+		}
+		if data, ok := semanticTokenData(r); ok {
+			return len(data) / 5, true
+		}
+	}
+	return 0, false
+}
+
+// isEmptyResult reports whether a result is null or an empty array, as
+// servers answer when there is nothing at the position, such as no
+// definition.
+func isEmptyResult(result any) bool {
+	switch r := result.(type) {
+	case nil:
+		return true
+	case []any:
+		return len(r) == 0
+	}
+	return false
+}
+
+// printOmitted notes how many entries -limit left out. It goes to stdout
+// after text output, and to stderr when stdout must stay JSON or hold
+// nothing but the result.
+func printOmitted(omitted int, opts outputOptions) {
+	if omitted == 0 {
+		return
+	}
+	w := os.Stdout
+	switch {
+	case opts.quiet, opts.format == "json", opts.format == "ndjson", opts.format == "raw":
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "… and %d more\n", omitted)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	s := []int{1, 2, 3}
+	for _, tc := range []struct {
+		n        int
+		expected []int
+		omitted  int
+	}{
+		{0, []int{1, 2, 3}, 0},
+		{2, []int{1, 2}, 1},
+		{3, []int{1, 2, 3}, 0},
+		{5, []int{1, 2, 3}, 0},
+	} {
+		got, omitted := truncate(s, tc.n)
+		if !reflect.DeepEqual(got, tc.expected) || omitted != tc.omitted {
+			t.Errorf("truncate(%v, %d) = %v, %d; expected %v, %d", s, tc.n, got, omitted, tc.expected, tc.omitted)
+		}
+	}
+}
+
+func TestLimitResult(t *testing.T) {
+	testCases := []struct {
+		name     string
+		result   string
+		expected string
+		omitted  int
+	}{
+		{"array", `[1, 2, 3, 4]`, `[1, 2]`, 2},
+		{"short array", `[1]`, `[1]`, 0},
+		{"completion list", `{"isIncomplete": true, "items": [{"label": "a"}, {"label": "b"}, {"label": "c"}]}`, `{"isIncomplete": true, "items": [{"label": "a"}, {"label": "b"}]}`, 1},
+		{"object", `{"contents": "x"}`, `{"contents": "x"}`, 0},
+		{"null", `null`, `null`, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := decodeResult(t, tc.result)
+			got, omitted := limitResult(result, 2)
+			if expected := decodeResult(t, tc.expected); !reflect.DeepEqual(got, expected) || omitted != tc.omitted {
+				t.Errorf("Expected %v with %d omitted, got %v with %d", expected, tc.omitted, got, omitted)
+			}
+		})
+	}
+
+	list := decodeResult(t, `{"items": [1, 2, 3]}`)
+	limitResult(list, 1)
+	if items := list.(map[string]any)["items"].([]any); len(items) != 3 {
+		t.Errorf("limitResult modified the original list: %v", items)
+	}
+}
+
+func TestSortLocations(t *testing.T) {
+	locs := []Location{
+		{URI: "file:///root/b.go", Range: Range{Start: Position{Line: 1}}},
+		{URI: "file:///root/a.go", Range: Range{Start: Position{Line: 9}}},
+		{URI: "file:///root/a.go", Range: Range{Start: Position{Line: 2}}},
+	}
+	sortLocations(locs, "/root")
+	if locs[0].Range.Start.Line != 2 || locs[1].Range.Start.Line != 9 || locs[2].URI != "file:///root/b.go" {
+		t.Errorf("Unexpected order %v", locs)
+	}
+}
+
+func TestResultCount(t *testing.T) {
+	testCases := []struct {
+		name     string
+		result   string
+		expected int
+		ok       bool
+	}{
+		{"array", `[{"uri": "file:///a.go"}, {"uri": "file:///b.go"}]`, 2, true},
+		{"empty array", `[]`, 0, true},
+		{"null", `null`, 0, true},
+		{"completion list", `{"isIncomplete": false, "items": [{"label": "a"}]}`, 1, true},
+		{"semantic tokens", `{"data": [0, 0, 4, 1, 0, 1, 2, 3, 0, 0]}`, 2, true},
+		{"object", `{"contents": "x"}`, 0, false},
+		{"string", `"x"`, 0, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := resultCount(decodeResult(t, tc.result))
+			if got != tc.expected || ok != tc.ok {
+				t.Errorf("Expected (%d, %v), got (%d, %v)", tc.expected, tc.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestIsEmptyResult(t *testing.T) {
+	for _, tc := range []struct {
+		result   string
+		expected bool
+	}{
+		{`null`, true},
+		{`[]`, true},
+		{`[{"uri": "file:///a.go"}]`, false},
+		{`{}`, false},
+		{`{"items": []}`, false},
+		{`""`, false},
+	} {
+		if got := isEmptyResult(decodeResult(t, tc.result)); got != tc.expected {
+			t.Errorf("isEmptyResult(%s) = %v; expected %v", tc.result, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// linger keeps reading messages from client for d, calling print with
+// each notification as it arrives. Every message is still dispatched, so
+// handlers such as those of -wait-diagnostics and -show-progress see them
+// and server requests are answered. Only the end of d stops it without an
+// error.
+func linger(ctx context.Context, client *LSPClient, d time.Duration, print func(*Notification)) error {
+	client.callMu.Lock()
+	defer client.callMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	for {
+		content, err := client.readMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return client.explainExit(err)
+		}
+		response, notification, err := client.dispatchMessage(content)
+		if err != nil {
+			return err
+		}
+		if notification != nil {
+			print(notification)
+		}
+		if response != nil {
+			client.logger.Debug("Ignoring response while lingering", "id", response.ID)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestLinger(t *testing.T) {
+	client, server := newFakeServer(t)
+	server.on("textDocument/hover",
+		fakeReply{
+			Result: "hover",
+			After: []any{
+				JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(99), Result: "stale"},
+				publishDiagnostics("file:///a.go", 1),
+				map[string]any{"jsonrpc": "2.0", "method": "window/logMessage", "params": map[string]any{"type": 3, "message": "x"}},
+			},
+		},
+	)
+
+	var diagnostics int
+	client.OnNotification("textDocument/publishDiagnostics", func(json.RawMessage) { diagnostics++ })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SendRequest(ctx, "textDocument/hover", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var methods []string
+	start := time.Now()
+	err := linger(ctx, client, 200*time.Millisecond, func(n *Notification) {
+		methods = append(methods, n.Method)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected linger to last 200ms, got %v", elapsed)
+	}
+	if len(methods) != 2 || methods[0] != "textDocument/publishDiagnostics" || methods[1] != "window/logMessage" {
+		t.Errorf("Expected the two notifications in order, got %v", methods)
+	}
+	if diagnostics != 1 {
+		t.Errorf("Expected the notifications to be dispatched to handlers too, got %d", diagnostics)
+	}
+}
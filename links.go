@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+type DocumentLink struct {
+	Range   Range  `json:"range"`
+	Target  string `json:"target,omitempty"`
+	Tooltip string `json:"tooltip,omitempty"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// decodeList decodes an array result into a []T. null, which servers
+// return when there is nothing to list, is an empty list. ok is false for
+// other shapes.
+func decodeList[T any](result any) ([]T, bool) {
+	if result == nil {
+		return nil, true
+	}
+	raw, ok := result.([]any)
+	if !ok {
+		return nil, false
+	}
+	var list []T
+	if err := remarshal(raw, &list); err != nil {
+		return nil, false
+	}
+	return list, true
+}
+
+// documentLinks extracts a DocumentLink[] result.
+func documentLinks(result any) ([]DocumentLink, bool) {
+	return decodeList[DocumentLink](result)
+}
+
+// resolveDocumentLinks runs textDocument/documentLink and sends
+// documentLink/resolve for each link that came back without a target,
+// putting the resolved link in its place. Servers that return resolved
+// links get no resolve requests. Like callHierarchy, it returns the
+// method and response to print: the links, or the request that failed
+// with an error response.
+func resolveDocumentLinks(send func(method string, params any) (*JSONRPCResponse, error), params any) (string, *JSONRPCResponse, error) {
+	const method = "textDocument/documentLink"
+	response, err := send(method, params)
+	if err != nil || response == nil || response.Error != nil {
+		return method, response, err
+	}
+	items, ok := response.Result.([]any)
+	if !ok {
+		return method, response, nil
+	}
+
+	resolved := make([]any, len(items))
+	for i, item := range items {
+		resolved[i] = item
+		if link, ok := item.(map[string]any); !ok || link["target"] != nil {
+			continue
+		}
+		linkResponse, err := send("documentLink/resolve", item)
+		if err != nil || linkResponse.Error != nil {
+			return "documentLink/resolve", linkResponse, err
+		}
+		resolved[i] = linkResponse.Result
+	}
+	links := *response
+	links.Result = resolved
+	return method, &links, nil
+}
+
+// formatDocumentLinks renders one `start-end  target  tooltip` line per
+// link, with 1-based `line:col` positions. Links still without a target
+// show `(unresolved)`.
+func formatDocumentLinks(links []DocumentLink) string {
+	if len(links) == 0 {
+		return "No links\n"
+	}
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, link := range links {
+		target := link.Target
+		if target == "" {
+			target = "(unresolved)"
+		}
+		start, end := link.Range.Start, link.Range.End
+		fmt.Fprintf(w, "%d:%d-%d:%d\t%s\t%s\n", start.Line+1, start.Character+1, end.Line+1, end.Character+1, target, link.Tooltip)
+	}
+	w.Flush()
+
+	return trimCellPadding(b.String())
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestResolveDocumentLinks(t *testing.T) {
+	params := map[string]any{"textDocument": TextDocumentIdentifier{URI: "file:///a.go"}}
+	resolvedLink := map[string]any{"range": map[string]any{}, "target": "https://pkg.go.dev/fmt"}
+	unresolvedLink := map[string]any{"range": map[string]any{}, "data": float64(7)}
+
+	tests := []struct {
+		name           string
+		links          *JSONRPCResponse
+		resolve        *JSONRPCResponse
+		expectedMethod string
+		expectedResult any
+		expectedSent   []string
+	}{
+		{
+			name:           "already resolved",
+			links:          &JSONRPCResponse{Result: []any{resolvedLink}},
+			expectedMethod: "textDocument/documentLink",
+			expectedResult: []any{resolvedLink},
+			expectedSent:   []string{"textDocument/documentLink"},
+		},
+		{
+			name:           "resolved individually",
+			links:          &JSONRPCResponse{Result: []any{resolvedLink, unresolvedLink}},
+			resolve:        &JSONRPCResponse{Result: map[string]any{"range": map[string]any{}, "target": "file:///b.go"}},
+			expectedMethod: "textDocument/documentLink",
+			expectedResult: []any{resolvedLink, map[string]any{"range": map[string]any{}, "target": "file:///b.go"}},
+			expectedSent:   []string{"textDocument/documentLink", "documentLink/resolve"},
+		},
+		{
+			name:           "null",
+			links:          &JSONRPCResponse{},
+			expectedMethod: "textDocument/documentLink",
+			expectedSent:   []string{"textDocument/documentLink"},
+		},
+		{
+			name:           "resolve error",
+			links:          &JSONRPCResponse{Result: []any{unresolvedLink}},
+			resolve:        &JSONRPCResponse{Error: &JSONRPCError{Code: -32601, Message: "not supported"}},
+			expectedMethod: "documentLink/resolve",
+			expectedSent:   []string{"textDocument/documentLink", "documentLink/resolve"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []string
+			send := func(method string, p any) (*JSONRPCResponse, error) {
+				sent = append(sent, method)
+				if method == "documentLink/resolve" {
+					if !reflect.DeepEqual(p, unresolvedLink) {
+						t.Errorf("Expected the unresolved link to be resolved, got %v", p)
+					}
+					return tt.resolve, nil
+				}
+				return tt.links, nil
+			}
+			method, response, err := resolveDocumentLinks(send, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if method != tt.expectedMethod {
+				t.Errorf("Expected method %s, got %s", tt.expectedMethod, method)
+			}
+			if !slices.Equal(sent, tt.expectedSent) {
+				t.Errorf("Expected requests %v, got %v", tt.expectedSent, sent)
+			}
+			if response.Error == nil && !reflect.DeepEqual(response.Result, tt.expectedResult) {
+				t.Errorf("Expected result %v, got %v", tt.expectedResult, response.Result)
+			}
+		})
+	}
+}
+
+func TestFormatDocumentLinks(t *testing.T) {
+	result := decodeResult(t, `[
+		{"range": {"start": {"line": 0, "character": 7}, "end": {"line": 0, "character": 12}}, "target": "https://pkg.go.dev/fmt", "tooltip": "Documentation"},
+		{"range": {"start": {"line": 2, "character": 0}, "end": {"line": 2, "character": 4}}}
+	]`)
+	links, ok := documentLinks(result)
+	if !ok {
+		t.Fatal("Expected document links")
+	}
+	expected := "1:8-1:13  https://pkg.go.dev/fmt  Documentation\n3:1-3:5   (unresolved)\n"
+	if got := formatDocumentLinks(links); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if got := formatDocumentLinks(nil); got != "No links\n" {
+		t.Errorf("Expected No links, got %q", got)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -9,15 +10,21 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
+	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 type JSONRPCRequest struct {
-	JSONRPC string `json:"jsonrpc"`
+	JSONRPC string `json:"jsonrpc,omitempty"` // empty only with -jsonrpc-version none
 	ID      *int   `json:"id,omitempty"`
 	Method  string `json:"method"`
 	Params  any    `json:"params,omitempty"`
@@ -29,31 +36,265 @@ type JSONRPCError struct {
 	Data    any    `json:"data,omitempty"`
 }
 
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("[%d] %s", e.Code, e.Message)
+}
+
+// errorCodeNames maps the JSON-RPC and LSP error codes to their names in
+// the specification.
+var errorCodeNames = map[int]string{
+	-32700: "ParseError",
+	-32600: "InvalidRequest",
+	-32601: "MethodNotFound",
+	-32602: "InvalidParams",
+	-32603: "InternalError",
+	-32002: "ServerNotInitialized",
+	-32001: "UnknownErrorCode",
+	-32803: "RequestFailed",
+	-32802: "ServerCancelled",
+	-32801: "ContentModified",
+	-32800: "RequestCancelled",
+}
+
+// errorCodeName returns the name of a standard error code, or "Unknown".
+func errorCodeName(code int) string {
+	if name, ok := errorCodeNames[code]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// RequestID is a JSON-RPC id as received from the server. The spec
+// allows numbers and strings, and some servers answer a numeric request
+// with the same id as a string, so both forms are kept.
+type RequestID struct {
+	num   int
+	str   string
+	isStr bool
+	null  bool
+}
+
+// NumericID returns the id n.
+func NumericID(n int) RequestID { return RequestID{num: n} }
+
+// StringID returns the id s.
+func StringID(s string) RequestID { return RequestID{str: s, isStr: true} }
+
+// Int returns the id as a number. A string id counts when it holds a
+// decimal number, so "7" matches request 7.
+func (id RequestID) Int() (int, bool) {
+	if id.null {
+		return 0, false
+	}
+	if !id.isStr {
+		return id.num, true
+	}
+	n, err := strconv.Atoi(id.str)
+	return n, err == nil
+}
+
+// Matches reports whether the id answers the request sent with id n.
+func (id RequestID) Matches(n int) bool {
+	got, ok := id.Int()
+	return ok && got == n
+}
+
+func (id RequestID) String() string {
+	switch {
+	case id.null:
+		return "null"
+	case id.isStr:
+		return strconv.Quote(id.str)
+	default:
+		return strconv.Itoa(id.num)
+	}
+}
+
+func (id RequestID) MarshalJSON() ([]byte, error) {
+	switch {
+	case id.null:
+		return []byte("null"), nil
+	case id.isStr:
+		return json.Marshal(id.str)
+	default:
+		return json.Marshal(id.num)
+	}
+}
+
+func (id *RequestID) UnmarshalJSON(data []byte) error {
+	switch {
+	case string(data) == "null":
+		*id = RequestID{null: true}
+	case len(data) > 0 && data[0] == '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*id = StringID(s)
+	default:
+		var n int
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("invalid JSON-RPC id %s: %w", data, err)
+		}
+		*id = NumericID(n)
+	}
+	return nil
+}
+
 type JSONRPCResponse struct {
 	JSONRPC string        `json:"jsonrpc"`
-	ID      int           `json:"id,omitempty"`
+	ID      RequestID     `json:"id"`
 	Result  any           `json:"result,omitempty"`
 	Error   *JSONRPCError `json:"error,omitempty"`
+
+	// Duration is the time from writing the request to receiving this
+	// response. It is measured by the client, not sent by the server.
+	Duration time.Duration `json:"-"`
 }
 
 type InitializeParams struct {
 	ProcessID    int            `json:"processId"`
 	RootURI      string         `json:"rootUri"`
+	RootPath     string         `json:"rootPath,omitempty"` // deprecated, but still read by some servers
+	Capabilities map[string]any `json:"capabilities"`
+
+	ClientInfo *ClientInfo `json:"clientInfo,omitempty"`
+
+	WorkspaceFolders []WorkspaceFolder `json:"workspaceFolders,omitempty"`
+
+	// InitializationOptions carries server-specific settings, such as
+	// gopls's build.directoryFilters. Left out entirely when unset.
+	InitializationOptions any `json:"initializationOptions,omitempty"`
+
+	Trace string `json:"trace,omitempty"` // "off", "messages" or "verbose"
+}
+
+// ClientInfo names the client to the server, which may log it or work
+// around known editor quirks based on it.
+type ClientInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// InitializeResult is the server's reply to initialize.
+type InitializeResult struct {
 	Capabilities map[string]any `json:"capabilities"`
+	ServerInfo   *ServerInfo    `json:"serverInfo,omitempty"`
+}
+
+type ServerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// ServerCapabilities returns the capabilities the server advertised in
+// its initialize response, or nil before Initialize has succeeded.
+func (c *LSPClient) ServerCapabilities() map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.initializeResult == nil {
+		return nil
+	}
+	return c.initializeResult.Capabilities
 }
 
+type WorkspaceFolder struct {
+	URI  string `json:"uri"`
+	Name string `json:"name"`
+}
+
+// LSPClient talks to one language server and is safe for concurrent use.
+// Requests take turns: each waits for its response before the next is
+// written. Notifications don't wait for that, so one can be sent while a
+// request is pending, such as a didChange during a slow request. Every
+// message is written as one whole frame, so concurrent messages never
+// interleave on the wire.
 type LSPClient struct {
-	cmd    *exec.Cmd
-	stdin  io.WriteCloser
-	stdout io.ReadCloser
-	stderr io.ReadCloser
-	reader *bufio.Reader
-	id     int
-	logger *slog.Logger
+	cmd        *exec.Cmd
+	transport  io.ReadWriteCloser
+	stderr     io.ReadCloser
+	stderrDone chan struct{} // closed once stderr has been read to EOF
+	stderrTail *lineTail     // the last lines of stderr, to explain a crash
+	exited     chan struct{} // closed once the subprocess has been reaped
+	waitErr    error         // what cmd.Wait returned; set before exited is closed
+	reader     *bufio.Reader
+	logger     *slog.Logger
+
+	recorder *recorder // set by -record
+
+	// framer delimits messages for transports with framing of their own,
+	// such as WebSocket; nil means Content-Length headers.
+	framer messageFramer
+
+	// jsonrpcVersion overrides the jsonrpc field of outgoing messages for
+	// nonconforming servers; see jsonrpcField.
+	jsonrpcVersion string
+
+	// skipExit makes Close leave out the exit notification, for servers
+	// that hang or crash on it (-no-exit).
+	skipExit bool
+
+	// dryRun clients only write frames; requests return a nil response.
+	dryRun bool
+
+	// maxMessageSize caps the Content-Length accepted from the server;
+	// 0 means defaultMaxMessageSize.
+	maxMessageSize int
+
+	// callMu serializes request/response round trips so concurrent callers
+	// never read each other's responses. It also guards inflight.
+	callMu   sync.Mutex
+	inflight chan readResult
+
+	// writeMu keeps the frames of concurrent writers, such as a
+	// notification sent during a request, from interleaving. It is held
+	// only while writing, never while waiting for a response.
+	writeMu sync.Mutex
+
+	mu                   sync.Mutex // guards id, handlers, pending, versions, texts, initializeResult and closed
+	closed               bool
+	id                   int
+	handlers             map[string]ServerRequestHandler
+	notificationHandlers map[string][]NotificationHandler
+	pending              map[int]*pendingRequest // requests written by WriteRequest, by ID
+	versions             map[string]int          // open document versions by URI
+	texts                map[string]string       // open document contents by URI
+	initializeResult     *InitializeResult
+}
+
+// ServerCommand describes how to start a server subprocess.
+type ServerCommand struct {
+	Path string
+	Args []string
+	Env  []string // KEY=VALUE pairs added to (or overriding) the inherited environment
+	Dir  string   // working directory; empty means clsp's own
+}
+
+// newServerCmd builds the exec.Cmd for server without starting it.
+func newServerCmd(ctx context.Context, server ServerCommand) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, server.Path, server.Args...)
+	if len(server.Env) > 0 {
+		// exec uses the last value of duplicate keys, so appending
+		// overrides inherited variables.
+		cmd.Env = append(os.Environ(), server.Env...)
+	}
+	cmd.Dir = server.Dir
+	detachProcessGroup(cmd)
+	return cmd
 }
 
-func NewLSPClient(ctx context.Context, command string, args []string, logger *slog.Logger) (*LSPClient, error) {
-	cmd := exec.CommandContext(ctx, command, args...)
+func NewLSPClient(ctx context.Context, server ServerCommand, logger *slog.Logger) (*LSPClient, error) {
+	if server.Dir != "" {
+		info, err := os.Stat(server.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server working directory: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("invalid server working directory: %s is not a directory", server.Dir)
+		}
+	}
+
+	cmd := newServerCmd(ctx, server)
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, err
@@ -71,47 +312,181 @@ func NewLSPClient(ctx context.Context, command string, args []string, logger *sl
 		return nil, err
 	}
 
+	transport := &stdioTransport{stdin: stdin, stdout: stdout}
+	client := &LSPClient{
+		cmd:        cmd,
+		transport:  transport,
+		stderr:     stderr,
+		stderrDone: make(chan struct{}),
+		stderrTail: &lineTail{n: stderrTailLines},
+		exited:     make(chan struct{}),
+		reader:     bufio.NewReader(transport),
+		id:         1,
+		logger:     logger,
+	}
+	go client.forwardStderr()
+	go client.waitProcess()
+	return client, nil
+}
+
+// forwardStderr logs every line the server writes to stderr. Reading
+// continuously also keeps the server from blocking on a full pipe.
+func (c *LSPClient) forwardStderr() {
+	defer close(c.stderrDone)
+	reader := bufio.NewReader(c.stderr)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			c.logger.Debug("Server output", "server-stderr", line)
+			if c.stderrTail != nil {
+				c.stderrTail.add(line)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// NewLSPClientTCP connects to an LSP server that is already listening on
+// address (host:port) instead of spawning a subprocess.
+func NewLSPClientTCP(ctx context.Context, address string, logger *slog.Logger) (*LSPClient, error) {
+	return dialLSPClient(ctx, "tcp", address, logger)
+}
+
+// NewLSPClientUnix connects to an LSP server listening on the Unix domain
+// socket at path.
+func NewLSPClientUnix(ctx context.Context, path string, logger *slog.Logger) (*LSPClient, error) {
+	return dialLSPClient(ctx, "unix", path, logger)
+}
+
+// NewDryRunClient returns a client that writes every frame to w instead
+// of a server and never reads a reply. SendRequest and SendBatch return
+// nil responses.
+func NewDryRunClient(w io.Writer, logger *slog.Logger) *LSPClient {
+	transport := &dryRunTransport{w: w}
+	return &LSPClient{
+		transport: transport,
+		reader:    bufio.NewReader(transport),
+		id:        1,
+		logger:    logger,
+		dryRun:    true,
+	}
+}
+
+func dialLSPClient(ctx context.Context, network, address string, logger *slog.Logger) (*LSPClient, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
 	return &LSPClient{
-		cmd:    cmd,
-		stdin:  stdin,
-		stdout: stdout,
-		stderr: stderr,
-		reader: bufio.NewReader(stdout),
-		id:     1,
-		logger: logger,
+		transport: conn,
+		reader:    bufio.NewReader(conn),
+		id:        1,
+		logger:    logger,
 	}, nil
 }
 
-func (c *LSPClient) SendRequest(ctx context.Context, method string, params any) (*JSONRPCResponse, error) {
+// omitJSONRPCVersion as the -jsonrpc-version leaves the jsonrpc field out.
+const omitJSONRPCVersion = "none"
+
+// jsonrpcField returns the value of the jsonrpc field of outgoing
+// messages: "2.0" unless overridden, and "" (omitted) for "none".
+func (c *LSPClient) jsonrpcField() string {
+	switch c.jsonrpcVersion {
+	case "":
+		return "2.0"
+	case omitJSONRPCVersion:
+		return ""
+	default:
+		return c.jsonrpcVersion
+	}
+}
+
+// nextID returns a fresh request ID.
+func (c *LSPClient) nextID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	id := c.id
 	c.id++
+	return id
+}
+
+// NextID returns the id the next request will get.
+func (c *LSPClient) NextID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.id
+}
+
+// SendRequest sends a request and waits for its response. It is safe for
+// concurrent use: every call gets a unique ID and calls are serialized so
+// each one reads its own response.
+func (c *LSPClient) SendRequest(ctx context.Context, method string, params any) (*JSONRPCResponse, error) {
+	c.callMu.Lock()
+	defer c.callMu.Unlock()
+
+	id := c.nextID()
+	if err := c.writeRequest(id, method, params); err != nil {
+		return nil, err
+	}
+	if c.dryRun {
+		return nil, nil
+	}
+
+	start := time.Now()
+	response, err := c.ReadResponse(ctx, id)
+	if err != nil {
+		if ctx.Err() != nil {
+			c.cancelRequest(id)
+		}
+		return nil, err
+	}
+	response.Duration = time.Since(start)
+	return response, nil
+}
+
+// writeRequest writes a request with the given ID.
+func (c *LSPClient) writeRequest(id int, method string, params any) error {
 	request := JSONRPCRequest{
-		JSONRPC: "2.0",
+		JSONRPC: c.jsonrpcField(),
 		ID:      &id,
 		Method:  method,
 		Params:  params,
 	}
 
-	c.logger.Debug("Sending LSP request", "method", method, "id", *request.ID)
+	c.logger.Debug("Sending LSP request", "method", method, "id", id)
 
 	requestBytes, err := json.Marshal(request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	content := string(requestBytes)
-	header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(content))
-
-	if _, err := c.stdin.Write([]byte(header + content)); err != nil {
-		return nil, fmt.Errorf("failed to write request: %w", err)
+	if err := c.writeFrame(requestBytes); err != nil {
+		return fmt.Errorf("failed to write request: %w", err)
 	}
+	return nil
+}
 
-	return c.ReadResponse(ctx, *request.ID)
+type CancelParams struct {
+	ID int `json:"id"`
+}
+
+// cancelRequest tells the server that the client stopped waiting for id so
+// it can abandon the work. Failures are only logged since the caller is
+// already returning an error.
+func (c *LSPClient) cancelRequest(id int) {
+	c.logger.Debug("Cancelling LSP request", "id", id)
+	if err := c.SendNotification("$/cancelRequest", CancelParams{ID: id}); err != nil {
+		c.logger.Warn("Failed to send $/cancelRequest", "id", id, "error", err)
+	}
 }
 
 func (c *LSPClient) SendNotification(method string, params any) error {
 	request := JSONRPCRequest{
-		JSONRPC: "2.0",
+		JSONRPC: c.jsonrpcField(),
 		Method:  method,
 		Params:  params,
 	}
@@ -123,115 +498,280 @@ func (c *LSPClient) SendNotification(method string, params any) error {
 		return fmt.Errorf("failed to marshal notification: %w", err)
 	}
 
-	content := string(requestBytes)
-	header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(content))
-
-	if _, err := c.stdin.Write([]byte(header + content)); err != nil {
+	if err := c.writeFrame(requestBytes); err != nil {
 		return fmt.Errorf("failed to write notification: %w", err)
 	}
 
 	return nil
 }
 
+// writeFrame writes body to the transport preceded by its Content-Length
+// header. Frames are written one at a time, and recorded in the order they
+// are written.
+func (c *LSPClient) writeFrame(body []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.record("send", body)
+	if c.framer != nil {
+		return c.framer.WriteMessage(body)
+	}
+	header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(body))
+	_, err := c.transport.Write([]byte(header + string(body)))
+	return err
+}
+
 func (c *LSPClient) ReadResponse(ctx context.Context, expectedID int) (*JSONRPCResponse, error) {
 	for {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
+		content, err := c.readMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			return nil, c.explainExit(err)
 		}
 
-		// Read one message
-		var contentLength int
-		for {
-			line, err := c.reader.ReadString('\n')
-			if err != nil {
-				return nil, fmt.Errorf("failed to read header line: %w", err)
-			}
+		response, err := c.dispatch(content)
+		if err != nil {
+			return nil, err
+		}
+		if response == nil {
+			continue // Server requests and notifications are handled by dispatch
+		}
 
-			line = strings.TrimSpace(line)
-			if line == "" {
-				break
-			}
+		c.logger.Debug("Received LSP message", "id", response.ID, "hasResult", response.Result != nil, "hasError", response.Error != nil, "expectedID", expectedID)
 
-			if s, ok := strings.CutPrefix(line, "Content-Length:"); ok {
-				lengthStr := strings.TrimSpace(s)
-				contentLength, err = strconv.Atoi(lengthStr)
-				if err != nil {
-					return nil, fmt.Errorf("invalid Content-Length header: %w", err)
-				}
-			}
+		// Check if this is the response we're waiting for
+		if response.ID.Matches(expectedID) {
+			return response, nil
 		}
 
-		if contentLength == 0 {
-			return nil, errors.New("no Content-Length header found")
+		c.logger.Debug("Received unexpected response ID, continuing to read", "received", response.ID, "expected", expectedID)
+	}
+}
+
+// incomingMessage is any message sent by the server, decoded once and then
+// classified: a method makes it a request (with an ID) or a notification
+// (without), and anything else is a response.
+type incomingMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Result  any             `json:"result"`
+	Error   *JSONRPCError   `json:"error"`
+}
+
+// dispatch handles a message sent by the server. Requests are answered and
+// notifications are passed to their handlers; for responses it returns the
+// decoded response for the caller to correlate, except those to requests
+// written by WriteRequest, which are kept for ReadResponseByID.
+func (c *LSPClient) dispatch(content []byte) (*JSONRPCResponse, error) {
+	response, _, err := c.dispatchMessage(content)
+	return response, err
+}
+
+// dispatchMessage is dispatch that also returns the notification the
+// message was, if it was one.
+func (c *LSPClient) dispatchMessage(content []byte) (*JSONRPCResponse, *Notification, error) {
+	var msg incomingMessage
+	if err := json.Unmarshal(content, &msg); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+
+	if msg.Method != "" {
+		if msg.ID != nil {
+			c.logger.Debug("Received LSP server request", "method", msg.Method, "id", string(msg.ID))
+			return nil, nil, c.replyToServerRequest(msg.ID, msg.Method, msg.Params)
 		}
+		c.logger.Debug("Received LSP notification", "method", msg.Method)
+		c.notify(msg.Method, msg.Params)
+		return nil, &Notification{Method: msg.Method, Params: msg.Params}, nil
+	}
 
-		content := make([]byte, contentLength)
-		_, err := io.ReadFull(c.reader, content)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response content: %w", err)
+	response := &JSONRPCResponse{JSONRPC: msg.JSONRPC, Result: msg.Result, Error: msg.Error}
+	if msg.ID != nil {
+		if err := json.Unmarshal(msg.ID, &response.ID); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal response: %w", err)
 		}
+	}
+	if c.settle(response) {
+		return nil, nil, nil // kept for ReadResponseByID
+	}
+	return response, nil, nil
+}
+
+// readResult is the outcome of reading one framed message.
+type readResult struct {
+	content []byte
+	err     error
+}
+
+// readMessage reads the next message, giving up when ctx is done, even if
+// the server stalls in the middle of the headers or the body. The read
+// itself runs in a goroutine; if ctx ends first it is left in flight and its
+// result is returned by the next call, so no message is lost.
+func (c *LSPClient) readMessage(ctx context.Context) ([]byte, error) {
+	if c.inflight == nil {
+		ch := make(chan readResult, 1)
+		go func() {
+			content, err := c.readFrame()
+			ch <- readResult{content: content, err: err}
+		}()
+		c.inflight = ch
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-c.inflight:
+		c.inflight = nil
+		return result.content, result.err
+	}
+}
+
+// defaultMaxMessageSize is the largest message body read from a server
+// unless -max-message-size says otherwise.
+const defaultMaxMessageSize = 8 << 20
+
+// messageLimit is the largest message body accepted from the server.
+func (c *LSPClient) messageLimit() int {
+	if c.maxMessageSize <= 0 {
+		return defaultMaxMessageSize
+	}
+	return c.maxMessageSize
+}
 
-		var response JSONRPCResponse
-		if err := json.Unmarshal(content, &response); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+// readFrame reads one Content-Length framed message body, or one message
+// from the framer when the transport has its own framing.
+func (c *LSPClient) readFrame() ([]byte, error) {
+	if c.framer != nil {
+		content, err := c.framer.ReadMessage(c.messageLimit())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read message: %w", err)
 		}
+		c.record("recv", content)
+		return content, nil
+	}
 
-		c.logger.Debug("Received LSP message", "id", response.ID, "hasResult", response.Result != nil, "hasError", response.Error != nil, "expectedID", expectedID)
+	var contentLength int
+	var charsetErr error
+	sawHeader := false
+	for {
+		// Minimal servers may also leave out the blank line ending the
+		// headers. A JSON body can't start a header line, so stop at it
+		// rather than reading it as one.
+		if sawHeader {
+			if next, err := c.reader.Peek(1); err == nil && (next[0] == '{' || next[0] == '[') {
+				break
+			}
+		}
 
-		// Check if this is a notification (ID = 0 and has Method field)
-		var notification struct {
-			Method string `json:"method"`
+		// ReadString keeps reading across buffer boundaries, so a \r\n
+		// split between two reads still arrives as one line.
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read header line: %w", err)
 		}
-		json.Unmarshal(content, &notification)
 
-		if notification.Method != "" {
-			c.logger.Debug("Received LSP notification", "method", notification.Method)
-			continue // Skip notifications and keep reading
+		// Some servers emit blank lines between messages. They can't end
+		// a header section that hasn't started yet.
+		if !sawHeader && strings.TrimSpace(line) == "" {
+			continue
 		}
+		// The spec terminates lines with \r\n, but minimal servers use
+		// a bare \n, so the headers end at either "\r\n\r\n" or "\n\n".
+		header := strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if header == "" {
+			break
+		}
+		sawHeader = true
 
-		// Check if this is the response we're waiting for
-		if response.ID == expectedID {
-			return &response, nil
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed header line %q", header)
 		}
+		value = strings.TrimSpace(value)
+		switch {
+		case strings.EqualFold(name, "Content-Length"):
+			contentLength, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length header: %w", err)
+			}
+		case strings.EqualFold(name, "Content-Type"):
+			charsetErr = checkContentType(value)
+		}
+	}
 
-		c.logger.Debug("Received unexpected response ID, continuing to read", "received", response.ID, "expected", expectedID)
+	if contentLength == 0 {
+		return nil, errors.New("no Content-Length header found")
+	}
+	// Check before allocating: a bogus length must not turn into a
+	// multi-gigabyte buffer. The stream cannot be resynchronized after this.
+	limit := c.messageLimit()
+	if contentLength < 0 || contentLength > limit {
+		return nil, fmt.Errorf("invalid Content-Length %d: message size limit is %d bytes (see -max-message-size)", contentLength, limit)
+	}
+
+	content := make([]byte, contentLength)
+	_, err := io.ReadFull(c.reader, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response content: %w", err)
+	}
+
+	c.record("recv", content)
+
+	// The body has been consumed either way, so the stream stays in sync
+	// even when the message itself is rejected.
+	if charsetErr != nil {
+		return nil, charsetErr
 	}
+	return content, nil
 }
 
-func (c *LSPClient) Initialize(ctx context.Context, rootURI string) error {
-	params := InitializeParams{
-		ProcessID: os.Getpid(),
-		RootURI:   rootURI,
-		Capabilities: map[string]any{
-			"textDocument": map[string]any{
-				"completion": map[string]any{
-					"completionItem": map[string]any{
-						"snippetSupport": true,
-					},
-				},
-				"hover": map[string]any{
-					"contentFormat": []string{"markdown", "plaintext"},
-				},
-				"documentSymbol":  map[string]any{},
-				"workspaceSymbol": map[string]any{},
-			},
-			"workspace": map[string]any{
-				"symbol": map[string]any{},
-			},
-		},
+// checkContentType validates a Content-Type header value. Only UTF-8 is
+// supported; "utf8" is accepted too because the spec allows it for
+// backwards compatibility. A missing charset means UTF-8.
+func checkContentType(value string) error {
+	_, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type header %q: %w", value, err)
+	}
+	switch charset := strings.ToLower(params["charset"]); charset {
+	case "", "utf-8", "utf8":
+		return nil
+	default:
+		return fmt.Errorf("unsupported charset %q in Content-Type header (only utf-8 is supported)", charset)
 	}
+}
+
+// newInitializeParams returns the default initialize params for rootURI.
+func newInitializeParams(rootURI string) InitializeParams {
+	return InitializeParams{
+		ProcessID:    os.Getpid(),
+		RootURI:      rootURI,
+		Capabilities: defaultClientCapabilities(),
+		ClientInfo:   &ClientInfo{Name: "clsp", Version: clientVersion(buildInfo())},
+	}
+}
 
+func (c *LSPClient) Initialize(ctx context.Context, params InitializeParams) error {
 	response, err := c.SendRequest(ctx, "initialize", params)
 	if err != nil {
 		return fmt.Errorf("failed to send initialize request: %w", err)
 	}
 
 	if response.Error != nil {
-		return fmt.Errorf("LSP initialize error [%d]: %s", response.Error.Code, response.Error.Message)
+		return fmt.Errorf("LSP initialize error %w", response.Error)
 	}
 
+	var result InitializeResult
+	if data, err := json.Marshal(response.Result); err == nil {
+		json.Unmarshal(data, &result)
+	}
+	c.mu.Lock()
+	c.initializeResult = &result
+	c.mu.Unlock()
+
 	// Send initialized notification (no response expected)
 	if err := c.SendNotification("initialized", map[string]any{}); err != nil {
 		return fmt.Errorf("failed to send initialized notification: %w", err)
@@ -239,157 +779,1272 @@ func (c *LSPClient) Initialize(ctx context.Context, rootURI string) error {
 	return nil
 }
 
+// markClosed records that the client is being closed and reports whether
+// it already was.
+func (c *LSPClient) markClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wasClosed := c.closed
+	c.closed = true
+	return wasClosed
+}
+
+// Close shuts the server down with the shutdown/exit sequence and waits for
+// the process to exit. Calling it again, or after Abort, does nothing.
 func (c *LSPClient) Close() error {
+	if c.markClosed() || c.dryRun {
+		return nil
+	}
+	// A server that already exited can't be shut down; Wait has closed
+	// its pipes too.
+	if c.hasExited() {
+		return c.waitErr
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	c.SendRequest(ctx, "shutdown", nil)
-	c.SendNotification("exit", nil)
+	// exit must not overtake the shutdown reply; SendRequest blocks until
+	// it arrives or the timeout expires. Either way we go on to exit so a
+	// misbehaving server can't hang us.
+	response, err := c.SendRequest(ctx, "shutdown", nil)
+	shutdownOK := false
+	switch {
+	case err != nil:
+		c.logger.Warn("Shutdown request failed", "error", err)
+	case response.Error != nil:
+		c.logger.Warn("Server returned an error for shutdown", "error", response.Error)
+	default:
+		shutdownOK = true
+	}
+	if !c.skipExit {
+		c.SendNotification("exit", nil)
+	}
+
+	// Network transports have no process to wait for.
+	if c.cmd == nil {
+		return c.transport.Close()
+	}
+
+	if err := c.transport.Close(); err != nil {
+		c.logger.Warn("Failed to close transport", "error", err)
+	}
+
+	if c.skipExit {
+		return c.waitWithoutExit()
+	}
+	if !c.waitExited(closeWaitTimeout) {
+		return fmt.Errorf("server did not exit within %v of the exit notification and was killed", closeWaitTimeout)
+	}
+	return checkExit(shutdownOK, c.waitErr)
+}
+
+// writeJSONLine writes v as a single line of compact JSON. json.Marshal
+// escapes newlines inside strings, so the line never breaks, and the whole
+// line goes out in one write so consumers reading a pipe see it immediately.
+func writeJSONLine(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// newLogger returns a logger writing to w in the given format.
+func newLogger(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+}
 
-	if err := c.stdin.Close(); err != nil {
-		c.logger.Warn("Failed to close stdin", "error", err)
+// Abort drops the connection without the shutdown handshake, killing the
+// server process if clsp started it. It is meant for servers that stopped
+// responding.
+func (c *LSPClient) Abort() error {
+	if c.markClosed() {
+		return nil
 	}
-	if err := c.stdout.Close(); err != nil {
-		c.logger.Warn("Failed to close stdout", "error", err)
+	if c.hasExited() {
+		return nil
 	}
-	if err := c.stderr.Close(); err != nil {
-		c.logger.Warn("Failed to close stderr", "error", err)
+
+	err := c.transport.Close()
+	if c.cmd == nil {
+		return err
 	}
 
-	return c.cmd.Wait()
+	c.kill()
+	<-c.exited // waitErr reports the kill
+	return err
 }
 
-func printJSON(v any) {
+// printJSON pretty-prints v, with ANSI colors when color is set.
+func printJSON(v any, color bool) {
 	data, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
 		fmt.Printf("Error marshaling JSON: %v\n", err)
 		return
 	}
+	if color {
+		fmt.Println(colorizeJSON(string(data)))
+		return
+	}
 	fmt.Println(string(data))
 }
 
-func printResponse(method string, response *JSONRPCResponse, format string, quiet bool) {
-	switch format {
-	case "json":
-		data, _ := json.Marshal(response)
-		fmt.Println(string(data))
-	case "raw":
-		if response.Result != nil {
-			data, _ := json.Marshal(response.Result)
-			fmt.Println(string(data))
-		} else if response.Error != nil {
-			data, _ := json.Marshal(response.Error)
-			fmt.Println(string(data))
-		}
+// outputOptions controls how responses are printed.
+type outputOptions struct {
+	format      string // pretty, json, ndjson, raw, text, completion, diagnostics, references, diff, signature or tokens
+	quiet       bool
+	render      bool   // print hover markdown as text in pretty format
+	stripFences bool   // drop markdown code fences when rendering
+	flatSymbols bool   // print documentSymbol results as an indented list
+	callList    bool   // print call hierarchy calls as a list
+	linkList    bool   // print document links as a list
+	echoID      bool   // show the response id in pretty headers
+	countOnly   bool   // print only the number of entries in the result
+	selectPath  string // print only this part of the result
+	timing      bool   // report how long each request took
+	color       bool   // colorize JSON in pretty format
+	root        string // directory file paths are shown relative to
+	limit       int    // print only the first limit entries of array results
+
+	// documentURI is the document the request is about, and documentText
+	// returns a document's content; the diff format needs both.
+	documentURI  string
+	documentText func(uri string) (string, bool)
+
+	// tokenLegend returns the server's semantic tokens legend, which the
+	// tokens format decodes with.
+	tokenLegend func() (SemanticTokensLegend, bool)
+	// positionEncoding returns the position encoding the server chose,
+	// which edits, tokens and signature label offsets are in.
+	positionEncoding func() string
+}
+
+// encoding returns the server's position encoding, or UTF-16 when there
+// is no server to ask.
+func (o outputOptions) encoding() string {
+	if o.positionEncoding == nil {
+		return encodingUTF16
+	}
+	return o.positionEncoding()
+}
+
+// timedResponse is a response printed together with its duration.
+type timedResponse struct {
+	*JSONRPCResponse
+	DurationMs float64 `json:"durationMs"`
+}
+
+// namedError is how pretty format prints an error: the code's name goes
+// next to the number.
+type namedError struct {
+	*JSONRPCError
+	CodeName string `json:"codeName"`
+}
+
+func newNamedError(e *JSONRPCError) *namedError {
+	return &namedError{JSONRPCError: e, CodeName: errorCodeName(e.Code)}
+}
+
+// withErrorName swaps the error in envelope for a namedError. The outer
+// Error field shadows the embedded one when marshaling.
+func withErrorName(envelope any, e *JSONRPCError) any {
+	switch v := envelope.(type) {
+	case timedResponse:
+		return struct {
+			timedResponse
+			Error *namedError `json:"error"`
+		}{v, newNamedError(e)}
+	case *JSONRPCResponse:
+		return struct {
+			*JSONRPCResponse
+			Error *namedError `json:"error"`
+		}{v, newNamedError(e)}
+	}
+	return envelope
+}
+
+func printCapabilities(capabilities map[string]any, opts outputOptions) {
+	switch opts.format {
+	case "json", "ndjson", "raw":
+		writeJSONLine(os.Stdout, capabilities)
 	default: // pretty
-		if quiet {
-			if response.Result != nil {
-				printJSON(response.Result)
-			} else if response.Error != nil {
-				printJSON(response.Error)
-			}
+		if !opts.quiet {
+			fmt.Println("Server capabilities:")
+		}
+		printJSON(capabilities, opts.color)
+	}
+}
+
+// printSelected prints a value picked by -select. Strings are printed as
+// plain text except in the json formats.
+func printSelected(v any, opts outputOptions) {
+	switch opts.format {
+	case "json", "ndjson":
+		writeJSONLine(os.Stdout, v)
+	default:
+		if text, ok := v.(string); ok {
+			fmt.Println(text)
+		} else if opts.format == "raw" {
+			writeJSONLine(os.Stdout, v)
 		} else {
-			fmt.Printf("Response for %s:\n", method)
-			printJSON(response)
+			printJSON(v, opts.color)
 		}
 	}
 }
 
-func printUsage() {
+// printResponse prints response in the chosen format. It fails when
+// -select names a part of the result that doesn't exist, or when the diff
+// format can't apply the returned edits.
+func printResponse(method string, response *JSONRPCResponse, opts outputOptions) error {
+	if opts.timing {
+		fmt.Fprintf(os.Stderr, "%s took %v\n", method, response.Duration.Round(time.Microsecond))
+	}
+
+	// header names the response in pretty output, with its id when
+	// -echo-id asks for it.
+	header := method
+	if opts.echoID {
+		header = fmt.Sprintf("%s [id=%s]", method, response.ID)
+	}
+
+	if opts.countOnly && response.Error == nil {
+		result := response.Result
+		if opts.selectPath != "" {
+			selected, err := selectPath(result, opts.selectPath)
+			if err != nil {
+				return err
+			}
+			result = selected
+		}
+		count, ok := resultCount(result)
+		if symbols, isSymbols := flattenSymbols(result); opts.flatSymbols && isSymbols {
+			count, ok = len(symbols), true
+		}
+		if !ok {
+			return fmt.Errorf("cannot count the %s result: it is not a list", method)
+		}
+		fmt.Println(count)
+		return nil
+	}
+
+	if opts.selectPath != "" && response.Error == nil {
+		selected, err := selectPath(response.Result, opts.selectPath)
+		if err != nil {
+			return err
+		}
+		selected, omitted := limitResult(selected, opts.limit)
+		printSelected(selected, opts)
+		printOmitted(omitted, opts)
+		return nil
+	}
+	if opts.selectPath != "" && selectsError(opts.selectPath) {
+		selected, err := selectPath(errorResponseValue(response.Error), opts.selectPath)
+		if err != nil {
+			return err
+		}
+		printSelected(selected, opts)
+		return nil
+	}
+
+	if response.Error == nil {
+		for _, format := range opts.formats() {
+			f, ok := formatterFor(format, method)
+			if !ok {
+				continue
+			}
+			var b bytes.Buffer
+			out, err := f(response.Result, &b, opts)
+			if errors.Is(err, errUnformattable) {
+				continue // anything else prints as usual
+			}
+			if err != nil {
+				return err
+			}
+			if !opts.quiet {
+				if out.summary != "" {
+					fmt.Printf("Response for %s: %s\n", header, out.summary)
+				} else {
+					fmt.Printf("Response for %s:\n", header)
+				}
+			}
+			os.Stdout.Write(b.Bytes())
+			printOmitted(out.omitted, opts)
+			return nil
+		}
+	}
+
+	if opts.limit > 0 {
+		limited := *response
+		var omitted int
+		limited.Result, omitted = limitResult(response.Result, opts.limit)
+		response = &limited
+		defer printOmitted(omitted, opts)
+	}
+
+	var envelope any = response
+	if opts.timing {
+		envelope = timedResponse{JSONRPCResponse: response, DurationMs: float64(response.Duration) / float64(time.Millisecond)}
+	}
+
+	switch opts.format {
+	case "json":
+		data, _ := json.Marshal(envelope)
+		fmt.Println(string(data))
+	case "ndjson":
+		writeJSONLine(os.Stdout, envelope)
+	case "raw":
+		if response.Result != nil {
+			data, _ := json.Marshal(response.Result)
+			fmt.Println(string(data))
+		} else if response.Error != nil {
+			data, _ := json.Marshal(response.Error)
+			fmt.Println(string(data))
+		}
+	default: // pretty
+		if opts.quiet {
+			if response.Result != nil {
+				printJSON(response.Result, opts.color)
+			} else if response.Error != nil {
+				printJSON(newNamedError(response.Error), opts.color)
+			}
+		} else {
+			fmt.Printf("Response for %s:\n", header)
+			if response.Error != nil {
+				envelope = withErrorName(envelope, response.Error)
+			}
+			printJSON(envelope, opts.color)
+		}
+		if response.Error != nil && response.Error.Data != nil {
+			fmt.Println("Error data:")
+			fmt.Println(formatErrorData(response.Error.Data, opts.color))
+		}
+	}
+	return nil
+}
+
+// formatErrorData renders the data of an error response, which often
+// holds the real cause. Strings, such as stack traces, are printed as
+// text so their line breaks show; other values as indented JSON.
+func formatErrorData(data any, color bool) string {
+	if text, ok := data.(string); ok {
+		return strings.TrimRight(text, "\n")
+	}
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Sprint(data)
+	}
+	if color {
+		return colorizeJSON(string(out))
+	}
+	return string(out)
+}
+
+func printUsage() {
 	fmt.Println("Usage: clsp -server <command> -method <method> [options]")
+	fmt.Println("       clsp -connect <host:port> -method <method> [options]")
+	fmt.Println("       clsp -socket <path> -method <method> [options]")
+	fmt.Println("       clsp -ws <url> -method <method> [options]")
 	fmt.Println("\nRequired:")
-	fmt.Println("  -server <cmd>     LSP server command (e.g., gopls, clangd, pylsp)")
-	fmt.Println("  -method <method>  LSP method to call")
+	fmt.Println("  -server <cmd>     LSP server command (e.g., gopls, clangd, pylsp), or \"server\" in .clsp.json")
+	fmt.Println("  -method <method>  LSP method to call (or -script)")
 	fmt.Println("\nOptions:")
+	fmt.Println("  -config <file>       Project config (default: nearest .clsp.json upwards)")
+	fmt.Println("  -cwd <dir>           Working directory for the server (default: -root if given)")
+	fmt.Println("  -env <KEY=VALUE>     Set an environment variable for the server (repeatable)")
+	fmt.Println("  -connect <addr>      Connect to a running server over TCP instead of -server")
+	fmt.Println("  -socket <path>       Connect to a running server over a Unix socket instead of -server")
+	fmt.Println("  -ws <url>            Connect to a running server over WebSocket (ws:// or wss://) instead of -server")
 	fmt.Println("  -args <args>         Server arguments (comma-separated)")
-	fmt.Println("  -params <json>       JSON parameters for the method")
+	fmt.Println("  -arg <arg>           Server argument, may contain commas (repeatable, after -args)")
+	fmt.Println("  -params <json>       JSON parameters for the method, or a batch of {method, params} entries")
 	fmt.Println("  -params-file <file>  Read parameters from JSON file")
-	fmt.Println("  -root <uri>          Root URI for initialization")
+	fmt.Println("  -params-template <file>")
+	fmt.Println("                       Read parameters from JSON with ${file}, ${line}, ${character} and -var placeholders")
+	fmt.Println("                       (${character} is the byte column, not converted to the server's position encoding)")
+	fmt.Println("  -var <KEY=VALUE>     Value for a ${KEY} placeholder in -params-template (repeatable)")
+	fmt.Println("  -script <file>       Run one \"<method> [params JSON]\" per line in order")
+	fmt.Println("  -file <path>         Build textDocument (and position) params for file")
+	fmt.Println("  -line <n>            Zero-based line for -file")
+	fmt.Println("  -character <n>       Zero-based byte column for -file (default: 0)")
+	fmt.Println("  -range <range>       Add a 1-based startLine:startCol-endLine:endCol range to the -file params")
+	fmt.Println("  -pos <file:line:col> Like -file with -line/-character, but 1-based as editors show it")
+	fmt.Println("                       (repeatable: run -method at each, opening each file once)")
+	fmt.Println("  -apply               Apply a WorkspaceEdit result (rename, code action) to the files on disk")
+	fmt.Println("  -pos-stdin           Run -method at each file:line:col read from stdin (grep -n, rg --vimgrep output)")
+	fmt.Println("  -command <name>      Run a server command with workspace/executeCommand (no -method needed)")
+	fmt.Println("  -command-arg <json>  Argument for -command, JSON or a plain string (repeatable)")
+	fmt.Println("  -call-hierarchy <incoming|outgoing>")
+	fmt.Println("                       Print the callers or callees of the function at -file/-pos (no -method needed)")
+	fmt.Println("  -resolve-links       Print the document links of -file, resolving those without a target")
+	fmt.Println("  -rename <name>       Rename the symbol at -file/-pos after checking with prepareRename (no -method needed)")
+	fmt.Println("  -root <uri|dir>      Root URI or directory for initialization")
+	fmt.Println("  -workspace-folder <uri|dir>[=name]")
+	fmt.Println("                       Add a workspace folder (repeatable)")
+	fmt.Println("  -open <file>         Send textDocument/didOpen for file first (repeatable)")
+	fmt.Println("  -stdin-content <uri|path>")
+	fmt.Println("                       Open a document with this URI whose text is read from stdin (need not exist)")
+	fmt.Println("  -language-id <id>    languageId for -stdin-content (default: from the extension)")
+	fmt.Println("  -close <file>        Send textDocument/didClose for an -open file after the request (repeatable)")
+	fmt.Println("  -lifecycle           didOpen the -file/-pos document, run the request, then didClose")
+	fmt.Println("  -change <json>       Send textDocument/didChange for the last -open file (repeatable)")
+	fmt.Println("  -changed-file <path>:<created|changed|deleted>")
+	fmt.Println("                       Report the file event with workspace/didChangeWatchedFiles (repeatable)")
 	fmt.Println("  -skip-init           Skip LSP initialization")
-	fmt.Println("  -timeout <duration>  Request timeout (default: 30s)")
-	fmt.Println("  -format <fmt>        Output format: pretty, json, raw (default: pretty)")
+	fmt.Println("  -strict-skip-init    Don't initialize a -skip-init server that answers ServerNotInitialized")
+	fmt.Println("  -show-capabilities   Print the server's capabilities and exit (no -method needed)")
+	fmt.Println("  -record <file>       Append a JSONL transcript of all messages to file")
+	fmt.Println("  -replay <file>       Use the server messages of a -record transcript instead of a server")
+	fmt.Println("  -start-id <n>        ID of the first request (default: 1); the next unused ID is logged at exit")
+	fmt.Println("  -jsonrpc-version <v> \"jsonrpc\" field value to send, or \"none\" to omit it (default: 2.0)")
+	fmt.Println("  -no-exit             Don't send the exit notification after shutdown; close the pipes instead")
+	fmt.Println("  -dry-run             Print the framed messages to stdout instead of sending them (implies -skip-init)")
+	fmt.Println("  -init-retries <n>    Attempt initialization up to n times (default: 1)")
+	fmt.Println("  -auto-restart        Restart a server that goes away mid-request and retry once")
+	fmt.Println("  -init-options <json> initializationOptions for the initialize request")
+	fmt.Println("  -init-options-file <file>")
+	fmt.Println("                       Read initializationOptions from a JSON file")
+	fmt.Println("  -clangd-compile-commands <dir>")
+	fmt.Println("                       Point clangd at the compile_commands.json in dir")
+	fmt.Println("  -client-name <name>  clientInfo name sent on initialize (default: clsp)")
+	fmt.Println("  -client-version <v>  clientInfo version sent on initialize (default: the build version)")
+	fmt.Println("  -caps <list>         Advertise only these capabilities, e.g. hover,definition (or none)")
+	fmt.Println("  -capabilities-file <file>")
+	fmt.Println("                       Read client capabilities from a JSON file")
+	fmt.Println("  -capabilities-mode <mode>")
+	fmt.Println("                       merge (default) into or replace the default capabilities")
+	fmt.Println("  -timeout <duration>  Timeout for each request (default: 30s)")
+	fmt.Println("  -init-timeout <duration>")
+	fmt.Println("                       Timeout for starting and initializing the server (default: -timeout)")
+	fmt.Println("  -max-message-size <bytes>")
+	fmt.Println("                       Largest server message accepted (default: 8 MiB)")
+	fmt.Println("  -format <fmt>        Output format: pretty, json, ndjson, raw, text, completion, diagnostics, references, diff, signature, tokens (default: pretty)")
 	fmt.Println("  -quiet               Only output result data")
+	fmt.Println("  -color <mode>        Colorize pretty output: auto, always, never (default: auto)")
+	fmt.Println("  -render              Print hover markdown as text (pretty format)")
+	fmt.Println("  -select <path>       Print only part of the result, e.g. contents.value or [0].uri")
+	fmt.Println("  -flatten-symbols     Print documentSymbol results as name/kind/line:col lines (pretty format)")
+	fmt.Println("  -strip-fences        Remove markdown code fences when rendering")
+	fmt.Println("  -limit <n>           Print only the first n entries of array results and how many were left out")
+	fmt.Println("  -timing              Report how long each request took")
+	fmt.Println("  -echo-id             Show the response id in pretty headers (\"Response for <method> [id=3]:\")")
+	fmt.Println("  -fail-on-null        Exit with status 3 when a result is null or an empty array")
+	fmt.Println("  -assert <expr>       Exit with status 4 unless every result satisfies expr, e.g. 'len(result) > 0' (repeatable)")
+	fmt.Println("  -count-only          Print only the number of entries in list results (0 for null)")
+	fmt.Println("  -show-progress       Print server progress ($/progress) to stderr while waiting")
+	fmt.Println("  -trace <value>       Set the server trace level (off, messages, verbose) and print $/logTrace to stderr")
+	fmt.Println("  -repeat <n>          Send the request n times and print min/median/p95/max timings")
+	fmt.Println("  -pipeline            With -repeat, write all requests before reading the responses")
+	fmt.Println("  -wait-diagnostics <duration>")
+	fmt.Println("                       Collect and print publishDiagnostics for this long after the request")
+	fmt.Println("  -wait-for <method>   After the request, wait for this notification and print it")
+	fmt.Println("  -linger <duration>   After the request, print incoming notifications for this long before closing")
+	fmt.Println("  -wait-for-params <json>")
+	fmt.Println("                       JSON the -wait-for notification's params must contain")
 	fmt.Println("  -verbose             Enable verbose logging")
-	fmt.Println("  -list-methods        List common LSP methods")
+	fmt.Println("  -quiet-errors        Print no logs to stderr, only the results and error responses")
+	fmt.Println("  -log-file <file>     Write logs to a file instead of stderr")
+	fmt.Println("  -output-file <file>  Write results to a file instead of stdout, never colored")
+	fmt.Println("  -log-format <fmt>    Log format: text, json (default: text)")
+	fmt.Println("  -completion <shell>  Print a completion script for bash, zsh or fish")
+	fmt.Println("  -list-methods        List common LSP methods (as JSON with -format json or ndjson)")
+	fmt.Println("  -version             Print the version, VCS revision and Go version")
+	fmt.Println("  -allow-unknown-method")
+	fmt.Println("                       Send methods missing from -list-methods (e.g. server extensions)")
+	fmt.Println("\nExit status:")
+	fmt.Println("  0  Success")
+	fmt.Println("  1  Startup or transport failure")
+	fmt.Println("  2  The server returned a JSON-RPC error")
+	fmt.Println("  3  A result was null or an empty array (-fail-on-null)")
+	fmt.Println("  4  An -assert assertion did not hold")
 	fmt.Println("\nExamples:")
 	fmt.Println("  # Hover information")
 	fmt.Println("  clsp -server gopls -method textDocument/hover -params '{\"textDocument\":{\"uri\":\"file:///path/to/file.go\"},\"position\":{\"line\":10,\"character\":5}}'")
+	fmt.Println("  # Build params from a file and position")
+	fmt.Println("  clsp -server gopls -method textDocument/definition -file main.go -line 10 -character 5")
 	fmt.Println("  # Use params file")
 	fmt.Println("  clsp -server gopls -method textDocument/completion -params-file hover.json")
+	fmt.Println("  # Batch hover and definition at the same position")
+	fmt.Println("  clsp -server gopls -params '[{\"method\":\"textDocument/hover\",\"params\":{...}},{\"method\":\"textDocument/definition\",\"params\":{...}}]'")
 	fmt.Println("  # List workspace symbols")
 	fmt.Println("  clsp -server gopls -method workspace/symbol -params '{\"query\":\"main\"}' -format json -quiet")
 }
 
-func printCommonMethods() {
-	fmt.Println("Common LSP Methods:")
-	fmt.Println("\nText Document:")
-	fmt.Println("  textDocument/hover           - Get hover information")
-	fmt.Println("  textDocument/completion      - Get code completion")
-	fmt.Println("  textDocument/definition      - Go to definition")
-	fmt.Println("  textDocument/references      - Find references")
-	fmt.Println("  textDocument/documentSymbol  - Get document symbols")
-	fmt.Println("  textDocument/formatting      - Format document")
-	fmt.Println("  textDocument/codeAction      - Get code actions")
-	fmt.Println("  textDocument/rename          - Rename symbol")
-	fmt.Println("\nWorkspace:")
-	fmt.Println("  workspace/symbol             - Find workspace symbols")
-	fmt.Println("  workspace/executeCommand     - Execute command")
-	fmt.Println("\nDiagnostics:")
-	fmt.Println("  textDocument/publishDiagnostics - Diagnostics (notification)")
-	fmt.Println("\nExample parameter files can be created with:")
-	fmt.Println("  echo '{\"textDocument\":{\"uri\":\"file:///path/to/file.go\"},\"position\":{\"line\":10,\"character\":5}}' > hover.json")
-}
+// Exit codes returned by clsp.
+const (
+	exitOK            = 0
+	exitFailure       = 1 // startup or transport failure
+	exitResponseError = 2 // the server answered with a JSON-RPC error
+	exitNullResult    = 3 // -fail-on-null: a result was null or empty
+	exitAssertFailed  = 4 // -assert: an assertion did not hold
+)
 
 func main() {
+	os.Exit(run())
+}
+
+// run executes clsp and returns the process exit code. Keeping this separate
+// from main lets deferred cleanup such as client.Close run before exiting.
+func run() int {
 	var (
-		serverCmd    = flag.String("server", "", "LSP server command (required)")
-		serverArgs   = flag.String("args", "", "LSP server arguments (comma-separated)")
-		method       = flag.String("method", "", "LSP method to call (required)")
-		paramsStr    = flag.String("params", "{}", "JSON parameters for the method")
-		paramsFile   = flag.String("params-file", "", "Read parameters from JSON file")
-		rootURI      = flag.String("root", "", "Root URI for initialization (defaults to current directory)")
-		skipInit     = flag.Bool("skip-init", false, "Skip initialization (for raw requests)")
-		timeout      = flag.Duration("timeout", 30*time.Second, "Request timeout")
-		verbose      = flag.Bool("verbose", false, "Enable verbose logging")
-		outputFormat = flag.String("format", "pretty", "Output format: pretty, json, raw")
-		quiet        = flag.Bool("quiet", false, "Only output result data, no headers or labels")
-		listMethods  = flag.Bool("list-methods", false, "List common LSP methods and exit")
+		configFile      = flag.String("config", "", "Project config file (default: nearest .clsp.json in this or a parent directory)")
+		serverCmd       = flag.String("server", "", "LSP server command (required)")
+		serverArgs      = flag.String("args", "", "LSP server arguments (comma-separated)")
+		cwd             = flag.String("cwd", "", "Working directory for the server process (defaults to -root when given)")
+		connectAddr     = flag.String("connect", "", "Connect to an LSP server listening on host:port")
+		socketPath      = flag.String("socket", "", "Connect to an LSP server listening on a Unix domain socket")
+		wsURL           = flag.String("ws", "", "Connect to an LSP server over WebSocket (ws:// or wss:// URL)")
+		method          = flag.String("method", "", "LSP method to call (required)")
+		paramsStr       = flag.String("params", "{}", "JSON parameters for the method")
+		paramsFile      = flag.String("params-file", "", "Read parameters from JSON file")
+		paramsTemplate  = flag.String("params-template", "", "Read parameters from a JSON template with ${name} placeholders")
+		scriptFile      = flag.String("script", "", "Run the method/params lines of a file in order")
+		filePath        = flag.String("file", "", "Build textDocument and position params for this file")
+		rangeFlag       = flag.String("range", "", "Add a 1-based startLine:startCol-endLine:endCol range to the -file params, e.g. for textDocument/inlayHint")
+		line            = flag.Int("line", -1, "Zero-based line used with -file (position is omitted when unset)")
+		character       = flag.Int("character", 0, "Zero-based byte column used with -file")
+		rootURI         = flag.String("root", "", "Root URI or directory for initialization (defaults to current directory)")
+		showCaps        = flag.Bool("show-capabilities", false, "Print the server capabilities from the initialize response and exit")
+		skipInit        = flag.Bool("skip-init", false, "Skip initialization (for raw requests)")
+		strictSkipInit  = flag.Bool("strict-skip-init", false, "With -skip-init, never initialize, even when the server answers ServerNotInitialized")
+		initOptionsStr  = flag.String("init-options", "", "initializationOptions for the initialize request as JSON")
+		initOptionsFile = flag.String("init-options-file", "", "Read initializationOptions from JSON file")
+		clangdCompile   = flag.String("clangd-compile-commands", "", "Point clangd at the compile_commands.json in this directory")
+		clientName      = flag.String("client-name", "", `clientInfo name sent on initialize (default "clsp"), e.g. to impersonate an editor`)
+		clientVer       = flag.String("client-version", "", "clientInfo version sent on initialize (default: the clsp build version)")
+		startID         = flag.Int("start-id", 1, "ID of the first request; the next unused ID is logged at exit")
+		recordFile      = flag.String("record", "", "Append every message sent and received to this JSONL file")
+		replayFile      = flag.String("replay", "", "Play back the server messages of a -record file instead of running a server")
+		jsonrpcVersion  = flag.String("jsonrpc-version", "2.0", `Value of the "jsonrpc" field sent to the server, or "none" to omit it`)
+		noExit          = flag.Bool("no-exit", false, "Skip the exit notification after shutdown and let the server exit when its pipes close, for servers that hang or crash on exit")
+		dryRun          = flag.Bool("dry-run", false, "Print the framed messages instead of sending them; no server is started")
+		autoRestart     = flag.Bool("auto-restart", false, "Restart the server and retry once if it goes away during a request")
+		initRetries     = flag.Int("init-retries", 1, "Attempt initialization up to N times with exponential backoff")
+		capsList        = flag.String("caps", "", "Advertise only these client capabilities (comma-separated, or none)")
+		capsFile        = flag.String("capabilities-file", "", "Read client capabilities from a JSON file")
+		capsMode        = flag.String("capabilities-mode", "merge", "How -capabilities-file applies: merge or replace")
+		maxMessageSize  = flag.Int("max-message-size", defaultMaxMessageSize, "Largest message body accepted from the server, in bytes")
+		timeout         = flag.Duration("timeout", 30*time.Second, "Timeout for each request")
+		initTimeout     = flag.Duration("init-timeout", 0, "Timeout for starting and initializing the server (default: -timeout)")
+		verbose         = flag.Bool("verbose", false, "Enable verbose logging")
+		quietErrors     = flag.Bool("quiet-errors", false, "Print no logs to stderr, not even errors; the output and the exit status still report failures")
+		logFile         = flag.String("log-file", "", "Write logs to this file instead of stderr")
+		outputFile      = flag.String("output-file", "", "Write results to this file instead of stdout, without color")
+		logFormat       = flag.String("log-format", "text", "Log format: text, json")
+		outputFormat    = flag.String("format", "pretty", "Output format: pretty, json, ndjson, raw, text, completion, diagnostics, references, diff, signature, tokens")
+		quiet           = flag.Bool("quiet", false, "Only output result data, no headers or labels")
+		colorMode       = flag.String("color", "auto", "Colorize pretty output: auto (when stdout is a terminal), always or never")
+		render          = flag.Bool("render", false, "Print hover markdown as plain text in pretty format")
+		stripFences     = flag.Bool("strip-fences", false, "Remove markdown code fences when using -render or -format text")
+		selectFlag      = flag.String("select", "", "Print only this part of the result, e.g. contents.value or [0].location.uri")
+		flatSymbols     = flag.Bool("flatten-symbols", false, "Print documentSymbol results as a flat, indented list in pretty format")
+		repeat          = flag.Int("repeat", 1, "Send the request this many times on one connection and print timing stats")
+		pipeline        = flag.Bool("pipeline", false, "With -repeat, write every request before reading any response")
+		limit           = flag.Int("limit", 0, "Print only the first N entries of array results, e.g. of workspace/symbol (0: all)")
+		failOnNull      = flag.Bool("fail-on-null", false, "Exit with status 3 when a result is null or an empty array")
+		countOnly       = flag.Bool("count-only", false, "Print only the number of entries in an array result or its items, 0 for null")
+		echoID          = flag.Bool("echo-id", false, "Show each response's JSON-RPC id in pretty headers, as \"Response for <method> [id=3]:\"")
+		timing          = flag.Bool("timing", false, "Report request durations on stderr and in pretty/json output")
+		completionShell = flag.String("completion", "", "Print a completion script for bash, zsh or fish and exit")
+		showVersion     = flag.Bool("version", false, "Print the clsp version, VCS revision and Go version and exit")
+		listMethods     = flag.Bool("list-methods", false, "List common LSP methods and exit; with -format json or ndjson, as JSON")
+		allowUnknown    = flag.Bool("allow-unknown-method", false, "Send methods that aren't in the known LSP method list")
+		lifecycle       = flag.Bool("lifecycle", false, "Open the -file/-pos document before the request and close all opened documents after it")
+		showProgress    = flag.Bool("show-progress", false, "Print $/progress notifications from the server to stderr")
+		trace           = flag.String("trace", "", "Ask the server for tracing: off, messages or verbose; $/logTrace is printed to stderr")
+		waitFor         = flag.String("wait-for", "", "After the request, keep reading until a notification with this method arrives and print it")
+		waitForParams   = flag.String("wait-for-params", "", "JSON the -wait-for notification's params must contain, e.g. {\"uri\":\"file:///a.go\"}")
+		stdinContent    = flag.String("stdin-content", "", "Open a document with this URI or path whose text is read from stdin instead of a file")
+		languageID      = flag.String("language-id", "", "languageId of the -stdin-content document (default: from its extension)")
+		posStdin        = flag.Bool("pos-stdin", false, "Read file:line:col locations, such as grep or rg --vimgrep output, from stdin and run -method at each")
+		apply           = flag.Bool("apply", false, "Apply a WorkspaceEdit result to the files on disk")
+		resolveLinks    = flag.Bool("resolve-links", false, "Print the document links of -file, resolving those without a target with documentLink/resolve")
+		callDirection   = flag.String("call-hierarchy", "", "Print the incoming or outgoing calls of the function at -file/-pos, via textDocument/prepareCallHierarchy")
+		command         = flag.String("command", "", "Run this server command with workspace/executeCommand, with -command-arg arguments")
+		renameTo        = flag.String("rename", "", "Rename the symbol at -file/-pos to this name, checking with textDocument/prepareRename first")
+		waitDiags       = flag.Duration("wait-diagnostics", 0, "Collect publishDiagnostics notifications for this long after the request")
+		lingerFor       = flag.Duration("linger", 0, "After the request, keep printing incoming notifications for this long before closing")
 	)
+	var filePositions, openFiles, closeFiles, changes, changedFiles, commandArgs, workspaceFolders, env, vars, serverArgList, assertFlags stringSliceFlag
+	flag.Var(&assertFlags, "assert", "Exit with status 4 unless the result satisfies this expression, e.g. 'len(result) > 0' (repeatable)")
+	flag.Var(&filePositions, "pos", "Build textDocument and position params from a 1-based file:line:col (repeatable, to run -method at each)")
+	flag.Var(&serverArgList, "arg", "LSP server argument, may contain commas (repeatable, after -args)")
+	flag.Var(&vars, "var", "KEY=VALUE for a ${KEY} placeholder in -params-template (repeatable)")
+	flag.Var(&closeFiles, "close", "Send textDocument/didClose for a file opened with -open after the request (repeatable)")
+	flag.Var(&env, "env", "Set an environment variable for the server as KEY=VALUE (repeatable)")
+	flag.Var(&openFiles, "open", "Open a file with textDocument/didOpen before the request (repeatable)")
+	flag.Var(&workspaceFolders, "workspace-folder", "Add a workspace folder as <uri|dir>[=name] (repeatable)")
+	flag.Var(&changes, "change", "Send a textDocument/didChange content change (JSON) for the last -open file (repeatable)")
+	flag.Var(&commandArgs, "command-arg", "Argument for -command, as JSON or else a plain string (repeatable)")
+	flag.Var(&changedFiles, "changed-file", "Report a file event as <path>:<created|changed|deleted> with workspace/didChangeWatchedFiles before the request (repeatable)")
 	flag.Parse()
 
 	logLevel := slog.LevelInfo
 	if *verbose {
 		logLevel = slog.LevelDebug
 	}
-	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-		Level: logLevel,
-	}))
+	logOutput := io.Writer(os.Stderr)
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
+			return exitFailure
+		}
+		defer f.Close()
+		logOutput = f
+	}
+	logger, err := newLogger(logOutput, *logFormat, logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	// Scripts that only want the output and the exit status get no logs,
+	// unless they go to a -log-file, which leaves stderr clean anyway.
+	if *quietErrors && *logFile == "" {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	if *showVersion {
+		fmt.Print(formatVersion(buildInfo()))
+		return exitOK
+	}
+
+	if *completionShell != "" {
+		if err := writeCompletion(os.Stdout, *completionShell, flag.CommandLine); err != nil {
+			logger.Error("Failed to write completion script", "error", err)
+			return exitFailure
+		}
+		return exitOK
+	}
 
 	if *listMethods {
-		printCommonMethods()
-		os.Exit(0)
+		switch *outputFormat {
+		case "json", "ndjson":
+			if err := writeMethodsJSON(os.Stdout, *outputFormat == "ndjson"); err != nil {
+				logger.Error("Failed to write methods", "error", err)
+				return exitFailure
+			}
+		default:
+			printCommonMethods()
+		}
+		return exitOK
 	}
 
-	if *serverCmd == "" || *method == "" {
+	// Flags given on the command line win over the config file.
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	configPath := *configFile
+	if configPath == "" {
+		configPath, err = findConfig(".")
+		if err != nil {
+			logger.Error("Failed to look for config file", "error", err)
+			return exitFailure
+		}
+	}
+	var cfg Config
+	if configPath != "" {
+		loaded, err := loadConfig(configPath)
+		if err != nil {
+			logger.Error("Failed to load config file", "file", configPath, "error", err)
+			return exitFailure
+		}
+		logger.Debug("Loaded config file", "file", configPath)
+		cfg = *loaded
+	}
+	if cfg.Server != "" && !explicit["server"] {
+		*serverCmd = cfg.Server
+	}
+	if cfg.Root != "" && !explicit["root"] {
+		*rootURI = cfg.Root
+	}
+	if cfg.timeout > 0 && !explicit["timeout"] {
+		*timeout = cfg.timeout
+	}
+
+	var params any
+	var targetPath string // the document -file or -pos points at
+	var targetPos *Position
+	// posLocations are the positions to run -method at one after another,
+	// from -pos-stdin or several -pos.
+	var posLocations []fileLocation
+	if len(filePositions) > 0 && *filePath != "" {
+		logger.Error("-pos and -file cannot be used together")
+		return exitFailure
+	}
+	if len(filePositions) > 1 {
+		for _, s := range filePositions {
+			path, pos, err := parseFilePosition(s)
+			if err != nil {
+				logger.Error("Invalid -pos", "error", err)
+				return exitFailure
+			}
+			posLocations = append(posLocations, fileLocation{Input: s, Path: path, Pos: pos})
+		}
+	} else if len(filePositions) == 1 {
+		path, pos, err := parseFilePosition(filePositions[0])
+		if err != nil {
+			logger.Error("Invalid -pos", "error", err)
+			return exitFailure
+		}
+		params = textDocumentParams(path, pos.Line, pos.Character)
+		targetPath = path
+		targetPos = &pos
+	} else if *filePath != "" {
+		params = textDocumentParams(*filePath, *line, *character)
+		targetPath = *filePath
+		if *line >= 0 {
+			targetPos = &Position{Line: *line, Character: *character}
+		}
+	}
+
+	if *rangeFlag != "" {
+		base, _ := params.(map[string]any)
+		if *filePath == "" || *line >= 0 || base == nil {
+			logger.Error("-range needs -file without -line")
+			return exitFailure
+		}
+		r, err := parseRange(*rangeFlag)
+		if err != nil {
+			logger.Error("Invalid -range", "error", err)
+			return exitFailure
+		}
+		base["range"] = r
+	}
+
+	var explicitParams any
+	if *paramsFile != "" {
+		paramsData, err := os.ReadFile(*paramsFile)
+		if err != nil {
+			logger.Error("Failed to read params file", "file", *paramsFile, "error", err)
+			return exitFailure
+		}
+		if err := json.Unmarshal(paramsData, &explicitParams); err != nil {
+			logger.Error("Failed to parse params file JSON", "file", *paramsFile, "error", err)
+			return exitFailure
+		}
+	} else if *paramsStr != "" && *paramsStr != "{}" {
+		if err := json.Unmarshal([]byte(*paramsStr), &explicitParams); err != nil {
+			logger.Error("Failed to parse params JSON", "error", err)
+			return exitFailure
+		}
+	}
+	// Explicit params add to what -file/-pos built, such as the context
+	// of textDocument/references, and win where both set a field.
+	if built, ok := params.(map[string]any); ok && explicitParams != nil {
+		params, err = mergeParams(built, explicitParams)
+		if err != nil {
+			logger.Error("Cannot merge -params", "error", err)
+			return exitFailure
+		}
+	} else if explicitParams != nil {
+		params = explicitParams
+	}
+
+	// A template takes its values from -file/-pos, so it replaces the
+	// params they built.
+	if *paramsTemplate != "" {
+		templateValues, err := templateVars(targetPath, targetPos, vars)
+		if err != nil {
+			logger.Error("Invalid template variable", "error", err)
+			return exitFailure
+		}
+		params, err = loadParamsTemplate(*paramsTemplate, templateValues)
+		if err != nil {
+			logger.Error("Failed to load params template", "file", *paramsTemplate, "error", err)
+			return exitFailure
+		}
+	}
+
+	if len(commandArgs) > 0 && *command == "" {
+		logger.Error("-command-arg requires -command")
+		return exitFailure
+	}
+	if *command != "" {
+		if *method != "" && *method != "workspace/executeCommand" {
+			logger.Error("-command cannot be used with -method", "method", *method)
+			return exitFailure
+		}
+		if params != nil {
+			logger.Error("-command builds the params itself; it cannot be used with -params, -params-file, -params-template, -file or -pos")
+			return exitFailure
+		}
+		params = executeCommandParams(*command, commandArgs)
+		*method = "workspace/executeCommand"
+	}
+
+	var initOptions any
+	if *initOptionsFile != "" {
+		data, err := os.ReadFile(*initOptionsFile)
+		if err != nil {
+			logger.Error("Failed to read initialization options file", "file", *initOptionsFile, "error", err)
+			return exitFailure
+		}
+		if err := json.Unmarshal(data, &initOptions); err != nil {
+			logger.Error("Failed to parse initialization options file JSON", "file", *initOptionsFile, "error", err)
+			return exitFailure
+		}
+	} else if *initOptionsStr != "" {
+		if err := json.Unmarshal([]byte(*initOptionsStr), &initOptions); err != nil {
+			logger.Error("Failed to parse initialization options JSON", "error", err)
+			return exitFailure
+		}
+	}
+
+	// clangd takes the compilation database directory as an argument or
+	// an initialization option; -clangd-compile-commands sets both.
+	var clangdArg string
+	if *clangdCompile != "" {
+		dir, err := clangdCompileCommandsDir(*clangdCompile)
+		if err != nil {
+			logger.Error("Invalid -clangd-compile-commands directory", "error", err)
+			return exitFailure
+		}
+		if !hasCompilationDatabase(dir) {
+			logger.Warn("No compile_commands.json or compile_flags.txt in the -clangd-compile-commands directory", "dir", dir)
+		}
+		initOptions, err = mergeInitOptions(initOptions, map[string]any{"compilationDatabasePath": dir})
+		if err != nil {
+			logger.Error("Cannot set the clangd compilation database", "error", err)
+			return exitFailure
+		}
+		clangdArg = clangdCompileCommandsArg + "=" + dir
+	}
+
+	batch, isBatch := parseBatch(params)
+
+	var script []ScriptStep
+	if *scriptFile != "" {
+		if *method != "" {
+			logger.Error("-script and -method cannot be used together")
+			return exitFailure
+		}
+		f, err := os.Open(*scriptFile)
+		if err != nil {
+			logger.Error("Failed to open script", "file", *scriptFile, "error", err)
+			return exitFailure
+		}
+		script, err = parseScript(f)
+		f.Close()
+		if err != nil {
+			logger.Error("Failed to parse script", "file", *scriptFile, "error", err)
+			return exitFailure
+		}
+	}
+
+	if !*allowUnknown {
+		methods := []string{*method}
+		if isBatch {
+			methods = methods[:0]
+			for _, r := range batch {
+				methods = append(methods, r.Method)
+			}
+		}
+		for _, step := range script {
+			methods = append(methods, step.Method)
+		}
+		for _, m := range methods {
+			if m == "" {
+				continue
+			}
+			if err := validateMethod(m); err != nil {
+				logger.Error("Invalid method", "error", err)
+				return exitFailure
+			}
+		}
+	}
+
+	var baseCapabilities map[string]any
+	if *capsList != "" {
+		features, err := parseCapsList(*capsList)
+		if err == nil {
+			baseCapabilities, err = buildClientCapabilities(features)
+		}
+		if err != nil {
+			logger.Error("Invalid -caps", "error", err)
+			return exitFailure
+		}
+	}
+
+	openURIs := make(map[string]bool)
+	for _, path := range openFiles {
+		openURIs[PathToFileURI(path)] = true
+	}
+	// The stdin document counts as opened, so -lifecycle and -close don't
+	// look for it on disk.
+	var stdinItem *TextDocumentItem
+	if *languageID != "" && *stdinContent == "" {
+		logger.Error("-language-id requires -stdin-content")
+		return exitFailure
+	}
+	if *stdinContent != "" {
+		if *posStdin {
+			logger.Error("-stdin-content and -pos-stdin both read stdin")
+			return exitFailure
+		}
+		item, err := textDocumentItemFromReader(os.Stdin, *stdinContent, *languageID)
+		if err != nil {
+			logger.Error("Failed to read document from stdin", "error", err)
+			return exitFailure
+		}
+		stdinItem = &item
+		openURIs[item.URI] = true
+	}
+	if *lifecycle {
+		if targetPath == "" && len(openFiles) == 0 {
+			logger.Error("-lifecycle needs a document from -file, -pos or -open")
+			return exitFailure
+		}
+		if targetPath != "" && !openURIs[PathToFileURI(targetPath)] {
+			openFiles = append(openFiles, targetPath)
+		}
+	}
+	var closeURIs []string
+	for _, path := range closeFiles {
+		uri := PathToFileURI(path)
+		if !openURIs[uri] {
+			logger.Error("-close file was not opened with -open", "file", path)
+			return exitFailure
+		}
+		closeURIs = append(closeURIs, uri)
+	}
+	fileEvents, err := parseFileEvents(changedFiles)
+	if err != nil {
+		logger.Error("Invalid -changed-file", "error", err)
+		return exitFailure
+	}
+
+	var waitForWant any
+	if *waitForParams != "" {
+		if *waitFor == "" {
+			logger.Error("-wait-for-params requires -wait-for")
+			return exitFailure
+		}
+		if err := json.Unmarshal([]byte(*waitForParams), &waitForWant); err != nil {
+			logger.Error("Failed to parse -wait-for-params JSON", "error", err)
+			return exitFailure
+		}
+	}
+
+	switch *trace {
+	case "", "off", "messages", "verbose":
+	default:
+		logger.Error("Invalid -trace value; use off, messages or verbose", "trace", *trace)
+		return exitFailure
+	}
+
+	var renameBase map[string]any
+	if *renameTo != "" {
+		if *method != "" && *method != "textDocument/rename" {
+			logger.Error("-rename cannot be used with -method", "method", *method)
+			return exitFailure
+		}
+		renameBase, _ = params.(map[string]any)
+		if targetPos == nil || renameBase == nil || *paramsTemplate != "" {
+			logger.Error("-rename needs a position from -pos or -file with -line")
+			return exitFailure
+		}
+		*method = "textDocument/rename"
+	}
+
+	var linkParams map[string]any
+	if *resolveLinks {
+		if *method != "" || *renameTo != "" || *callDirection != "" {
+			logger.Error("-resolve-links cannot be used with -method, -rename or -call-hierarchy", "method", *method)
+			return exitFailure
+		}
+		base, _ := params.(map[string]any)
+		if targetPath == "" || base == nil || *paramsTemplate != "" {
+			logger.Error("-resolve-links needs a document from -file or -pos")
+			return exitFailure
+		}
+		linkParams = map[string]any{"textDocument": base["textDocument"]}
+		*method = "textDocument/documentLink"
+	}
+
+	var callBase map[string]any
+	if *callDirection != "" {
+		if *callDirection != "incoming" && *callDirection != "outgoing" {
+			logger.Error("Invalid -call-hierarchy; use incoming or outgoing", "call-hierarchy", *callDirection)
+			return exitFailure
+		}
+		if *method != "" || *renameTo != "" {
+			logger.Error("-call-hierarchy cannot be used with -method or -rename", "method", *method)
+			return exitFailure
+		}
+		callBase, _ = params.(map[string]any)
+		if targetPos == nil || callBase == nil || *paramsTemplate != "" {
+			logger.Error("-call-hierarchy needs a position from -pos or -file with -line")
+			return exitFailure
+		}
+		*method = "textDocument/prepareCallHierarchy"
+	}
+
+	if len(posLocations) > 0 {
+		if *method == "" || *paramsFile != "" || *paramsTemplate != "" || params != nil || script != nil || *renameTo != "" || *callDirection != "" || *repeat > 1 || *posStdin {
+			logger.Error("Several -pos need -method and build the params themselves; they cannot be used with -params, -script, -rename, -call-hierarchy, -repeat or -pos-stdin")
+			return exitFailure
+		}
+	}
+	if *posStdin {
+		if *method == "" || len(filePositions) > 0 || *filePath != "" || *paramsFile != "" || *paramsTemplate != "" || params != nil || script != nil || *renameTo != "" || *callDirection != "" || *repeat > 1 {
+			logger.Error("-pos-stdin needs -method and builds the params itself; it cannot be used with -pos, -file, -params, -script, -rename, -call-hierarchy or -repeat")
+			return exitFailure
+		}
+		posLocations, err = readGrepLocations(os.Stdin)
+		if err != nil {
+			logger.Error("Failed to read locations from stdin", "error", err)
+			return exitFailure
+		}
+	}
+
+	if *apply && (*dryRun || isBatch || script != nil || *repeat > 1 || len(filePositions) > 1) {
+		logger.Error("-apply needs a single request; it cannot be used with -dry-run, -script, -repeat, several -pos or batch params")
+		return exitFailure
+	}
+
+	if *startID < 0 {
+		logger.Error("-start-id must not be negative", "start-id", *startID)
+		return exitFailure
+	}
+
+	if *limit < 0 {
+		logger.Error("-limit must not be negative", "limit", *limit)
+		return exitFailure
+	}
+
+	if *repeat < 1 {
+		logger.Error("-repeat must be at least 1", "repeat", *repeat)
+		return exitFailure
+	}
+
+	var assertions []*assertion
+	for _, expr := range assertFlags {
+		a, err := parseAssertion(expr)
+		if err != nil {
+			logger.Error("Invalid -assert", "error", err)
+			return exitFailure
+		}
+		assertions = append(assertions, a)
+	}
+	if *pipeline && (*repeat < 2 || *method == "" || isBatch || script != nil || *renameTo != "" || *resolveLinks || *callDirection != "") {
+		logger.Error("-pipeline needs -method and -repeat; it cannot be used with -script, -rename, -resolve-links, -call-hierarchy or batch params")
+		return exitFailure
+	}
+
+	switch *outputFormat {
+	case "pretty", "json", "ndjson", "raw", "text", "completion", "diagnostics", "references", "diff", "signature", "tokens":
+	default:
+		logger.Error("Invalid output format", "format", *outputFormat)
+		return exitFailure
+	}
+
+	output := outputOptions{
+		format:      *outputFormat,
+		quiet:       *quiet,
+		render:      *render,
+		stripFences: *stripFences,
+		flatSymbols: *flatSymbols,
+		callList:    *callDirection != "",
+		linkList:    *resolveLinks,
+		echoID:      *echoID,
+		countOnly:   *countOnly,
+		selectPath:  *selectFlag,
+		timing:      *timing,
+		limit:       *limit,
+	}
+	if output.color, err = useColor(*colorMode, os.Stdout); err != nil {
+		logger.Error("Invalid -color", "error", err)
+		return exitFailure
+	}
+
+	if (*serverCmd == "" && *connectAddr == "" && *socketPath == "" && *wsURL == "" && *replayFile == "" && !*dryRun) || (*method == "" && !isBatch && script == nil && !*showCaps) {
 		printUsage()
-		os.Exit(1)
+		return exitFailure
 	}
 
-	var args []string
-	if *serverArgs != "" {
-		args = strings.Split(*serverArgs, ",")
-		for i, arg := range args {
-			args[i] = strings.TrimSpace(arg)
+	// Results are all printed to os.Stdout, so pointing it at the file
+	// moves them there while logs and progress stay on stderr.
+	if *outputFile != "" {
+		f, err := os.Create(*outputFile)
+		if err != nil {
+			logger.Error("Failed to create output file", "file", *outputFile, "error", err)
+			return exitFailure
 		}
+		stdout := os.Stdout
+		os.Stdout = f
+		defer func() {
+			os.Stdout = stdout
+			if err := f.Close(); err != nil {
+				logger.Error("Failed to write output file", "file", *outputFile, "error", err)
+			}
+		}()
+		output.color = false
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
-	defer cancel()
+	args := cfg.serverArgs(serverArguments(*serverArgs, serverArgList), explicit)
+	if clangdArg != "" && !hasClangdCompileCommandsArg(args) {
+		args = append(args, clangdArg)
+	}
+
+	for _, kv := range env {
+		if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+			logger.Error("Invalid -env value, want KEY=VALUE", "value", kv)
+			return exitFailure
+		}
+	}
 
-	client, err := NewLSPClient(ctx, *serverCmd, args, logger)
+	// SIGINT/SIGTERM cancel ctx like a timeout does: the pending request
+	// fails, run returns and the deferred client.Close shuts the server
+	// down. A second signal kills the server, which runs in a process
+	// group of its own that a terminal Ctrl-C doesn't reach, and exits
+	// immediately.
+	var lastClient atomic.Pointer[LSPClient] // the one connect made last
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		stop()
+		again := make(chan os.Signal, 1)
+		signal.Notify(again, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(again)
+		select {
+		case <-again:
+			if client := lastClient.Load(); client != nil {
+				client.kill()
+			}
+			os.Exit(exitFailure)
+		case <-done:
+		}
+	}()
+
+	// Starting the server and each request have budgets of their own, so
+	// a slow start doesn't eat into the time a request may take. Expiry
+	// only abandons what was waiting; the client stays usable.
+	startupTimeout := *initTimeout
+	if startupTimeout <= 0 {
+		startupTimeout = *timeout
+	}
+	requestContext := func() (context.Context, context.CancelFunc) {
+		return context.WithTimeout(ctx, *timeout)
+	}
+
+	rootURIValue, rootPath, err := resolveRoot(*rootURI)
+	if err != nil {
+		logger.Error("Failed to resolve root", "root", *rootURI, "error", err)
+		return exitFailure
+	}
+	output.root = rootPath
+	output.documentURI = paramsDocumentURI(params)
+
+	// Run the server from the root unless told otherwise, so it resolves
+	// relative paths against the project.
+	serverDir := *cwd
+	if serverDir == "" && *rootURI != "" {
+		serverDir = rootPath
+	}
+
+	var rec *recorder
+	if *recordFile != "" {
+		f, err := os.OpenFile(*recordFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			logger.Error("Failed to open record file", "file", *recordFile, "error", err)
+			return exitFailure
+		}
+		defer f.Close()
+		rec = newRecorder(f)
+	}
+
+	connect := func() (*LSPClient, error) {
+		// Each connection, including those of restarts, gets the startup
+		// timeout to be established in.
+		ctx, cancel := context.WithTimeout(ctx, startupTimeout)
+		defer cancel()
+
+		var client *LSPClient
+		var err error
+		switch {
+		case *dryRun:
+			client = NewDryRunClient(os.Stdout, logger)
+		case *replayFile != "":
+			f, openErr := os.Open(*replayFile)
+			if openErr != nil {
+				return nil, openErr
+			}
+			client, err = NewReplayClient(f, logger)
+			f.Close()
+		case *connectAddr != "":
+			client, err = NewLSPClientTCP(ctx, *connectAddr, logger)
+		case *socketPath != "":
+			client, err = NewLSPClientUnix(ctx, *socketPath, logger)
+		case *wsURL != "":
+			client, err = NewLSPClientWebSocket(ctx, *wsURL, logger)
+		default:
+			// The server must outlive ctx so Close can still shut it
+			// down after a timeout or signal.
+			client, err = NewLSPClient(context.WithoutCancel(ctx), ServerCommand{Path: *serverCmd, Args: args, Env: env, Dir: serverDir}, logger)
+		}
+		if err != nil {
+			return nil, err
+		}
+		client.maxMessageSize = *maxMessageSize
+		client.recorder = rec
+		client.jsonrpcVersion = *jsonrpcVersion
+		client.skipExit = *noExit
+		client.id = *startID
+		lastClient.Store(client)
+		return client, nil
+	}
+
+	client, err := connect()
 	if err != nil {
 		logger.Error("Failed to start LSP server", "error", err)
-		os.Exit(1)
+		return exitFailure
+	}
+	// The diff format compares edits against the document as the server
+	// has it, or as it is on disk when it wasn't opened.
+	output.documentText = func(uri string) (string, bool) {
+		if text, ok := client.DocumentText(uri); ok {
+			return text, true
+		}
+		path, err := FileURIToPath(uri)
+		if err != nil {
+			return "", false
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false
+		}
+		return string(data), true
+	}
+	output.tokenLegend = func() (SemanticTokensLegend, bool) {
+		return semanticTokensLegend(client.ServerCapabilities())
+	}
+	output.positionEncoding = func() string {
+		return client.PositionEncoding()
+	}
+
+	// Runs after Close, so the id covers shutdown too. A later session
+	// started with -start-id at this value continues the sequence.
+	if *recordFile != "" || explicit["start-id"] {
+		defer func() {
+			logger.Info("Request ids used", "start-id", *startID, "next-id", client.NextID())
+		}()
 	}
 	defer func() {
 		if closeErr := client.Close(); closeErr != nil {
@@ -397,42 +2052,665 @@ func main() {
 		}
 	}()
 
-	if !*skipInit {
-		rootURIValue := *rootURI
-		if rootURIValue == "" {
-			pwd, _ := os.Getwd()
-			rootURIValue = "file://" + pwd
+	// Register before initializing and opening documents so diagnostics
+	// published early aren't missed.
+	diagnosticsOnly := *method == "textDocument/publishDiagnostics"
+	var diagnostics *diagnosticsCollector
+	if !*dryRun && (diagnosticsOnly || *waitDiags > 0) {
+		diagnostics = collectDiagnostics(client)
+	}
+	if *showProgress {
+		printProgress(client, os.Stderr)
+	}
+	var waiter *notificationWaiter
+	if *waitFor != "" && !*dryRun {
+		waiter = waitForNotification(client, *waitFor, waitForWant)
+	}
+	if *trace != "" {
+		printLogTrace(client, os.Stderr)
+	}
+
+	// initialized keeps the params a restarted server is initialized with.
+	// initParams are built even with -skip-init, for a server that turns
+	// out to need initialization after all.
+	var initialized *InitializeParams
+	var initParams InitializeParams
+	if !*dryRun {
+		initParams = newInitializeParams(rootURIValue)
+		initParams.RootPath = rootPath
+		initParams.InitializationOptions = initOptions
+		initParams.Trace = *trace
+		if *clientName != "" {
+			initParams.ClientInfo.Name = *clientName
+		}
+		if *clientVer != "" {
+			initParams.ClientInfo.Version = *clientVer
+		}
+		if baseCapabilities != nil {
+			initParams.Capabilities = baseCapabilities
+		}
+
+		if len(workspaceFolders) > 0 {
+			folders, err := parseWorkspaceFolders(workspaceFolders)
+			if err != nil {
+				logger.Error("Failed to parse workspace folder", "error", err)
+				return exitFailure
+			}
+			applyWorkspaceFolders(client, &initParams, folders, *rootURI == "")
+		}
+
+		// Servers only answer pull diagnostics for clients that advertise
+		// them; an explicit -caps list is left as given.
+		if isPullDiagnostics(*method) && *capsList == "" {
+			initParams.Capabilities = mergeCapabilities(initParams.Capabilities, map[string]any{
+				"textDocument": map[string]any{"diagnostic": capabilityFeatures["diagnostic"].value()},
+			})
+		}
+
+		// Servers send no tokens, or tokens of types the client didn't
+		// list, unless asked for them.
+		if isSemanticTokens(*method) && *capsList == "" {
+			initParams.Capabilities = mergeCapabilities(initParams.Capabilities, map[string]any{
+				"textDocument": map[string]any{"semanticTokens": capabilityFeatures["semanticTokens"].value()},
+			})
+		}
+
+		// Servers only compute inlay hints for clients that advertise
+		// them.
+		if *method == "textDocument/inlayHint" && *capsList == "" {
+			initParams.Capabilities = mergeCapabilities(initParams.Capabilities, map[string]any{
+				"textDocument": map[string]any{"inlayHint": capabilityFeatures["inlayHint"].value()},
+			})
 		}
 
-		if err := client.Initialize(ctx, rootURIValue); err != nil {
+		// Type definition and implementation requests go unanswered by
+		// servers that only serve what the client advertises; with
+		// linkSupport they may answer with LocationLinks, which print
+		// like Locations.
+		if (*method == "textDocument/typeDefinition" || *method == "textDocument/implementation") && *capsList == "" {
+			feature := strings.TrimPrefix(*method, "textDocument/")
+			initParams.Capabilities = mergeCapabilities(initParams.Capabilities, map[string]any{
+				"textDocument": map[string]any{feature: capabilityFeatures[feature].value()},
+			})
+		}
+
+		// Fold kinds and collapsed text are only sent to clients that
+		// list them.
+		if *method == "textDocument/foldingRange" && *capsList == "" {
+			initParams.Capabilities = mergeCapabilities(initParams.Capabilities, map[string]any{
+				"textDocument": map[string]any{"foldingRange": capabilityFeatures["foldingRange"].value()},
+			})
+		}
+
+		// Tooltips are only sent to clients that can show them.
+		if *method == "textDocument/documentLink" && *capsList == "" {
+			initParams.Capabilities = mergeCapabilities(initParams.Capabilities, map[string]any{
+				"textDocument": map[string]any{"documentLink": capabilityFeatures["documentLink"].value()},
+			})
+		}
+
+		// Servers only answer call hierarchy requests for clients that
+		// advertise them.
+		if (*callDirection != "" || isCallHierarchy(*method)) && *capsList == "" {
+			initParams.Capabilities = mergeCapabilities(initParams.Capabilities, map[string]any{
+				"textDocument": map[string]any{"callHierarchy": capabilityFeatures["callHierarchy"].value()},
+			})
+		}
+
+		// Servers change files during a command by asking the client to
+		// apply an edit, which they only do for clients that can.
+		if *method == "workspace/executeCommand" && *capsList == "" {
+			initParams.Capabilities = mergeCapabilities(initParams.Capabilities, map[string]any{
+				"workspace": map[string]any{
+					"executeCommand": capabilityFeatures["executeCommand"].value(),
+					"applyEdit":      true,
+					"workspaceEdit":  capabilityFeatures["workspaceEdit"].value(),
+				},
+			})
+		}
+
+		// prepareRename is only answered for clients that advertise it.
+		if *renameTo != "" && *capsList == "" {
+			initParams.Capabilities = mergeCapabilities(initParams.Capabilities, map[string]any{
+				"textDocument": map[string]any{"rename": capabilityFeatures["rename"].value()},
+			})
+		}
+
+		// Without these, servers describe file operations and versioned
+		// edits to -apply less precisely, or not at all.
+		if *apply && *capsList == "" {
+			initParams.Capabilities = mergeCapabilities(initParams.Capabilities, map[string]any{
+				"workspace": map[string]any{"workspaceEdit": capabilityFeatures["workspaceEdit"].value()},
+			})
+		}
+
+		// Servers may ignore file events from clients that don't say they
+		// send them.
+		if len(fileEvents) > 0 && *capsList == "" {
+			initParams.Capabilities = mergeCapabilities(initParams.Capabilities, map[string]any{
+				"workspace": map[string]any{"didChangeWatchedFiles": capabilityFeatures["didChangeWatchedFiles"].value()},
+			})
+		}
+
+		// Servers only report progress to clients that say they can show it.
+		if *showProgress {
+			initParams.Capabilities = mergeCapabilities(initParams.Capabilities, map[string]any{
+				"window": map[string]any{"workDoneProgress": true},
+			})
+		}
+
+		if *capsFile != "" {
+			capabilities, err := loadCapabilities(*capsFile, *capsMode, initParams.Capabilities)
+			if err != nil {
+				logger.Error("Failed to load capabilities", "file", *capsFile, "error", err)
+				return exitFailure
+			}
+			initParams.Capabilities = capabilities
+		} else if cfg.Capabilities != nil {
+			capabilities, err := applyCapabilities(cfg.Capabilities, *capsMode, initParams.Capabilities)
+			if err != nil {
+				logger.Error("Failed to apply config capabilities", "file", configPath, "error", err)
+				return exitFailure
+			}
+			initParams.Capabilities = capabilities
+		}
+	}
+	if !*skipInit && !*dryRun {
+		// Each attempt gets an equal share of the startup timeout so that a
+		// hung server leaves time for the retries.
+		initCtx, initCancel := context.WithTimeout(ctx, startupTimeout)
+		attemptTimeout := startupTimeout / time.Duration(max(*initRetries, 1))
+		client, err = initializeWithRetries(initCtx, client, connect, initParams, *initRetries, attemptTimeout, logger)
+		initCancel()
+		if err != nil {
 			logger.Error("Failed to initialize LSP server", "error", err)
-			os.Exit(1)
+			return exitFailure
 		}
+		initialized = &initParams
 	}
 
-	var params any
-	if *paramsFile != "" {
-		paramsData, err := os.ReadFile(*paramsFile)
+	// Without an initialize of our own, $/setTrace is the only way to
+	// change the trace level of a server.
+	if *trace != "" && initialized == nil {
+		if err := client.SendNotification("$/setTrace", SetTraceParams{Value: *trace}); err != nil {
+			logger.Error("Failed to send $/setTrace", "error", err)
+			return exitFailure
+		}
+	}
+
+	if *showCaps {
+		if initialized == nil {
+			logger.Error("-show-capabilities requires initialization; drop -skip-init and -dry-run")
+			return exitFailure
+		}
+		printCapabilities(client.ServerCapabilities(), output)
+		return exitOK
+	}
+
+	var lastOpenedURI string
+	var opened []TextDocumentItem
+	var changed []TextDocumentContentChangeEvent
+	for _, path := range openFiles {
+		item, err := textDocumentItemFromFile(path)
 		if err != nil {
-			logger.Error("Failed to read params file", "file", *paramsFile, "error", err)
-			os.Exit(1)
+			logger.Error("Failed to read file to open", "file", path, "error", err)
+			return exitFailure
 		}
-		if err := json.Unmarshal(paramsData, &params); err != nil {
-			logger.Error("Failed to parse params file JSON", "file", *paramsFile, "error", err)
-			os.Exit(1)
+		if err := client.DidOpen(item); err != nil {
+			logger.Error("Failed to open document", "file", path, "error", err)
+			return exitFailure
 		}
-	} else if *paramsStr != "" && *paramsStr != "{}" {
-		if err := json.Unmarshal([]byte(*paramsStr), &params); err != nil {
-			logger.Error("Failed to parse params JSON", "error", err)
-			os.Exit(1)
+		lastOpenedURI = item.URI
+		opened = append(opened, item)
+	}
+	if stdinItem != nil {
+		if err := client.DidOpen(*stdinItem); err != nil {
+			logger.Error("Failed to open document", "uri", stdinItem.URI, "error", err)
+			return exitFailure
 		}
+		lastOpenedURI = stdinItem.URI
+		opened = append(opened, *stdinItem)
 	}
 
-	response, err := client.SendRequest(ctx, *method, params)
-	if err != nil {
-		logger.Error("Failed to send request", "method", *method, "error", err)
-		os.Exit(1)
+	for _, c := range changes {
+		if lastOpenedURI == "" {
+			logger.Error("-change requires a document opened with -open")
+			return exitFailure
+		}
+		change, err := parseContentChange(c)
+		if err != nil {
+			logger.Error("Failed to parse change", "error", err)
+			return exitFailure
+		}
+		if err := client.DidChange(lastOpenedURI, change); err != nil {
+			logger.Error("Failed to change document", "uri", lastOpenedURI, "error", err)
+			return exitFailure
+		}
+		changed = append(changed, change)
+	}
+
+	// All events go in one notification, as an editor batches what its
+	// file watcher saw.
+	if len(fileEvents) > 0 {
+		if err := client.SendNotification("workspace/didChangeWatchedFiles", DidChangeWatchedFilesParams{Changes: fileEvents}); err != nil {
+			logger.Error("Failed to send file events", "error", err)
+			return exitFailure
+		}
+	}
+
+	// -file, -pos and -range count columns in bytes, as editors and grep
+	// do; the server counts them in its position encoding.
+	if base, ok := params.(map[string]any); ok && targetPath != "" && *paramsTemplate == "" {
+		if text, ok := output.documentText(PathToFileURI(targetPath)); ok {
+			encodeParamsColumns(base, explicitParams, text, client.PositionEncoding())
+		}
 	}
 
-	printResponse(*method, response, *outputFormat, *quiet)
+	// Close documents once the request is done, even if it failed, so the
+	// server's document state is left clean. -lifecycle closes everything
+	// that was opened.
+	if *lifecycle || len(closeURIs) > 0 {
+		defer func() {
+			uris := closeURIs
+			if *lifecycle {
+				uris = client.OpenDocuments()
+			}
+			for _, uri := range uris {
+				if err := client.DidClose(uri); err != nil {
+					logger.Warn("Failed to close document", "uri", uri, "error", err)
+				}
+			}
+		}()
+	}
+
+	// replay sends the documents opened so far, with their changes, to a
+	// server that hasn't seen them.
+	replay := func(c *LSPClient) error {
+		for _, item := range opened {
+			if err := c.DidOpen(item); err != nil {
+				return err
+			}
+		}
+		if len(changed) > 0 {
+			return c.DidChange(lastOpenedURI, changed...)
+		}
+		return nil
+	}
+
+	// sendRequest is SendRequest with two retries. A -skip-init server
+	// that answers ServerNotInitialized is initialized, sent the opened
+	// documents again and asked once more, unless -strict-skip-init is
+	// given. With -auto-restart, a server that has gone away is started
+	// again, brought back to the same state and the request is retried
+	// once.
+	sendRequest := func(method string, params any) (*JSONRPCResponse, error) {
+		reqCtx, reqCancel := requestContext()
+		response, err := client.SendRequest(reqCtx, method, params)
+		expired := reqCtx.Err() != nil
+		reqCancel()
+		if err == nil && isServerNotInitialized(response) && initialized == nil && !*strictSkipInit && !*dryRun {
+			// -skip-init was given, but the server needs initialization
+			// after all: initialize it once and try again.
+			logger.Warn("Server is not initialized; initializing it and retrying the request (see -strict-skip-init)", "method", method)
+			initCtx, initCancel := context.WithTimeout(ctx, startupTimeout)
+			err := client.Initialize(initCtx, initParams)
+			initCancel()
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize LSP server after ServerNotInitialized: %w", err)
+			}
+			initialized = &initParams
+			// The documents opened before were most likely dropped.
+			if err := replay(client); err != nil {
+				return nil, err
+			}
+			reqCtx, reqCancel = requestContext()
+			defer reqCancel()
+			return client.SendRequest(reqCtx, method, params)
+		}
+		if err == nil || !*autoRestart || !isConnectionLost(err) || expired {
+			return response, err
+		}
+
+		logger.Warn("Lost connection to LSP server, restarting it", "method", method, "error", err)
+		restartCtx, restartCancel := context.WithTimeout(ctx, startupTimeout)
+		restarted, err := restartClient(restartCtx, client, connect, initialized, replay, logger)
+		restartCancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to restart LSP server: %w", err)
+		}
+		client = restarted
+		logger.Warn("LSP server restarted, retrying request", "method", method)
+		reqCtx, reqCancel = requestContext()
+		defer reqCancel()
+		return client.SendRequest(reqCtx, method, params)
+	}
+
+	// applyEdit writes the WorkspaceEdit in the result of response, or in
+	// the part picked by -select, to disk for -apply.
+	applyEdit := func(response *JSONRPCResponse) error {
+		if response.Error != nil {
+			return nil // nothing to apply; the error is already printed
+		}
+		result := response.Result
+		if *selectFlag != "" {
+			var err error
+			if result, err = selectPath(result, *selectFlag); err != nil {
+				return err
+			}
+		}
+		edit, ok := workspaceEdit(result)
+		if !ok && *method == "workspace/executeCommand" {
+			return nil // commands usually send their edits as workspace/applyEdit requests
+		}
+		if !ok {
+			return errors.New("the result is not a WorkspaceEdit or a code action with an edit")
+		}
+		return applyWorkspaceEdit(edit, client.PositionEncoding(), os.Stderr)
+	}
+
+	if *method == "workspace/executeCommand" {
+		client.HandleServerRequest("workspace/applyEdit", applyEditHandler(output, *apply, os.Stderr))
+	}
+
+	var responses []*JSONRPCResponse
+	// invalidInput is set when -pos-stdin or -pos skipped a location.
+	var invalidInput bool
+	switch {
+	case diagnosticsOnly:
+		// publishDiagnostics is a notification; there is nothing to request.
+	case script != nil:
+		for _, step := range script {
+			if step.Notification {
+				if err := client.SendNotification(step.Method, step.Params); err != nil {
+					logger.Error("Failed to send notification", "method", step.Method, "error", err)
+					return exitFailure
+				}
+				continue
+			}
+			response, err := sendRequest(step.Method, step.Params)
+			if err != nil {
+				logger.Error("Failed to send request", "method", step.Method, "error", err)
+				return exitFailure
+			}
+			if response == nil {
+				continue // dry run
+			}
+			responses = append(responses, response)
+			stepOutput := output
+			stepOutput.documentURI = paramsDocumentURI(step.Params)
+			if err := printResponse(step.Method, response, stepOutput); err != nil {
+				logger.Error("Failed to print response", "method", step.Method, "error", err)
+				return exitFailure
+			}
+		}
+	case *renameTo != "":
+		prepare := supportsPrepareRename(client.ServerCapabilities())
+		if !prepare {
+			logger.Debug("Server doesn't support textDocument/prepareRename, renaming directly")
+		}
+		renameMethod, response, err := rename(sendRequest, prepare, renameBase, *renameTo)
+		if errors.Is(err, errRenameNotAllowed) {
+			logger.Error("Cannot rename", "file", targetPath, "line", targetPos.Line+1, "character", targetPos.Character+1, "error", err)
+			return exitFailure
+		}
+		if err != nil {
+			logger.Error("Failed to send request", "method", renameMethod, "error", err)
+			return exitFailure
+		}
+		if *dryRun {
+			return exitOK
+		}
+		responses = append(responses, response)
+		if err := printResponse(renameMethod, response, output); err != nil {
+			logger.Error("Failed to print response", "method", renameMethod, "error", err)
+			return exitFailure
+		}
+		if *apply {
+			if err := applyEdit(response); err != nil {
+				logger.Error("Failed to apply edit", "method", renameMethod, "error", err)
+				return exitFailure
+			}
+		}
+	case *resolveLinks:
+		linksMethod, response, err := resolveDocumentLinks(sendRequest, linkParams)
+		if err != nil {
+			logger.Error("Failed to send request", "method", linksMethod, "error", err)
+			return exitFailure
+		}
+		if response == nil {
+			return exitOK // dry run
+		}
+		responses = append(responses, response)
+		if err := printResponse(linksMethod, response, output); err != nil {
+			logger.Error("Failed to print response", "method", linksMethod, "error", err)
+			return exitFailure
+		}
+	case *callDirection != "":
+		callMethod, response, err := callHierarchy(sendRequest, callBase, *callDirection)
+		if errors.Is(err, errNoCallHierarchyItem) {
+			logger.Error("Cannot show calls", "file", targetPath, "line", targetPos.Line+1, "character", targetPos.Character+1, "error", err)
+			return exitFailure
+		}
+		if err != nil {
+			logger.Error("Failed to send request", "method", callMethod, "error", err)
+			return exitFailure
+		}
+		if response == nil {
+			return exitOK // dry run
+		}
+		responses = append(responses, response)
+		if err := printResponse(callMethod, response, output); err != nil {
+			logger.Error("Failed to print response", "method", callMethod, "error", err)
+			return exitFailure
+		}
+	case *posStdin || len(posLocations) > 0:
+		// Each file is opened before its first location, like -lifecycle
+		// does, and closed once all locations are done, so the server
+		// indexes it only once.
+		var openedURIs []string
+		defer func() {
+			for _, uri := range openedURIs {
+				if err := client.DidClose(uri); err != nil {
+					logger.Warn("Failed to close document", "uri", uri, "error", err)
+				}
+			}
+		}()
+		for _, loc := range posLocations {
+			if loc.Err != nil {
+				logger.Warn("Skipping invalid location", "error", loc.Err)
+				invalidInput = true
+				continue
+			}
+			uri := PathToFileURI(loc.Path)
+			if _, ok := client.DocumentText(uri); !ok && !*dryRun {
+				item, err := textDocumentItemFromFile(loc.Path)
+				if err != nil {
+					logger.Warn("Skipping location in unreadable file", "location", loc.Input, "error", err)
+					invalidInput = true
+					continue
+				}
+				if err := client.DidOpen(item); err != nil {
+					logger.Error("Failed to open document", "file", loc.Path, "error", err)
+					return exitFailure
+				}
+				openedURIs = append(openedURIs, uri)
+				opened = append(opened, item)
+			}
+
+			pos := loc.Pos
+			if text, ok := output.documentText(uri); ok {
+				pos = encodeColumn(text, pos, client.PositionEncoding())
+			}
+			response, err := sendRequest(*method, textDocumentParams(loc.Path, pos.Line, pos.Character))
+			if err != nil {
+				logger.Error("Failed to send request", "method", *method, "location", loc.Input, "error", err)
+				return exitFailure
+			}
+			if response == nil {
+				continue // dry run
+			}
+			responses = append(responses, response)
+			if output.format == "pretty" && !output.quiet {
+				fmt.Printf("%s:%d:%d\n", loc.Path, loc.Pos.Line+1, loc.Pos.Character+1)
+			}
+			locOutput := output
+			locOutput.documentURI = uri
+			if err := printResponse(*method, response, locOutput); err != nil {
+				logger.Error("Failed to print response", "method", *method, "error", err)
+				return exitFailure
+			}
+		}
+	case isBatch:
+		batchCtx, batchCancel := requestContext()
+		responses, err = client.SendBatch(batchCtx, batch)
+		batchCancel()
+		if err != nil {
+			logger.Error("Failed to send batch", "error", err)
+			return exitFailure
+		}
+		if *dryRun {
+			return exitOK
+		}
+
+		for i, response := range responses {
+			if err := printResponse(batch[i].Method, response, output); err != nil {
+				logger.Error("Failed to print response", "method", batch[i].Method, "error", err)
+				return exitFailure
+			}
+		}
+	default:
+		var durations []time.Duration
+		// With -pipeline every request is written up front and the
+		// responses are then read in order, so the server can work on
+		// them concurrently.
+		var pipelined []int
+		pipelineStart := time.Now()
+		if *pipeline {
+			for range *repeat {
+				id, err := client.WriteRequest(*method, params)
+				if err != nil {
+					logger.Error("Failed to send request", "method", *method, "error", err)
+					return exitFailure
+				}
+				pipelined = append(pipelined, id)
+			}
+		}
+		for i := range *repeat {
+			var response *JSONRPCResponse
+			var err error
+			if *pipeline {
+				reqCtx, reqCancel := requestContext()
+				response, err = client.ReadResponseByID(reqCtx, pipelined[i])
+				reqCancel()
+			} else {
+				response, err = sendRequest(*method, params)
+			}
+			if err != nil {
+				logger.Error("Failed to send request", "method", *method, "error", err)
+				return exitFailure
+			}
+			if *dryRun {
+				continue
+			}
+			responses = append(responses, response)
+			durations = append(durations, response.Duration)
+
+			// With -repeat, -quiet leaves only the summary.
+			if *repeat > 1 && *quiet {
+				continue
+			}
+			if err := printResponse(*method, response, output); err != nil {
+				logger.Error("Failed to print response", "method", *method, "error", err)
+				return exitFailure
+			}
+			if *apply {
+				if err := applyEdit(response); err != nil {
+					logger.Error("Failed to apply edit", "method", *method, "error", err)
+					return exitFailure
+				}
+			}
+		}
+		if *dryRun {
+			return exitOK
+		}
+		if *repeat > 1 {
+			fmt.Fprintf(os.Stderr, "%s %v\n", *method, summarizeDurations(durations))
+		}
+		if *pipeline {
+			elapsed := time.Since(pipelineStart)
+			fmt.Fprintf(os.Stderr, "%s %d requests pipelined in %v (%.1f/s)\n", *method, *repeat, elapsed.Round(time.Microsecond), float64(*repeat)/elapsed.Seconds())
+		}
+	}
+
+	if waiter != nil {
+		waitCtx, waitCancel := requestContext()
+		notification, err := waiter.Wait(waitCtx, client)
+		waitCancel()
+		if err != nil {
+			logger.Error("Failed while waiting for notification", "method", *waitFor, "error", err)
+			return exitFailure
+		}
+		printNotification(notification, output)
+	}
+
+	if *lingerFor > 0 {
+		err := linger(ctx, client, *lingerFor, func(n *Notification) {
+			printNotification(n, output)
+		})
+		if err != nil {
+			logger.Error("Failed while lingering", "error", err)
+			return exitFailure
+		}
+	}
+
+	if diagnostics != nil {
+		window := *waitDiags
+		if window == 0 {
+			window = defaultDiagnosticsWindow
+		}
+		waitCtx, waitCancel := context.WithTimeout(ctx, window)
+		err := client.Listen(waitCtx)
+		waitCancel()
+		if err != nil {
+			logger.Error("Failed while waiting for diagnostics", "error", err)
+			return exitFailure
+		}
+
+		printDiagnostics(diagnostics.Diagnostics(), output)
+	}
+
+	// Every assertion is checked against every result, so all that
+	// failed are reported, before the exit statuses that take precedence.
+	assertFailed := false
+	for _, response := range responses {
+		if response.Error != nil {
+			continue
+		}
+		for _, a := range assertions {
+			if err := a.check(response.Result); err != nil {
+				logger.Error("Assertion failed", "assert", a.source, "error", err)
+				assertFailed = true
+			}
+		}
+	}
+
+	if invalidInput {
+		return exitFailure
+	}
+	for _, response := range responses {
+		if response.Error != nil {
+			return exitResponseError
+		}
+	}
+	if *failOnNull {
+		for _, response := range responses {
+			if isEmptyResult(response.Result) {
+				return exitNullResult
+			}
+		}
+	}
+	if assertFailed {
+		return exitAssertFailed
+	}
+	return exitOK
 }
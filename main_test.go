@@ -1,17 +1,30 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestJSONRPCRequest_Marshal(t *testing.T) {
+	id := 1
 	req := JSONRPCRequest{
 		JSONRPC: "2.0",
-		ID:      1,
+		ID:      &id,
 		Method:  "textDocument/hover",
 		Params: map[string]interface{}{
 			"textDocument": map[string]interface{}{
@@ -37,8 +50,8 @@ func TestJSONRPCRequest_Marshal(t *testing.T) {
 	if unmarshaled.JSONRPC != "2.0" {
 		t.Errorf("Expected JSONRPC 2.0, got %s", unmarshaled.JSONRPC)
 	}
-	if unmarshaled.ID != 1 {
-		t.Errorf("Expected ID 1, got %d", unmarshaled.ID)
+	if unmarshaled.ID == nil || *unmarshaled.ID != 1 {
+		t.Errorf("Expected ID 1, got %v", unmarshaled.ID)
 	}
 	if unmarshaled.Method != "textDocument/hover" {
 		t.Errorf("Expected method textDocument/hover, got %s", unmarshaled.Method)
@@ -65,8 +78,8 @@ func TestJSONRPCResponse_Unmarshal(t *testing.T) {
 	if response.JSONRPC != "2.0" {
 		t.Errorf("Expected JSONRPC 2.0, got %s", response.JSONRPC)
 	}
-	if response.ID != 1 {
-		t.Errorf("Expected ID 1, got %d", response.ID)
+	if !response.ID.Matches(1) {
+		t.Errorf("Expected ID 1, got %v", response.ID)
 	}
 	if response.Result == nil {
 		t.Error("Expected result to be non-nil")
@@ -96,35 +109,222 @@ func TestJSONRPCResponse_Error(t *testing.T) {
 	}
 }
 
+func TestRequestID_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		name   string
+		json   string
+		want   RequestID
+		intID  int
+		hasInt bool
+	}{
+		{"number", `7`, NumericID(7), 7, true},
+		{"string", `"abc"`, StringID("abc"), 0, false},
+		{"numeric string", `"7"`, StringID("7"), 7, true},
+		{"null", `null`, RequestID{null: true}, 0, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var response JSONRPCResponse
+			if err := json.Unmarshal([]byte(`{"jsonrpc":"2.0","id":`+tc.json+`,"result":null}`), &response); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			if response.ID != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, response.ID)
+			}
+			if n, ok := response.ID.Int(); ok != tc.hasInt || n != tc.intID {
+				t.Errorf("Expected Int() = %d, %v, got %d, %v", tc.intID, tc.hasInt, n, ok)
+			}
+
+			data, err := json.Marshal(response.ID)
+			if err != nil || string(data) != tc.json {
+				t.Errorf("Expected %s to marshal back unchanged, got %s (err=%v)", tc.json, data, err)
+			}
+		})
+	}
+
+	var response JSONRPCResponse
+	if err := json.Unmarshal([]byte(`{"jsonrpc":"2.0","id":1.5}`), &response); err == nil {
+		t.Error("Expected an error for a fractional id")
+	}
+}
+
+func TestReadResponse_StringID(t *testing.T) {
+	client, serverConn := newPipeClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		content, err := readTestFrame(reader)
+		if err != nil {
+			return
+		}
+		var request JSONRPCRequest
+		json.Unmarshal(content, &request)
+		// A stray string id first, then the reply echoing our id as a string.
+		io.WriteString(serverConn, frameString(`{"jsonrpc":"2.0","id":"other","result":"wrong"}`))
+		io.WriteString(serverConn, frameString(fmt.Sprintf(`{"jsonrpc":"2.0","id":"%d","result":"right"}`, *request.ID)))
+	}()
+
+	response, err := client.SendRequest(ctx, "test/echo", nil)
+	if err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+	if response.Result != "right" || response.ID != StringID("1") {
+		t.Errorf("Expected the string id reply, got id %v result %v", response.ID, response.Result)
+	}
+}
+
+func frameString(body string) string {
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
 func TestLSPClient_IDIncrement(t *testing.T) {
 	client := &LSPClient{id: 1}
 
 	// Simulate creating multiple requests
+	id1 := client.id
 	req1 := JSONRPCRequest{
 		JSONRPC: "2.0",
-		ID:      client.id,
+		ID:      &id1,
 		Method:  "initialize",
 	}
 	client.id++
 
+	id2 := client.id
 	req2 := JSONRPCRequest{
 		JSONRPC: "2.0",
-		ID:      client.id,
+		ID:      &id2,
 		Method:  "textDocument/hover",
 	}
 	client.id++
 
-	if req1.ID != 1 {
-		t.Errorf("Expected first request ID to be 1, got %d", req1.ID)
+	if *req1.ID != 1 {
+		t.Errorf("Expected first request ID to be 1, got %d", *req1.ID)
 	}
-	if req2.ID != 2 {
-		t.Errorf("Expected second request ID to be 2, got %d", req2.ID)
+	if *req2.ID != 2 {
+		t.Errorf("Expected second request ID to be 2, got %d", *req2.ID)
 	}
 	if client.id != 3 {
 		t.Errorf("Expected client ID to be 3 after two requests, got %d", client.id)
 	}
 }
 
+// readTestFrame reads one Content-Length framed message from r.
+func readTestFrame(r *bufio.Reader) ([]byte, error) {
+	var contentLength int
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if s, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+			contentLength, _ = strconv.Atoi(strings.TrimSpace(s))
+		}
+	}
+	content := make([]byte, contentLength)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// writeTestFrame writes v to w as a Content-Length framed message.
+func writeTestFrame(w io.Writer, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// newPipeClient returns a client and the server end of an in-memory
+// connection to it.
+func newPipeClient(t *testing.T) (*LSPClient, net.Conn) {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+
+	return &LSPClient{
+		transport: clientConn,
+		reader:    bufio.NewReader(clientConn),
+		id:        1,
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}, serverConn
+}
+
+// newEchoServerClient returns a client connected to an in-process server that
+// answers every request with its own ID as the result.
+func newEchoServerClient(t *testing.T) *LSPClient {
+	t.Helper()
+	client, serverConn := newPipeClient(t)
+
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		for {
+			content, err := readTestFrame(reader)
+			if err != nil {
+				return
+			}
+			var request JSONRPCRequest
+			if err := json.Unmarshal(content, &request); err != nil || request.ID == nil {
+				continue
+			}
+			writeTestFrame(serverConn, JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(*request.ID), Result: *request.ID})
+		}
+	}()
+
+	return client
+}
+
+func TestLSPClient_ConcurrentSendRequest(t *testing.T) {
+	client := newEchoServerClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const n = 100
+	ids := make(chan int, n)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := client.SendRequest(ctx, "test/echo", nil)
+			if err != nil {
+				t.Errorf("SendRequest failed: %v", err)
+				return
+			}
+			id, _ := response.ID.Int()
+			if result, ok := response.Result.(float64); !ok || int(result) != id {
+				t.Errorf("Response %v carried result %v from another request", response.ID, response.Result)
+			}
+			ids <- id
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("Duplicate request ID %d", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != n {
+		t.Errorf("Expected %d unique IDs, got %d", n, len(seen))
+	}
+}
+
 func TestContentLengthParsing(t *testing.T) {
 	// Test the logic used in ReadResponse for parsing Content-Length header
 	testCases := []struct {
@@ -168,6 +368,41 @@ func TestContentLengthParsing(t *testing.T) {
 	}
 }
 
+func TestInitializeParams_InitializationOptions(t *testing.T) {
+	params := newInitializeParams("file:///test/project")
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "initializationOptions") {
+		t.Errorf("Expected initializationOptions to be omitted, got %s", data)
+	}
+
+	params.InitializationOptions = map[string]any{"build.directoryFilters": []string{"-node_modules"}}
+	data, err = json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"initializationOptions":{"build.directoryFilters":["-node_modules"]}`) {
+		t.Errorf("Expected initializationOptions in %s", data)
+	}
+}
+
+func TestInitializeParams_ClientInfo(t *testing.T) {
+	params := newInitializeParams("file:///test/project")
+	if params.ClientInfo == nil || params.ClientInfo.Name != "clsp" || params.ClientInfo.Version == "" {
+		t.Fatalf("Expected clsp and its version as clientInfo, got %+v", params.ClientInfo)
+	}
+	params.ClientInfo.Name = "Visual Studio Code"
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"clientInfo":{"name":"Visual Studio Code","version":`) {
+		t.Errorf("Expected clientInfo in %s", data)
+	}
+}
+
 func TestInitializeParams(t *testing.T) {
 	// Test the initialize parameters structure
 	params := map[string]interface{}{
@@ -225,3 +460,720 @@ func TestInitializeParams(t *testing.T) {
 		t.Error("Expected snippetSupport to be true")
 	}
 }
+
+func TestSendRequest_CancelOnTimeout(t *testing.T) {
+	client, serverConn := newPipeClient(t)
+
+	type received struct {
+		method string
+		id     int
+	}
+	messages := make(chan received, 2)
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		for range 2 {
+			content, err := readTestFrame(reader)
+			if err != nil {
+				return
+			}
+			var message struct {
+				Method string `json:"method"`
+				ID     *int   `json:"id"`
+				Params struct {
+					ID int `json:"id"`
+				} `json:"params"`
+			}
+			json.Unmarshal(content, &message)
+			if message.ID != nil {
+				messages <- received{message.Method, *message.ID}
+			} else {
+				messages <- received{message.Method, message.Params.ID}
+			}
+		}
+	}()
+
+	// Use up an ID so the cancelled request isn't the first one.
+	client.nextID()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.SendRequest(ctx, "textDocument/hover", nil); err == nil {
+		t.Fatal("Expected SendRequest to fail when the context times out")
+	}
+
+	request := <-messages
+	if request.method != "textDocument/hover" || request.id != 2 {
+		t.Fatalf("Unexpected request %+v", request)
+	}
+	select {
+	case cancelled := <-messages:
+		if cancelled.method != "$/cancelRequest" || cancelled.id != request.id {
+			t.Errorf("Expected $/cancelRequest for id %d, got %+v", request.id, cancelled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a $/cancelRequest notification")
+	}
+}
+
+func TestReadFrame_ContentType(t *testing.T) {
+	testCases := []struct {
+		name        string
+		contentType string
+		wantErr     bool
+	}{
+		{"absent", "", false},
+		{"default", "application/vscode-jsonrpc; charset=utf-8", false},
+		{"legacy utf8", "application/vscode-jsonrpc; charset=utf8", false},
+		{"uppercase", "application/vscode-jsonrpc; charset=UTF-8", false},
+		{"no charset", "application/vscode-jsonrpc", false},
+		{"utf-16", "application/vscode-jsonrpc; charset=utf-16", true},
+		{"latin1", "application/vscode-jsonrpc; charset=iso-8859-1", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"jsonrpc":"2.0","id":1,"result":null}`
+			header := fmt.Sprintf("Content-Length: %d\r\n", len(body))
+			if tc.contentType != "" {
+				header += "Content-Type: " + tc.contentType + "\r\n"
+			}
+			next := `{"jsonrpc":"2.0","id":2,"result":null}`
+			stream := fmt.Sprintf("%s\r\n%sContent-Length: %d\r\n\r\n%s", header, body, len(next), next)
+			client := &LSPClient{reader: bufio.NewReader(strings.NewReader(stream))}
+
+			content, err := client.readFrame()
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "charset") {
+					t.Errorf("Expected a charset error, got %v", err)
+				}
+			} else if err != nil || string(content) != body {
+				t.Errorf("Expected %s, got %s (err=%v)", body, content, err)
+			}
+
+			// The rejected body must not leak into the next message.
+			content, err = client.readFrame()
+			if err != nil || string(content) != next {
+				t.Errorf("Expected the next message %s, got %s (err=%v)", next, content, err)
+			}
+		})
+	}
+}
+
+func TestReadFrame_Headers(t *testing.T) {
+	body := `{"jsonrpc":"2.0","id":1,"result":"ok"}`
+	length := strconv.Itoa(len(body))
+
+	testCases := []struct {
+		name    string
+		stream  string
+		wantErr string
+	}{
+		{"plain", "Content-Length: " + length + "\r\n\r\n" + body, ""},
+		{"leading blank lines", "\r\n\n\r\nContent-Length: " + length + "\r\n\r\n" + body, ""},
+		{"content type and odd case", "content-length:" + length + "\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n" + body, ""},
+		{"unknown header", "X-Custom: 1\r\nContent-Length: " + length + "\r\n\r\n" + body, ""},
+		{"LF only", "Content-Length: " + length + "\n\n" + body, ""},
+		{"LF only with content type", "Content-Length: " + length + "\nContent-Type: application/vscode-jsonrpc; charset=utf-8\n\n" + body, ""},
+		{"LF only with trailing spaces", "Content-Length: " + length + "  \n\n" + body, ""},
+		{"bare LF terminator", "Content-Length: " + length + "\r\n\n" + body, ""},
+		{"bare LF header", "Content-Length: " + length + "\n\r\n" + body, ""},
+		{"no blank line", "Content-Length: " + length + "\n" + body, ""},
+		{"no blank line after CRLF", "Content-Length: " + length + "\r\n" + body, ""},
+		{"malformed header", "Content-Length " + length + "\r\n\r\n" + body, "malformed header"},
+		{"no Content-Length", "Content-Type: application/vscode-jsonrpc\r\n\r\n" + body, "no Content-Length"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// One byte per read with the smallest bufio buffer puts every
+			// possible split, including between \r and \n, on a boundary.
+			client := &LSPClient{reader: bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(tc.stream)), 16)}
+			content, err := client.readFrame()
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil || string(content) != body {
+				t.Errorf("Expected %s, got %s (err=%v)", body, content, err)
+			}
+		})
+	}
+}
+
+func TestReadFrame_LFOnlyStream(t *testing.T) {
+	// Consecutive LF-framed messages must each stop exactly at their
+	// body, leaving the next message's headers intact.
+	var stream strings.Builder
+	var bodies []string
+	for i := range 3 {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"line\\n%d"}`, i, i)
+		bodies = append(bodies, body)
+		fmt.Fprintf(&stream, "Content-Length: %d\n\n%s", len(body), body)
+	}
+
+	client := &LSPClient{reader: bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(stream.String())), 16)}
+	for _, expected := range bodies {
+		content, err := client.readFrame()
+		if err != nil || string(content) != expected {
+			t.Fatalf("Expected %s, got %s (err=%v)", expected, content, err)
+		}
+	}
+}
+
+func TestReadFrame_SlowReaderStream(t *testing.T) {
+	var stream strings.Builder
+	var bodies []string
+	for i := range 5 {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"%s"}`, i, strings.Repeat("x", i*7))
+		bodies = append(bodies, body)
+		fmt.Fprintf(&stream, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+
+	client := &LSPClient{reader: bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(stream.String())), 16)}
+	for _, expected := range bodies {
+		content, err := client.readFrame()
+		if err != nil || string(content) != expected {
+			t.Fatalf("Expected %s, got %s (err=%v)", expected, content, err)
+		}
+	}
+	if _, err := client.readFrame(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected EOF after the last message, got %v", err)
+	}
+}
+
+func TestReadFrame_MaxMessageSize(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limit   int
+		length  int
+		wantErr bool
+	}{
+		{"default limit rejects 2GB", 0, 2 << 30, true},
+		{"custom limit rejects", 16, 17, true},
+		{"custom limit accepts", 64, 38, false},
+		{"negative length", 0, -1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"jsonrpc":"2.0","id":1,"result":null}`
+			stream := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", tc.length, body)
+			client := &LSPClient{reader: bufio.NewReader(strings.NewReader(stream)), maxMessageSize: tc.limit}
+
+			content, err := client.readFrame()
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "size limit") {
+					t.Errorf("Expected a size limit error, got %v", err)
+				}
+			} else if err != nil || string(content) != body {
+				t.Errorf("Expected %s, got %s (err=%v)", body, content, err)
+			}
+		})
+	}
+}
+
+func TestForwardStderr(t *testing.T) {
+	var logs strings.Builder
+	client := &LSPClient{
+		stderr:     io.NopCloser(strings.NewReader("starting server\r\n\nlast line without newline")),
+		stderrDone: make(chan struct{}),
+		logger:     slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+
+	client.forwardStderr()
+
+	select {
+	case <-client.stderrDone:
+	default:
+		t.Error("Expected stderrDone to be closed after EOF")
+	}
+	for _, expected := range []string{`server-stderr="starting server"`, `server-stderr="last line without newline"`} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("Expected logs to contain %s, got:\n%s", expected, logs.String())
+		}
+	}
+	if strings.Count(logs.String(), "server-stderr") != 2 {
+		t.Errorf("Expected blank lines to be skipped, got:\n%s", logs.String())
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var out strings.Builder
+	logger, err := newLogger(&out, "json", slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("hidden")
+	logger.Info("shown", "method", "textDocument/hover")
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(out.String()), &entry); err != nil {
+		t.Fatalf("Expected a single JSON log line, got %q: %v", out.String(), err)
+	}
+	if entry["msg"] != "shown" || entry["method"] != "textDocument/hover" {
+		t.Errorf("Unexpected log entry %v", entry)
+	}
+
+	if _, err := newLogger(&out, "xml", slog.LevelInfo); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestSendRequest_Duration(t *testing.T) {
+	client := newEchoServerClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := client.SendRequest(ctx, "test/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Duration <= 0 {
+		t.Errorf("Expected a positive duration, got %v", response.Duration)
+	}
+
+	data, err := json.Marshal(timedResponse{JSONRPCResponse: response, DurationMs: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope map[string]any
+	json.Unmarshal(data, &envelope)
+	if envelope["durationMs"] != float64(12) || envelope["id"] != float64(1) {
+		t.Errorf("Expected the response fields plus durationMs, got %s", data)
+	}
+	if _, ok := envelope["Duration"]; ok {
+		t.Errorf("Expected Duration not to be serialized, got %s", data)
+	}
+}
+
+func TestNewServerCmd_Env(t *testing.T) {
+	t.Setenv("CLSP_TEST_INHERITED", "kept")
+	t.Setenv("GOFLAGS", "-mod=mod")
+
+	cmd := newServerCmd(context.Background(), ServerCommand{
+		Path: "gopls",
+		Args: []string{"serve"},
+		Env:  []string{"GOFLAGS=-tags=integration", "GOPLS_TEST=1"},
+	})
+
+	lookup := func(key string) string {
+		value := ""
+		for _, kv := range cmd.Env {
+			if k, v, _ := strings.Cut(kv, "="); k == key {
+				value = v // the last value wins, as in exec
+			}
+		}
+		return value
+	}
+	if got := lookup("GOPLS_TEST"); got != "1" {
+		t.Errorf("Expected GOPLS_TEST=1, got %q", got)
+	}
+	if got := lookup("GOFLAGS"); got != "-tags=integration" {
+		t.Errorf("Expected GOFLAGS to be overridden, got %q", got)
+	}
+	if got := lookup("CLSP_TEST_INHERITED"); got != "kept" {
+		t.Errorf("Expected inherited variables to be kept, got %q", got)
+	}
+
+	if cmd := newServerCmd(context.Background(), ServerCommand{Path: "gopls"}); cmd.Env != nil {
+		t.Error("Expected no explicit environment without -env")
+	}
+}
+
+func TestNewLSPClient_InvalidDir(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+
+	_, err := NewLSPClient(context.Background(), ServerCommand{Path: "true", Dir: dir + "/missing"}, logger)
+	if err == nil || !strings.Contains(err.Error(), "working directory") {
+		t.Errorf("Expected a working directory error, got %v", err)
+	}
+
+	if cmd := newServerCmd(context.Background(), ServerCommand{Path: "gopls", Dir: dir}); cmd.Dir != dir {
+		t.Errorf("Expected cmd.Dir %s, got %s", dir, cmd.Dir)
+	}
+}
+
+func TestNewLSPClientUnix(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "lsp.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("Unix sockets not available: %v", err)
+	}
+	defer listener.Close()
+	initialized := make(chan int, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serveInitialize(conn, 0, initialized)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := NewLSPClientUnix(ctx, path, logger)
+	if err != nil {
+		t.Fatalf("NewLSPClientUnix failed: %v", err)
+	}
+	defer client.Abort()
+	if err := client.Initialize(ctx, newInitializeParams("file:///src")); err != nil {
+		t.Fatalf("Initialize over the socket failed: %v", err)
+	}
+	select {
+	case <-initialized:
+	case <-ctx.Done():
+		t.Fatal("Expected the server to receive initialized")
+	}
+
+	if _, err := NewLSPClientUnix(ctx, filepath.Join(t.TempDir(), "missing.sock"), logger); err == nil {
+		t.Error("Expected an error for a socket path that doesn't exist")
+	}
+}
+
+func TestWriteJSONLine(t *testing.T) {
+	var out strings.Builder
+	results := []any{
+		map[string]any{"contents": "line one\nline two"},
+		[]any{1, 2, 3},
+	}
+	for _, r := range results {
+		if err := writeJSONLine(&out, &JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(1), Result: r}); err != nil {
+			t.Fatalf("writeJSONLine failed: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(results) {
+		t.Fatalf("Expected %d lines, got %d: %q", len(results), len(lines), out.String())
+	}
+	for _, line := range lines {
+		var resp JSONRPCResponse
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Errorf("Line is not valid JSON: %q: %v", line, err)
+		}
+	}
+}
+
+func TestDryRunClient(t *testing.T) {
+	var out strings.Builder
+	client := NewDryRunClient(&out, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	response, err := client.SendRequest(context.Background(), "textDocument/hover", map[string]any{"x": 1})
+	if err != nil || response != nil {
+		t.Fatalf("Expected a nil response and no error, got %v, %v", response, err)
+	}
+	if err := client.SendNotification("initialized", map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	request := `{"jsonrpc":"2.0","id":1,"method":"textDocument/hover","params":{"x":1}}`
+	notification := `{"jsonrpc":"2.0","method":"initialized","params":{}}`
+	expected := frameString(request) + frameString(notification)
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestClose_WaitsForShutdownResponse(t *testing.T) {
+	for _, shutdownErr := range []bool{false, true} {
+		t.Run(fmt.Sprintf("error=%v", shutdownErr), func(t *testing.T) {
+			client, serverConn := newPipeClient(t)
+			var logs strings.Builder
+			client.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+			done := make(chan error, 1)
+			go func() {
+				reader := bufio.NewReader(serverConn)
+				content, err := readTestFrame(reader)
+				if err != nil {
+					done <- err
+					return
+				}
+				var request JSONRPCRequest
+				json.Unmarshal(content, &request)
+				if request.Method != "shutdown" {
+					done <- fmt.Errorf("expected shutdown first, got %s", request.Method)
+					return
+				}
+
+				// Nothing may arrive before the shutdown reply is sent.
+				serverConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+				if _, err := reader.Peek(1); err == nil {
+					done <- errors.New("received a message before replying to shutdown")
+					return
+				}
+				serverConn.SetReadDeadline(time.Time{})
+
+				reply := JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(*request.ID)}
+				if shutdownErr {
+					reply.Error = &JSONRPCError{Code: -32603, Message: "boom"}
+				}
+				writeTestFrame(serverConn, reply)
+
+				content, err = readTestFrame(reader)
+				if err != nil {
+					done <- err
+					return
+				}
+				json.Unmarshal(content, &request)
+				if request.Method != "exit" {
+					done <- fmt.Errorf("expected exit after shutdown, got %s", request.Method)
+					return
+				}
+				done <- nil
+			}()
+
+			client.Close()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			if warned := strings.Contains(logs.String(), "boom"); warned != shutdownErr {
+				t.Errorf("Expected warning logged = %v, got logs: %s", shutdownErr, logs.String())
+			}
+		})
+	}
+}
+
+func TestErrorCodeName(t *testing.T) {
+	testCases := map[int]string{
+		-32601: "MethodNotFound",
+		-32602: "InvalidParams",
+		-32002: "ServerNotInitialized",
+		-32800: "RequestCancelled",
+		-1:     "Unknown",
+	}
+	for code, expected := range testCases {
+		if got := errorCodeName(code); got != expected {
+			t.Errorf("errorCodeName(%d) = %s, expected %s", code, got, expected)
+		}
+	}
+}
+
+func TestWithErrorName(t *testing.T) {
+	rpcErr := &JSONRPCError{Code: -32601, Message: "method not found"}
+	response := &JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(3), Error: rpcErr}
+
+	for _, envelope := range []any{response, timedResponse{JSONRPCResponse: response, DurationMs: 1}} {
+		data, err := json.Marshal(withErrorName(envelope, rpcErr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := `"error":{"code":-32601,"message":"method not found","codeName":"MethodNotFound"}`
+		if !strings.Contains(string(data), expected) || strings.Count(string(data), `"error"`) != 1 {
+			t.Errorf("Expected %s in %s", expected, data)
+		}
+	}
+}
+
+func TestFormatErrorData(t *testing.T) {
+	stack := "panic: nil map\n\tgoroutine 1\n"
+	if got := formatErrorData(stack, false); got != "panic: nil map\n\tgoroutine 1" {
+		t.Errorf("Expected string data as text, got %q", got)
+	}
+	if got := formatErrorData(map[string]any{"uri": "file:///a.go"}, false); got != "{\n  \"uri\": \"file:///a.go\"\n}" {
+		t.Errorf("Expected other data as indented JSON, got %q", got)
+	}
+}
+
+func TestInitialize_StoresServerCapabilities(t *testing.T) {
+	client, serverConn := newPipeClient(t)
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		content, err := readTestFrame(reader)
+		if err != nil {
+			return
+		}
+		var request JSONRPCRequest
+		json.Unmarshal(content, &request)
+		writeTestFrame(serverConn, JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(*request.ID), Result: map[string]any{
+			"capabilities": map[string]any{"hoverProvider": true},
+			"serverInfo":   map[string]any{"name": "fake", "version": "1.0"},
+		}})
+		readTestFrame(reader) // initialized
+	}()
+
+	if client.ServerCapabilities() != nil {
+		t.Error("Expected no capabilities before Initialize")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Initialize(ctx, newInitializeParams("file:///src")); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	if hover, _ := client.ServerCapabilities()["hoverProvider"].(bool); !hover {
+		t.Errorf("Expected hoverProvider in %v", client.ServerCapabilities())
+	}
+	if info := client.initializeResult.ServerInfo; info == nil || info.Name != "fake" || info.Version != "1.0" {
+		t.Errorf("Expected serverInfo fake 1.0, got %+v", info)
+	}
+}
+
+func TestJSONRPCVersion(t *testing.T) {
+	testCases := []struct {
+		version  string
+		expected string
+	}{
+		{"", `{"jsonrpc":"2.0","id":1,"method":"test/echo"}`},
+		{"2.1", `{"jsonrpc":"2.1","id":1,"method":"test/echo"}`},
+		{omitJSONRPCVersion, `{"id":1,"method":"test/echo"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.version, func(t *testing.T) {
+			var out strings.Builder
+			client := NewDryRunClient(&out, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			client.jsonrpcVersion = tc.version
+			if _, err := client.SendRequest(context.Background(), "test/echo", nil); err != nil {
+				t.Fatal(err)
+			}
+			if expected := frameString(tc.expected); out.String() != expected {
+				t.Errorf("Expected %q, got %q", expected, out.String())
+			}
+		})
+	}
+}
+
+func TestLSPClient_StartID(t *testing.T) {
+	client, server := newFakeServer(t)
+	client.id = 42
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SendRequest(ctx, "test/method", nil); err != nil {
+		t.Fatal(err)
+	}
+	if next := client.NextID(); next != 43 {
+		t.Errorf("Expected next id 43, got %d", next)
+	}
+
+	client.transport.Close()
+	if messages := server.messages(); *messages[0].ID != 42 {
+		t.Errorf("Expected the first request to use id 42, got %d", *messages[0].ID)
+	}
+}
+
+// runClsp runs clsp in this process with args, after -server and the
+// flags that start the answering helper server, and returns its exit code
+// and what it wrote to stdout and stderr.
+func runClsp(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	savedArgs, savedFlags, savedStdout, savedStderr := os.Args, flag.CommandLine, os.Stdout, os.Stderr
+	defer func() {
+		os.Args, flag.CommandLine, os.Stdout, os.Stderr = savedArgs, savedFlags, savedStdout, savedStderr
+	}()
+
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+
+	os.Args = append([]string{"clsp",
+		"-server", savedArgs[0],
+		"-arg", "-test.run=^TestHelperServer$",
+		"-env", "CLSP_HELPER_SERVER=answering",
+	}, args...)
+	flag.CommandLine = flag.NewFlagSet("clsp", flag.ContinueOnError)
+	os.Stdout, os.Stderr = stdout, stderr
+	code := run()
+	os.Stdout, os.Stderr = savedStdout, savedStderr
+
+	out, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	errOut, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(out), string(errOut)
+}
+
+const helperHoverParams = `{"textDocument":{"uri":"file:///src/a.go"},"position":{"line":0,"character":0}}`
+
+func TestRun_ExitStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected int
+	}{
+		{"result", []string{"-method", "textDocument/hover", "-params", helperHoverParams}, exitOK},
+		{"error response", []string{"-method", "textDocument/definition", "-params", helperHoverParams}, exitResponseError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runClsp(t, tt.args...)
+			if code != tt.expected {
+				t.Errorf("Expected exit status %d, got %d\nstdout: %s\nstderr: %s", tt.expected, code, stdout, stderr)
+			}
+		})
+	}
+}
+
+func TestRun_OutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	code, stdout, stderr := runClsp(t, "-method", "textDocument/hover", "-params", helperHoverParams, "-format", "raw", "-output-file", path)
+	if code != exitOK {
+		t.Fatalf("Expected exit status 0, got %d: %s", code, stderr)
+	}
+	if stdout != "" {
+		t.Errorf("Expected nothing on stdout, got %q", stdout)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"contents":"hover text"}` + "\n"; string(data) != expected {
+		t.Errorf("Expected %q in the output file, got %q", expected, data)
+	}
+}
+
+func TestRun_EchoID(t *testing.T) {
+	// initialize takes id 1, so the hover request is 2.
+	code, stdout, stderr := runClsp(t, "-method", "textDocument/hover", "-params", helperHoverParams, "-echo-id")
+	if code != exitOK {
+		t.Fatalf("Expected exit status 0, got %d: %s", code, stderr)
+	}
+	if header, _, _ := strings.Cut(stdout, "\n"); header != "Response for textDocument/hover [id=2]:" {
+		t.Errorf("Expected the id in the header, got %q", header)
+	}
+
+	_, stdout, _ = runClsp(t, "-method", "textDocument/hover", "-params", helperHoverParams)
+	if header, _, _ := strings.Cut(stdout, "\n"); header != "Response for textDocument/hover:" {
+		t.Errorf("Expected no id without -echo-id, got %q", header)
+	}
+}
+
+func TestRun_QuietErrors(t *testing.T) {
+	args := []string{"-method", "textDocument/definition", "-params", helperHoverParams, "-verbose"}
+	if _, _, stderr := runClsp(t, args...); stderr == "" {
+		t.Fatal("Expected -verbose to log to stderr")
+	}
+
+	code, stdout, stderr := runClsp(t, append(args, "-quiet-errors")...)
+	if code != exitResponseError {
+		t.Errorf("Expected exit status 2, got %d", code)
+	}
+	if stderr != "" {
+		t.Errorf("Expected no logs, got %q", stderr)
+	}
+	if !strings.Contains(stdout, "no definition here") {
+		t.Errorf("Expected the error response on stdout, got %q", stdout)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// lspMethod describes a method clsp knows about.
+type lspMethod struct {
+	Name         string `json:"name"`
+	Category     string `json:"category"`
+	Description  string `json:"description"`
+	Notification bool   `json:"notification"`
+}
+
+// commonMethods lists the known methods in the order -list-methods prints
+// them.
+var commonMethods = []lspMethod{
+	{"textDocument/hover", "Text Document", "Get hover information", false},
+	{"textDocument/completion", "Text Document", "Get code completion", false},
+	{"textDocument/signatureHelp", "Text Document", "Get signature help", false},
+	{"textDocument/declaration", "Text Document", "Go to declaration", false},
+	{"textDocument/definition", "Text Document", "Go to definition", false},
+	{"textDocument/typeDefinition", "Text Document", "Go to type definition", false},
+	{"textDocument/implementation", "Text Document", "Find implementations", false},
+	{"textDocument/references", "Text Document", "Find references", false},
+	{"textDocument/documentHighlight", "Text Document", "Highlight symbol occurrences", false},
+	{"textDocument/documentSymbol", "Text Document", "Get document symbols", false},
+	{"textDocument/documentLink", "Text Document", "Get document links", false},
+	{"textDocument/documentColor", "Text Document", "Get color references", false},
+	{"textDocument/colorPresentation", "Text Document", "Get color presentations", false},
+	{"textDocument/formatting", "Text Document", "Format document", false},
+	{"textDocument/rangeFormatting", "Text Document", "Format a range", false},
+	{"textDocument/onTypeFormatting", "Text Document", "Format while typing", false},
+	{"textDocument/codeAction", "Text Document", "Get code actions", false},
+	{"textDocument/codeLens", "Text Document", "Get code lenses", false},
+	{"textDocument/rename", "Text Document", "Rename symbol", false},
+	{"textDocument/prepareRename", "Text Document", "Check if symbol can be renamed", false},
+	{"textDocument/foldingRange", "Text Document", "Get folding ranges", false},
+	{"textDocument/selectionRange", "Text Document", "Get selection ranges", false},
+	{"textDocument/linkedEditingRange", "Text Document", "Get linked editing ranges", false},
+	{"textDocument/moniker", "Text Document", "Get symbol monikers", false},
+	{"textDocument/inlayHint", "Text Document", "Get inlay hints", false},
+	{"textDocument/inlineValue", "Text Document", "Get inline values", false},
+	{"textDocument/semanticTokens/full", "Text Document", "Get semantic tokens", false},
+	{"textDocument/semanticTokens/full/delta", "Text Document", "Get semantic token changes", false},
+	{"textDocument/semanticTokens/range", "Text Document", "Get semantic tokens for a range", false},
+	{"textDocument/diagnostic", "Text Document", "Pull document diagnostics", false},
+	{"textDocument/willSaveWaitUntil", "Text Document", "Get edits to apply before saving", false},
+	{"textDocument/didOpen", "Text Document", "Document opened", true},
+	{"textDocument/didChange", "Text Document", "Document changed", true},
+	{"textDocument/willSave", "Text Document", "Document will be saved", true},
+	{"textDocument/didSave", "Text Document", "Document saved", true},
+	{"textDocument/didClose", "Text Document", "Document closed", true},
+
+	{"textDocument/prepareCallHierarchy", "Hierarchy", "Prepare call hierarchy", false},
+	{"callHierarchy/incomingCalls", "Hierarchy", "Get incoming calls", false},
+	{"callHierarchy/outgoingCalls", "Hierarchy", "Get outgoing calls", false},
+	{"textDocument/prepareTypeHierarchy", "Hierarchy", "Prepare type hierarchy", false},
+	{"typeHierarchy/supertypes", "Hierarchy", "Get supertypes", false},
+	{"typeHierarchy/subtypes", "Hierarchy", "Get subtypes", false},
+
+	{"completionItem/resolve", "Resolve", "Resolve a completion item", false},
+	{"codeAction/resolve", "Resolve", "Resolve a code action", false},
+	{"codeLens/resolve", "Resolve", "Resolve a code lens", false},
+	{"documentLink/resolve", "Resolve", "Resolve a document link", false},
+	{"inlayHint/resolve", "Resolve", "Resolve an inlay hint", false},
+	{"workspaceSymbol/resolve", "Resolve", "Resolve a workspace symbol", false},
+
+	{"workspace/symbol", "Workspace", "Find workspace symbols", false},
+	{"workspace/executeCommand", "Workspace", "Execute command", false},
+	{"workspace/diagnostic", "Workspace", "Pull workspace diagnostics", false},
+	{"workspace/willCreateFiles", "Workspace", "Get edits before files are created", false},
+	{"workspace/willRenameFiles", "Workspace", "Get edits before files are renamed", false},
+	{"workspace/willDeleteFiles", "Workspace", "Get edits before files are deleted", false},
+	{"workspace/didChangeConfiguration", "Workspace", "Configuration changed", true},
+	{"workspace/didChangeWatchedFiles", "Workspace", "Watched files changed", true},
+	{"workspace/didChangeWorkspaceFolders", "Workspace", "Workspace folders changed", true},
+	{"workspace/didCreateFiles", "Workspace", "Files created", true},
+	{"workspace/didRenameFiles", "Workspace", "Files renamed", true},
+	{"workspace/didDeleteFiles", "Workspace", "Files deleted", true},
+
+	{"textDocument/publishDiagnostics", "Diagnostics", "Diagnostics (notification, collected after -open)", true},
+
+	{"initialize", "Lifecycle", "Initialize the server", false},
+	{"initialized", "Lifecycle", "Initialization finished", true},
+	{"shutdown", "Lifecycle", "Shut the server down", false},
+	{"exit", "Lifecycle", "Exit the server", true},
+	{"$/cancelRequest", "Lifecycle", "Cancel a request", true},
+	{"$/setTrace", "Lifecycle", "Set the trace level", true},
+
+	{"gopls/debug/info", "gopls", "Get gopls debug information", false},
+	{"gopls/gc_details", "gopls", "Get garbage collection details", false},
+	{"gopls/generate", "gopls", "Run go generate", false},
+	{"gopls/list_imports", "gopls", "List available imports", false},
+	{"gopls/add_import", "gopls", "Add import to file", false},
+	{"gopls/remove_dependency", "gopls", "Remove unused dependency", false},
+}
+
+// knownMethods indexes commonMethods by name.
+var knownMethods = func() map[string]lspMethod {
+	methods := make(map[string]lspMethod, len(commonMethods))
+	for _, m := range commonMethods {
+		methods[m.Name] = m
+	}
+	return methods
+}()
+
+// writeMethodsJSON writes commonMethods for tools such as shell completion
+// scripts: as one JSON array, or with ndjson as one object per line.
+func writeMethodsJSON(w io.Writer, ndjson bool) error {
+	if !ndjson {
+		return writeJSONLine(w, commonMethods)
+	}
+	for _, m := range commonMethods {
+		if err := writeJSONLine(w, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printCommonMethods() {
+	fmt.Println("Common LSP Methods:")
+	category := ""
+	for _, m := range commonMethods {
+		if m.Category != category {
+			category = m.Category
+			fmt.Printf("\n%s:\n", category)
+		}
+		fmt.Printf("  %-38s - %s\n", m.Name, m.Description)
+	}
+	fmt.Println("\nExample parameter files can be created with:")
+	fmt.Println("  echo '{\"textDocument\":{\"uri\":\"file:///path/to/file.go\"},\"position\":{\"line\":10,\"character\":5}}' > hover.json")
+}
+
+// validateMethod returns an error for methods clsp doesn't know, suggesting
+// the closest known method when there is a plausible one.
+func validateMethod(method string) error {
+	if _, ok := knownMethods[method]; ok {
+		return nil
+	}
+	msg := fmt.Sprintf("unknown method %q", method)
+	if suggestion := suggestMethod(method); suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+	}
+	return fmt.Errorf("%s; use -allow-unknown-method to send it anyway", msg)
+}
+
+// suggestMethod returns the known method closest to method by edit
+// distance, or "" when nothing is close enough to be a likely typo.
+func suggestMethod(method string) string {
+	best, bestDistance := "", -1
+	for name := range knownMethods {
+		d := editDistance(strings.ToLower(method), strings.ToLower(name))
+		if bestDistance < 0 || d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	if bestDistance > max(3, len(method)/4) {
+		return ""
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
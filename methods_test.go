@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"textDocument/defintion", "textDocument/definition", 1},
+		{"hover", "hover", 0},
+	}
+
+	for _, tc := range testCases {
+		if got := editDistance(tc.a, tc.b); got != tc.expected {
+			t.Errorf("editDistance(%q, %q): expected %d, got %d", tc.a, tc.b, tc.expected, got)
+		}
+	}
+}
+
+func TestValidateMethod(t *testing.T) {
+	if err := validateMethod("textDocument/definition"); err != nil {
+		t.Errorf("Expected a known method to pass, got %v", err)
+	}
+
+	testCases := []struct {
+		method     string
+		suggestion string
+	}{
+		{"textDocument/defintion", "textDocument/definition"},
+		{"textdocument/hover", "textDocument/hover"},
+		{"workspace/symbols", "workspace/symbol"},
+		{"rust-analyzer/expandMacro", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.method, func(t *testing.T) {
+			err := validateMethod(tc.method)
+			if err == nil {
+				t.Fatal("Expected an error for an unknown method")
+			}
+			hasSuggestion := strings.Contains(err.Error(), "did you mean")
+			if tc.suggestion == "" && hasSuggestion {
+				t.Errorf("Expected no suggestion, got %v", err)
+			}
+			if tc.suggestion != "" && !strings.Contains(err.Error(), `"`+tc.suggestion+`"`) {
+				t.Errorf("Expected suggestion %s, got %v", tc.suggestion, err)
+			}
+		})
+	}
+}
+
+func TestWriteMethodsJSON(t *testing.T) {
+	var b strings.Builder
+	if err := writeMethodsJSON(&b, false); err != nil {
+		t.Fatal(err)
+	}
+	var methods []lspMethod
+	if err := json.Unmarshal([]byte(b.String()), &methods); err != nil {
+		t.Fatal(err)
+	}
+	if len(methods) != len(commonMethods) {
+		t.Fatalf("Expected %d methods, got %d", len(commonMethods), len(methods))
+	}
+	for i, m := range methods {
+		if m != commonMethods[i] {
+			t.Errorf("Expected %+v, got %+v", commonMethods[i], m)
+		}
+	}
+
+	b.Reset()
+	if err := writeMethodsJSON(&b, true); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != len(commonMethods) {
+		t.Fatalf("Expected a line per method, got %d lines", len(lines))
+	}
+	var didOpen lspMethod
+	for _, line := range lines {
+		var m lspMethod
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Name == "textDocument/didOpen" {
+			didOpen = m
+		}
+	}
+	if !didOpen.Notification || didOpen.Category != "Text Document" {
+		t.Errorf("Unexpected didOpen entry %+v", didOpen)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// NotificationHandler is called with the params of a notification sent by
+// the server. Like ServerRequestHandler it runs while a message is being
+// read and must not send requests.
+type NotificationHandler func(params json.RawMessage)
+
+// OnNotification registers handler for notifications with the given method.
+// Several handlers may be registered for the same method.
+func (c *LSPClient) OnNotification(method string, handler NotificationHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.notificationHandlers == nil {
+		c.notificationHandlers = make(map[string][]NotificationHandler)
+	}
+	c.notificationHandlers[method] = append(c.notificationHandlers[method], handler)
+}
+
+func (c *LSPClient) notify(method string, params json.RawMessage) {
+	c.mu.Lock()
+	handlers := c.notificationHandlers[method]
+	c.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(params)
+	}
+}
+
+// Listen reads and dispatches incoming messages until ctx is done, which is
+// how it normally returns (with a nil error). Use it to wait for
+// notifications that arrive independently of any request.
+func (c *LSPClient) Listen(ctx context.Context) error {
+	c.callMu.Lock()
+	defer c.callMu.Unlock()
+
+	for {
+		content, err := c.readMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		response, err := c.dispatch(content)
+		if err != nil {
+			return err
+		}
+		if response != nil {
+			c.logger.Debug("Received unexpected response while listening", "id", response.ID)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+// textDocumentParams builds the textDocument and, when line is not
+// negative, position fields shared by most textDocument/* requests.
+func textDocumentParams(path string, line, character int) map[string]any {
+	params := map[string]any{
+		"textDocument": TextDocumentIdentifier{URI: PathToFileURI(path)},
+	}
+	if line >= 0 {
+		params["position"] = Position{Line: line, Character: character}
+	}
+	return params
+}
+
+// encodeColumn converts pos, whose Character counts bytes into its line as
+// editors, grep and rg count columns, to count in encoding instead. text
+// is the document pos is in. Bytes past the end of the line are counted
+// one unit each.
+func encodeColumn(text string, pos Position, encoding string) Position {
+	if encoding == encodingUTF8 {
+		return pos
+	}
+	line := text[positionOffset(text, Position{Line: pos.Line}, encoding):]
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.TrimSuffix(line, "\r")
+
+	units := 0
+	for i, r := range line {
+		if i >= pos.Character {
+			break
+		}
+		units += runeUnits(r, utf8.RuneLen(r), encoding)
+	}
+	if pos.Character > len(line) {
+		units += pos.Character - len(line)
+	}
+	return Position{Line: pos.Line, Character: units}
+}
+
+// encodeParamsColumns converts the position and range that -file, -pos
+// and -range built into params from byte columns to encoding, as
+// encodeColumn does. Those the explicit params set are left alone.
+func encodeParamsColumns(params map[string]any, explicit any, text, encoding string) {
+	object, _ := explicit.(map[string]any)
+	if _, ok := object["position"]; !ok && params["position"] != nil {
+		var pos Position
+		if remarshal(params["position"], &pos) == nil {
+			params["position"] = encodeColumn(text, pos, encoding)
+		}
+	}
+	if _, ok := object["range"]; !ok && params["range"] != nil {
+		var r Range
+		if remarshal(params["range"], &r) == nil {
+			params["range"] = Range{Start: encodeColumn(text, r.Start, encoding), End: encodeColumn(text, r.End, encoding)}
+		}
+	}
+}
+
+// remarshal decodes v, which may already have been decoded into maps by
+// mergeParams, into out.
+func remarshal(v, out any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// mergeParams merges an explicit -params object into the params built by
+// -file or -pos, the way mergeCapabilities merges capabilities: nested
+// objects are merged, explicit values win on conflicts and a null removes
+// a built field.
+func mergeParams(built map[string]any, explicit any) (map[string]any, error) {
+	object, ok := explicit.(map[string]any)
+	if !ok {
+		return nil, errors.New("params must be a JSON object to be merged with those built by -file or -pos")
+	}
+	// Round-trip the built params so their typed values, such as Position,
+	// become maps the explicit fields can be merged into.
+	data, err := json.Marshal(built)
+	if err != nil {
+		return nil, err
+	}
+	var base map[string]any
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, err
+	}
+	return mergeCapabilities(base, object), nil
+}
+
+// parseFilePosition parses a 1-based `file:line:col`, as printed by
+// editors and grep -n, into a path and a 0-based LSP Position: line 1
+// column 1 is {0, 0}. The path may itself contain colons.
+func parseFilePosition(s string) (string, Position, error) {
+	rest, colStr, ok := cutLast(s, ":")
+	if !ok {
+		return "", Position{}, fmt.Errorf("invalid position %q, want file:line:col", s)
+	}
+	path, lineStr, ok := cutLast(rest, ":")
+	if !ok || path == "" {
+		return "", Position{}, fmt.Errorf("invalid position %q, want file:line:col", s)
+	}
+
+	line, err := strconv.Atoi(lineStr)
+	if err != nil || line < 1 {
+		return "", Position{}, fmt.Errorf("invalid line %q in %q: lines start at 1", lineStr, s)
+	}
+	col, err := strconv.Atoi(colStr)
+	if err != nil || col < 1 {
+		return "", Position{}, fmt.Errorf("invalid column %q in %q: columns start at 1", colStr, s)
+	}
+	return path, Position{Line: line - 1, Character: col - 1}, nil
+}
+
+// parseRange parses a 1-based `startLine:startCol-endLine:endCol` into a
+// 0-based LSP Range, numbered like parseFilePosition.
+func parseRange(s string) (Range, error) {
+	startStr, endStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return Range{}, fmt.Errorf("invalid range %q, want startLine:startCol-endLine:endCol", s)
+	}
+	start, err := parseLineColumn(startStr)
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid start of range %q: %w", s, err)
+	}
+	end, err := parseLineColumn(endStr)
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid end of range %q: %w", s, err)
+	}
+	if end.Line < start.Line || (end.Line == start.Line && end.Character < start.Character) {
+		return Range{}, fmt.Errorf("invalid range %q: it ends before it starts", s)
+	}
+	return Range{Start: start, End: end}, nil
+}
+
+// parseLineColumn parses a 1-based `line:col` into a 0-based Position.
+func parseLineColumn(s string) (Position, error) {
+	lineStr, colStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return Position{}, fmt.Errorf("%q is not line:col", s)
+	}
+	line, err := strconv.Atoi(lineStr)
+	if err != nil || line < 1 {
+		return Position{}, fmt.Errorf("invalid line %q: lines start at 1", lineStr)
+	}
+	col, err := strconv.Atoi(colStr)
+	if err != nil || col < 1 {
+		return Position{}, fmt.Errorf("invalid column %q: columns start at 1", colStr)
+	}
+	return Position{Line: line - 1, Character: col - 1}, nil
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// grepLocationPattern matches the start of a grep or ripgrep output line:
+// the path, which may begin with a Windows drive letter, then the line
+// and, optionally, the column, each followed by a colon unless the line
+// ends there. The path is the shortest prefix that fits, so colons in the
+// matched text that follows don't matter.
+var grepLocationPattern = regexp.MustCompile(`^((?:[A-Za-z]:[\\/])?[^:].*?):(\d+)(?::(\d+))?(?::|$)`)
+
+// parseGrepLocation parses a `file:line:col:text` line as printed by
+// `rg --vimgrep` or `grep -n --column`. Lines and columns are 1-based and
+// returned as a 0-based Position; a line without a column, as from
+// `grep -n`, means column 1.
+func parseGrepLocation(s string) (string, Position, error) {
+	m := grepLocationPattern.FindStringSubmatch(s)
+	if m == nil {
+		return "", Position{}, fmt.Errorf("invalid location %q, want file:line:col", s)
+	}
+	line, err := strconv.Atoi(m[2])
+	if err != nil || line < 1 {
+		return "", Position{}, fmt.Errorf("invalid line %q in %q: lines start at 1", m[2], s)
+	}
+	col := 1
+	if m[3] != "" {
+		if col, err = strconv.Atoi(m[3]); err != nil || col < 1 {
+			return "", Position{}, fmt.Errorf("invalid column %q in %q: columns start at 1", m[3], s)
+		}
+	}
+	return m[1], Position{Line: line - 1, Character: col - 1}, nil
+}
+
+// fileLocation is one location read by readGrepLocations. Err is set for
+// a line that couldn't be parsed.
+type fileLocation struct {
+	Input string
+	Path  string
+	Pos   Position
+	Err   error
+}
+
+// readGrepLocations reads one location per line from r, skipping blank
+// lines.
+func readGrepLocations(r io.Reader) ([]fileLocation, error) {
+	var locs []fileLocation
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024) // matched lines can be long
+	for scanner.Scan() {
+		input := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+		path, pos, err := parseGrepLocation(input)
+		locs = append(locs, fileLocation{Input: input, Path: path, Pos: pos, Err: err})
+	}
+	return locs, scanner.Err()
+}
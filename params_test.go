@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTextDocumentParams(t *testing.T) {
+	data, err := json.Marshal(textDocumentParams("/src/main.go", 10, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"position":{"line":10,"character":5},"textDocument":{"uri":"file:///src/main.go"}}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	data, err = json.Marshal(textDocumentParams("/src/main.go", -1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "position") {
+		t.Errorf("Expected no position when line is unset, got %s", data)
+	}
+}
+
+func TestMergeParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		explicit string
+		expected string
+	}{
+		{
+			name:     "adds fields",
+			explicit: `{"context":{"includeDeclaration":true}}`,
+			expected: `{"context":{"includeDeclaration":true},"position":{"character":4,"line":3},"textDocument":{"uri":"file:///src/a.go"}}`,
+		},
+		{
+			name:     "explicit wins",
+			explicit: `{"position":{"character":9}}`,
+			expected: `{"position":{"character":9,"line":3},"textDocument":{"uri":"file:///src/a.go"}}`,
+		},
+		{
+			name:     "null removes",
+			explicit: `{"position":null}`,
+			expected: `{"textDocument":{"uri":"file:///src/a.go"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := mergeParams(textDocumentParams("/src/a.go", 3, 4), decodeResult(t, tt.explicit))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(merged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, data)
+			}
+		})
+	}
+
+	if _, err := mergeParams(textDocumentParams("/src/a.go", 3, 4), decodeResult(t, `[1]`)); err == nil {
+		t.Error("Expected an error for params that aren't an object")
+	}
+}
+
+func TestEncodeColumn(t *testing.T) {
+	// `t` is at byte 23 of the second line, after 日 and 本 (3 bytes, one
+	// UTF-16 unit each) and 😀 (4 bytes, two UTF-16 units).
+	text := "package main\r\nvar s = \"日本😀\" + t\n"
+	tests := []struct {
+		encoding string
+		column   int
+		expected int
+	}{
+		{encodingUTF8, 23, 23},
+		{encodingUTF16, 23, 17},
+		{encodingUTF32, 23, 16},
+		{encodingUTF16, 9, 9},
+		{encodingUTF16, 26, 20}, // two bytes past the end of the line
+	}
+	for _, tt := range tests {
+		got := encodeColumn(text, Position{Line: 1, Character: tt.column}, tt.encoding)
+		if got != (Position{Line: 1, Character: tt.expected}) {
+			t.Errorf("%s column %d: expected character %d, got %+v", tt.encoding, tt.column, tt.expected, got)
+		}
+	}
+	if got := encodeColumn(text, Position{Line: 5, Character: 3}, encodingUTF16); got != (Position{Line: 5, Character: 3}) {
+		t.Errorf("Expected a position past the end of the text to be kept, got %+v", got)
+	}
+}
+
+func TestEncodeParamsColumns(t *testing.T) {
+	text := "var s = \"日本😀\" + t\n"
+	params := textDocumentParams("/src/a.go", 0, 23)
+	params["range"] = Range{Start: Position{Line: 0, Character: 9}, End: Position{Line: 0, Character: 19}}
+	encodeParamsColumns(params, nil, text, encodingUTF16)
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"position":{"line":0,"character":17},"range":{"start":{"line":0,"character":9},"end":{"line":0,"character":13}},"textDocument":{"uri":"file:///src/a.go"}}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	// A position merged from -params is the server's own and is kept.
+	merged, err := mergeParams(textDocumentParams("/src/a.go", 0, 22), decodeResult(t, `{"position":{"character":22}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodeParamsColumns(merged, decodeResult(t, `{"position":{"character":22}}`), text, encodingUTF32)
+	if data, _ := json.Marshal(merged["position"]); string(data) != `{"character":22,"line":0}` {
+		t.Errorf("Expected the explicit position to be kept, got %s", data)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected Range
+		wantErr  bool
+	}{
+		{"1:1-10:5", Range{Start: Position{Line: 0, Character: 0}, End: Position{Line: 9, Character: 4}}, false},
+		{"3:4-3:4", Range{Start: Position{Line: 2, Character: 3}, End: Position{Line: 2, Character: 3}}, false},
+		{"3:4-3:2", Range{}, true},
+		{"5:1-4:1", Range{}, true},
+		{"0:1-2:1", Range{}, true},
+		{"1:1", Range{}, true},
+		{"1-2", Range{}, true},
+		{"1:x-2:1", Range{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := parseRange(tc.input)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil || got != tc.expected {
+				t.Errorf("Expected %v, got %v (err=%v)", tc.expected, got, err)
+			}
+		})
+	}
+}
+
+func TestParseFilePosition(t *testing.T) {
+	testCases := []struct {
+		input   string
+		path    string
+		pos     Position
+		wantErr bool
+	}{
+		{"main.go:1:1", "main.go", Position{Line: 0, Character: 0}, false},
+		{"src/main.go:12:7", "src/main.go", Position{Line: 11, Character: 6}, false},
+		{`C:\src\main.go:3:4`, `C:\src\main.go`, Position{Line: 2, Character: 3}, false},
+		{"main.go:0:1", "", Position{}, true},
+		{"main.go:1:0", "", Position{}, true},
+		{"main.go:1", "", Position{}, true},
+		{"main.go", "", Position{}, true},
+		{":1:1", "", Position{}, true},
+		{"main.go:x:1", "", Position{}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			path, pos, err := parseFilePosition(tc.input)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %s %v", path, pos)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if path != tc.path || pos != tc.pos {
+				t.Errorf("Expected %s %v, got %s %v", tc.path, tc.pos, path, pos)
+			}
+		})
+	}
+}
+
+func TestParseGrepLocation(t *testing.T) {
+	testCases := []struct {
+		input   string
+		path    string
+		pos     Position
+		wantErr bool
+	}{
+		{"main.go:12:7:\tfmt.Println(x)", "main.go", Position{Line: 11, Character: 6}, false},
+		{"main.go:12:7", "main.go", Position{Line: 11, Character: 6}, false},
+		{"main.go:12:\tx := a[1:2]", "main.go", Position{Line: 11, Character: 0}, false},
+		{"main.go:12", "main.go", Position{Line: 11, Character: 0}, false},
+		{"src/a.go:3:4: case 1:2:", "src/a.go", Position{Line: 2, Character: 3}, false},
+		{`C:\src\main.go:3:4:text`, `C:\src\main.go`, Position{Line: 2, Character: 3}, false},
+		{"C:/src/main.go:3:4", "C:/src/main.go", Position{Line: 2, Character: 3}, false},
+		{"main.go:0:1:text", "", Position{}, true},
+		{"main.go:1:0:text", "", Position{}, true},
+		{"main.go:x:y", "", Position{}, true},
+		{"main.go", "", Position{}, true},
+		{":1:1", "", Position{}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			path, pos, err := parseGrepLocation(tc.input)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %s %v", path, pos)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if path != tc.path || pos != tc.pos {
+				t.Errorf("Expected %s %v, got %s %v", tc.path, tc.pos, path, pos)
+			}
+		})
+	}
+}
+
+func TestReadGrepLocations(t *testing.T) {
+	input := "a.go:1:2:x\r\n\n   \nnot a location\nb.go:3:4:y\n"
+	locs, err := readGrepLocations(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locs) != 3 {
+		t.Fatalf("Expected 3 locations, got %+v", locs)
+	}
+	if locs[0].Path != "a.go" || locs[0].Pos != (Position{Line: 0, Character: 1}) || locs[0].Err != nil {
+		t.Errorf("Unexpected first location %+v", locs[0])
+	}
+	if locs[1].Input != "not a location" || locs[1].Err == nil {
+		t.Errorf("Expected the second location to be invalid, got %+v", locs[1])
+	}
+	if locs[2].Path != "b.go" || locs[2].Pos != (Position{Line: 2, Character: 3}) {
+		t.Errorf("Unexpected third location %+v", locs[2])
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// pendingRequest is a request written by WriteRequest, with its response
+// once it has been read.
+type pendingRequest struct {
+	start    time.Time
+	response *JSONRPCResponse
+}
+
+// WriteRequest writes a request without waiting for its response and
+// returns its ID, to be passed to ReadResponseByID. Any number of
+// requests can be written before their responses are read, so the server
+// may work on several at once.
+func (c *LSPClient) WriteRequest(method string, params any) (int, error) {
+	id := c.nextID()
+	c.mu.Lock()
+	if c.pending == nil {
+		c.pending = make(map[int]*pendingRequest)
+	}
+	c.pending[id] = &pendingRequest{start: time.Now()}
+	c.mu.Unlock()
+
+	if err := c.writeRequest(id, method, params); err != nil {
+		c.forget(id)
+		return 0, err
+	}
+	return id, nil
+}
+
+// ReadResponseByID returns the response to the request with the given ID,
+// written by WriteRequest. It reads messages until that response arrives;
+// responses to the other pending requests read meanwhile are kept for
+// their own calls, in whatever order the server sends them. If ctx ends
+// first, the request is cancelled and forgotten.
+func (c *LSPClient) ReadResponseByID(ctx context.Context, id int) (*JSONRPCResponse, error) {
+	c.callMu.Lock()
+	defer c.callMu.Unlock()
+
+	c.mu.Lock()
+	p, ok := c.pending[id]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no pending request with id %d", id)
+	}
+	if c.dryRun {
+		c.forget(id)
+		return nil, nil
+	}
+
+	for {
+		c.mu.Lock()
+		response := p.response
+		c.mu.Unlock()
+		if response != nil {
+			c.forget(id)
+			return response, nil
+		}
+
+		content, err := c.readMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				c.forget(id)
+				c.cancelRequest(id)
+				return nil, err
+			}
+			return nil, c.explainExit(err)
+		}
+		response, err = c.dispatch(content)
+		if err != nil {
+			return nil, err
+		}
+		if response != nil {
+			c.logger.Debug("Received unexpected response ID, continuing to read", "received", response.ID, "expected", id)
+		}
+	}
+}
+
+// settle stores response with its pending request and reports whether
+// there was one waiting for it.
+func (c *LSPClient) settle(response *JSONRPCResponse) bool {
+	id, ok := response.ID.Int()
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pending[id]
+	if !ok || p.response != nil {
+		return false
+	}
+	response.Duration = time.Since(p.start)
+	p.response = response
+	return true
+}
+
+func (c *LSPClient) forget(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReadResponseByID_OutOfOrder(t *testing.T) {
+	client, server := newFakeServer(t)
+	server.on("test/first", fakeReply{NoReply: true})
+	server.on("test/second", fakeReply{
+		Result: "second",
+		After:  []any{JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(1), Result: "first"}},
+	})
+
+	first, err := client.WriteRequest("test/first", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.WriteRequest("test/second", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.ReadResponseByID(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Result != "first" {
+		t.Errorf("Expected the response to the first request, got %v", response.Result)
+	}
+	// The second response was read before the first and kept.
+	response, err = client.ReadResponseByID(ctx, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Result != "second" {
+		t.Errorf("Expected the response to the second request, got %v", response.Result)
+	}
+
+	if _, err := client.ReadResponseByID(ctx, second); err == nil {
+		t.Error("Expected an error for a response that was already read")
+	}
+}
+
+func TestReadResponseByID_SendRequestKeepsPending(t *testing.T) {
+	client, server := newFakeServer(t)
+	server.on("test/pipelined", fakeReply{NoReply: true})
+	server.on("test/direct", fakeReply{
+		Messages: []any{JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(1), Result: "pipelined"}},
+		Result:   "direct",
+	})
+
+	id, err := client.WriteRequest("test/pipelined", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := client.SendRequest(ctx, "test/direct", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Result != "direct" {
+		t.Errorf("Expected the direct response, got %v", response.Result)
+	}
+
+	response, err = client.ReadResponseByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Result != "pipelined" {
+		t.Errorf("Expected the pipelined response read by SendRequest to be kept, got %v", response.Result)
+	}
+}
+
+func TestReadResponseByID_Timeout(t *testing.T) {
+	client, server := newFakeServer(t)
+	server.on("test/slow", fakeReply{NoReply: true})
+
+	id, err := client.WriteRequest("test/slow", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.ReadResponseByID(ctx, id); err == nil {
+		t.Fatal("Expected a timeout error")
+	}
+	if _, err := client.ReadResponseByID(context.Background(), id); err == nil {
+		t.Error("Expected a timed out request to be forgotten")
+	}
+
+	client.Close()
+	methods := fakeMethods(server.messages())
+	if len(methods) < 2 || methods[1] != "$/cancelRequest" {
+		t.Errorf("Expected $/cancelRequest after the request, got %v", methods)
+	}
+}
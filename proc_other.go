@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+func detachProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
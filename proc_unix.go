@@ -0,0 +1,24 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcessGroup starts cmd in its own process group so that a Ctrl-C
+// in the terminal reaches only clsp, which then shuts the server down
+// through the protocol instead of the server dying mid-request.
+func detachProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills cmd's process and whatever it started in its
+// group, which a Ctrl-C in the terminal no longer reaches.
+func killProcessGroup(cmd *exec.Cmd) error {
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
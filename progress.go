@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+type ProgressParams struct {
+	Token json.RawMessage `json:"token"` // integer or string
+	Value json.RawMessage `json:"value"`
+}
+
+// WorkDoneProgress covers the begin, report and end payloads of
+// work done progress; Kind tells them apart.
+type WorkDoneProgress struct {
+	Kind       string `json:"kind"`
+	Title      string `json:"title,omitempty"`
+	Message    string `json:"message,omitempty"`
+	Percentage *int   `json:"percentage,omitempty"`
+}
+
+// progressPrinter writes $/progress notifications to w as they arrive.
+// Reports and the end only carry a token, so the title from the begin is
+// remembered per token to label them.
+type progressPrinter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	titles map[string]string
+}
+
+func printProgress(client *LSPClient, w io.Writer) *progressPrinter {
+	p := &progressPrinter{w: w, titles: make(map[string]string)}
+	client.OnNotification("$/progress", p.handle)
+	return p
+}
+
+func (p *progressPrinter) handle(params json.RawMessage) {
+	var progress ProgressParams
+	if err := json.Unmarshal(params, &progress); err != nil {
+		return
+	}
+	var value WorkDoneProgress
+	if err := json.Unmarshal(progress.Value, &value); err != nil || value.Kind == "" {
+		return // partial results and other non-work-done progress
+	}
+	token := string(progress.Token)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	title := p.titles[token]
+	switch value.Kind {
+	case "begin":
+		title = value.Title
+		p.titles[token] = title
+	case "end":
+		delete(p.titles, token)
+	}
+	if title == "" {
+		title = token
+	}
+	fmt.Fprintln(p.w, formatProgress(title, value))
+}
+
+func formatProgress(title string, value WorkDoneProgress) string {
+	parts := []string{"[" + title + "]"}
+	switch value.Kind {
+	case "begin":
+		parts = append(parts, "started")
+	case "end":
+		parts = append(parts, "done")
+	}
+	if value.Percentage != nil {
+		parts = append(parts, fmt.Sprintf("%d%%", *value.Percentage))
+	}
+	if value.Message != "" {
+		parts = append(parts, value.Message)
+	}
+	return strings.Join(parts, " ")
+}
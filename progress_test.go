@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestProgressPrinter(t *testing.T) {
+	var out strings.Builder
+	p := &progressPrinter{w: &out, titles: make(map[string]string)}
+
+	notifications := []string{
+		`{"token":"idx","value":{"kind":"begin","title":"Indexing","percentage":0}}`,
+		`{"token":7,"value":{"kind":"begin","title":"Loading packages"}}`,
+		`{"token":"idx","value":{"kind":"report","message":"3/4 files","percentage":75}}`,
+		`{"token":7,"value":{"kind":"end"}}`,
+		`{"token":"idx","value":{"kind":"end","message":"finished"}}`,
+		`{"token":"idx","value":{"kind":"report","percentage":10}}`,
+		`{"token":"partial","value":[{"uri":"file:///a.go"}]}`,
+	}
+	for _, n := range notifications {
+		p.handle(json.RawMessage(n))
+	}
+
+	expected := `[Indexing] started 0%
+[Loading packages] started
+[Indexing] 75% 3/4 files
+[Loading packages] done
+[Indexing] done finished
+["idx"] 10%
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+	if len(p.titles) != 0 {
+		t.Errorf("Expected finished tokens to be forgotten, got %v", p.titles)
+	}
+}
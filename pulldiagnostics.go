@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity,omitempty"`
+	Code     any    `json:"code,omitempty"` // integer or string
+	Source   string `json:"source,omitempty"`
+	Message  string `json:"message"`
+}
+
+// DocumentDiagnosticReport is a pull diagnostics report for one document.
+// A "full" report carries Items; an "unchanged" one only confirms that the
+// diagnostics of ResultID still hold.
+type DocumentDiagnosticReport struct {
+	Kind     string       `json:"kind"`
+	ResultID string       `json:"resultId,omitempty"`
+	Items    []Diagnostic `json:"items,omitempty"`
+
+	// URI is only set in workspace/diagnostic reports.
+	URI string `json:"uri,omitempty"`
+
+	RelatedDocuments map[string]DocumentDiagnosticReport `json:"relatedDocuments,omitempty"`
+}
+
+// pullDiagnosticsMethods are the methods whose results are diagnostic
+// reports.
+var pullDiagnosticsMethods = []string{"textDocument/diagnostic", "workspace/diagnostic"}
+
+// isPullDiagnostics reports whether method asks for pull diagnostics.
+func isPullDiagnostics(method string) bool {
+	return slices.Contains(pullDiagnosticsMethods, method)
+}
+
+// diagnosticSeverities names the LSP DiagnosticSeverity values, which
+// start at 1.
+var diagnosticSeverities = []string{"", "error", "warning", "information", "hint"}
+
+// diagnosticReports extracts the reports of a textDocument/diagnostic or
+// workspace/diagnostic result. The report for the requested document has
+// no URI; related documents follow it, sorted by URI. ok is false for
+// other shapes.
+func diagnosticReports(result any) (reports []DocumentDiagnosticReport, ok bool) {
+	object, ok := result.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, false
+	}
+
+	if _, ok := object["kind"]; ok {
+		var report DocumentDiagnosticReport
+		if err := json.Unmarshal(data, &report); err != nil || !validReportKind(report.Kind) {
+			return nil, false
+		}
+		reports = append(reports, report)
+		for _, uri := range slices.Sorted(maps.Keys(report.RelatedDocuments)) {
+			related := report.RelatedDocuments[uri]
+			related.URI = uri
+			reports = append(reports, related)
+		}
+		return reports, true
+	}
+
+	var workspace struct {
+		Items []DocumentDiagnosticReport `json:"items"`
+	}
+	if _, ok := object["items"].([]any); !ok {
+		return nil, false
+	}
+	if err := json.Unmarshal(data, &workspace); err != nil {
+		return nil, false
+	}
+	for _, report := range workspace.Items {
+		if !validReportKind(report.Kind) {
+			return nil, false
+		}
+	}
+	return workspace.Items, true
+}
+
+func validReportKind(kind string) bool {
+	return kind == "full" || kind == "unchanged"
+}
+
+// formatDiagnosticReports renders one `line:col: severity: message [source]`
+// line per diagnostic, prefixed with the document URI where the report has
+// one. Positions are 1-based, as editors show them. Unchanged reports get
+// a single line naming the result they confirm.
+func formatDiagnosticReports(reports []DocumentDiagnosticReport) string {
+	var b strings.Builder
+	for _, report := range reports {
+		prefix := ""
+		if report.URI != "" {
+			prefix = report.URI + ":"
+		}
+		if report.Kind == "unchanged" {
+			if prefix != "" {
+				prefix += " "
+			}
+			fmt.Fprintf(&b, "%sunchanged (resultId %s)\n", prefix, report.ResultID)
+			continue
+		}
+		for _, d := range report.Items {
+			fmt.Fprintf(&b, "%s%d:%d: %s\n", prefix, d.Range.Start.Line+1, d.Range.Start.Character+1, formatDiagnostic(d))
+		}
+	}
+	return b.String()
+}
+
+func formatDiagnostic(d Diagnostic) string {
+	var parts []string
+	if d.Severity > 0 && d.Severity < len(diagnosticSeverities) {
+		parts = append(parts, diagnosticSeverities[d.Severity]+":")
+	}
+	parts = append(parts, strings.Join(strings.Fields(d.Message), " "))
+
+	var origin []string
+	if d.Source != "" {
+		origin = append(origin, d.Source)
+	}
+	switch code := d.Code.(type) {
+	case string:
+		origin = append(origin, code)
+	case float64:
+		origin = append(origin, strconv.FormatFloat(code, 'f', -1, 64))
+	}
+	if len(origin) > 0 {
+		parts = append(parts, "["+strings.Join(origin, " ")+"]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// countDiagnostics returns how many diagnostics the full reports carry.
+func countDiagnostics(reports []DocumentDiagnosticReport) int {
+	n := 0
+	for _, report := range reports {
+		n += len(report.Items)
+	}
+	return n
+}
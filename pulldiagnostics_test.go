@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func decodeResult(t *testing.T, s string) any {
+	t.Helper()
+	var result any
+	if err := json.Unmarshal([]byte(s), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestDiagnosticReports_Document(t *testing.T) {
+	result := decodeResult(t, `{
+		"kind": "full",
+		"resultId": "1",
+		"items": [
+			{"range": {"start": {"line": 11, "character": 1}, "end": {"line": 11, "character": 5}}, "severity": 1, "source": "compiler", "code": "UndeclaredName", "message": "undefined:\n x"},
+			{"range": {"start": {"line": 0, "character": 0}, "end": {"line": 0, "character": 1}}, "severity": 4, "code": 1001, "message": "hint"}
+		],
+		"relatedDocuments": {
+			"file:///b.go": {"kind": "unchanged", "resultId": "7"},
+			"file:///a.go": {"kind": "full", "items": [{"range": {"start": {"line": 2, "character": 0}, "end": {"line": 2, "character": 1}}, "severity": 2, "message": "unused"}]}
+		}
+	}`)
+
+	reports, ok := diagnosticReports(result)
+	if !ok {
+		t.Fatal("Expected a diagnostic report")
+	}
+	if n := countDiagnostics(reports); n != 3 {
+		t.Errorf("Expected 3 diagnostics, got %d", n)
+	}
+	expected := "12:2: error: undefined: x [compiler UndeclaredName]\n" +
+		"1:1: hint: hint [1001]\n" +
+		"file:///a.go:3:1: warning: unused\n" +
+		"file:///b.go: unchanged (resultId 7)\n"
+	if got := formatDiagnosticReports(reports); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestDiagnosticReports_Workspace(t *testing.T) {
+	result := decodeResult(t, `{"items": [
+		{"kind": "full", "uri": "file:///a.go", "version": 3, "items": [{"range": {"start": {"line": 0, "character": 4}, "end": {"line": 0, "character": 5}}, "severity": 3, "message": "info"}]},
+		{"kind": "unchanged", "uri": "file:///b.go", "resultId": "9"}
+	]}`)
+
+	reports, ok := diagnosticReports(result)
+	if !ok {
+		t.Fatal("Expected a workspace diagnostic report")
+	}
+	expected := "file:///a.go:1:5: information: info\nfile:///b.go: unchanged (resultId 9)\n"
+	if got := formatDiagnosticReports(reports); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestDiagnosticReports_OtherShapes(t *testing.T) {
+	for _, s := range []string{`null`, `[]`, `{"contents": "x"}`, `{"kind": "markdown", "value": "x"}`, `{"items": [{"label": "x"}]}`} {
+		if _, ok := diagnosticReports(decodeResult(t, s)); ok {
+			t.Errorf("Expected %s not to be a diagnostic report", s)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// recordEntry is one line of a -record transcript.
+type recordEntry struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"` // "send" or "recv"
+
+	// Message is the JSON-RPC message as it went over the wire. A body
+	// that isn't valid JSON is kept as a string so nothing is lost.
+	Message json.RawMessage `json:"message"`
+}
+
+// recorder appends every message exchanged with the server to a
+// newline-delimited JSON transcript.
+type recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newRecorder(w io.Writer) *recorder {
+	return &recorder{enc: json.NewEncoder(w)}
+}
+
+func (r *recorder) record(direction string, body []byte) error {
+	message := json.RawMessage(body)
+	if !json.Valid(body) {
+		message, _ = json.Marshal(string(body))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enc.Encode(recordEntry{Time: time.Now(), Direction: direction, Message: message})
+}
+
+// record adds body to the transcript when -record is in use.
+func (c *LSPClient) record(direction string, body []byte) {
+	if c.recorder == nil {
+		return
+	}
+	if err := c.recorder.record(direction, body); err != nil {
+		c.logger.Warn("Failed to record message", "error", err)
+	}
+}
+
+// replayFrames turns the messages received in a transcript back into the
+// framed byte stream the server sent.
+func replayFrames(r io.Reader) ([]byte, error) {
+	var frames bytes.Buffer
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var entry recordEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", n, err)
+		}
+		if entry.Direction != "recv" {
+			continue
+		}
+
+		body := []byte(entry.Message)
+		var s string
+		if json.Unmarshal(entry.Message, &s) == nil {
+			body = []byte(s)
+		}
+		fmt.Fprintf(&frames, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	return frames.Bytes(), nil
+}
+
+// NewReplayClient returns a client that plays back the server messages of
+// a -record transcript instead of talking to a server. What it sends is
+// discarded, so replies match as long as the requests are made in the
+// same order as in the recorded session.
+func NewReplayClient(transcript io.Reader, logger *slog.Logger) (*LSPClient, error) {
+	frames, err := replayFrames(transcript)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	transport := &replayTransport{r: bytes.NewReader(frames)}
+	return &LSPClient{
+		transport: transport,
+		reader:    bufio.NewReader(transport),
+		id:        1,
+		logger:    logger,
+	}, nil
+}
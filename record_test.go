@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	var out strings.Builder
+	rec := newRecorder(&out)
+	rec.record("send", []byte(`{"jsonrpc":"2.0","id":1,"method":"initialize"}`))
+	rec.record("recv", []byte(`not json`))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %s", len(lines), out.String())
+	}
+	var entry recordEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Direction != "send" || entry.Time.IsZero() || string(entry.Message) != `{"jsonrpc":"2.0","id":1,"method":"initialize"}` {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	if !strings.Contains(lines[1], `"message":"not json"`) {
+		t.Errorf("Expected an invalid body to be kept as a string, got %s", lines[1])
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	client := newEchoServerClient(t)
+	var transcript strings.Builder
+	client.recorder = newRecorder(&transcript)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	recorded, err := client.SendRequest(ctx, "test/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(transcript.String(), `"direction":"send"`) || !strings.Contains(transcript.String(), `"direction":"recv"`) {
+		t.Fatalf("Expected both directions in the transcript, got %s", transcript.String())
+	}
+
+	replay, err := NewReplayClient(strings.NewReader(transcript.String()), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := replay.SendRequest(ctx, "test/echo", nil)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if replayed.ID != recorded.ID || replayed.Result != recorded.Result {
+		t.Errorf("Expected the recorded response %+v, got %+v", recorded, replayed)
+	}
+
+	if _, err := replay.SendRequest(ctx, "test/echo", nil); !isConnectionLost(err) {
+		t.Errorf("Expected EOF once the transcript is exhausted, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// locations extracts a Location[] result, as returned by
+// textDocument/references and often by definition requests, or a single
+// Location. Definition requests may return LocationLink[] instead; a link
+// becomes the Location of its target, with targetUri as the URI and
+// targetSelectionRange (the range of the name, falling back to
+// targetRange) as the range, so both shapes print the same. ok is false
+// for other shapes.
+func locations(result any) ([]Location, bool) {
+	var raw []any
+	switch r := result.(type) {
+	case []any:
+		raw = r
+	case map[string]any:
+		raw = []any{r}
+	default:
+		return nil, false
+	}
+
+	locs := make([]Location, 0, len(raw))
+	for _, entry := range raw {
+		object, ok := entry.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		loc, ok := location(object)
+		if !ok {
+			loc, ok = locationLinkTarget(object)
+		}
+		if !ok {
+			return nil, false
+		}
+		locs = append(locs, loc)
+	}
+	return locs, true
+}
+
+func location(object map[string]any) (Location, bool) {
+	uri, ok := object["uri"].(string)
+	if !ok {
+		return Location{}, false
+	}
+	r, ok := decodeRange(object["range"])
+	return Location{URI: uri, Range: r}, ok
+}
+
+func locationLinkTarget(object map[string]any) (Location, bool) {
+	uri, ok := object["targetUri"].(string)
+	if !ok {
+		return Location{}, false
+	}
+	r, ok := decodeRange(object["targetSelectionRange"])
+	if !ok {
+		r, ok = decodeRange(object["targetRange"])
+	}
+	return Location{URI: uri, Range: r}, ok
+}
+
+func decodeRange(v any) (Range, bool) {
+	object, ok := v.(map[string]any)
+	if !ok {
+		return Range{}, false
+	}
+	data, _ := json.Marshal(object)
+	var r Range
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Range{}, false
+	}
+	return r, true
+}
+
+// displayPath turns a file URI into a path relative to root when it lies
+// inside it, and an absolute path otherwise. Other URIs are kept as they
+// are.
+func displayPath(uri, root string) string {
+	path, err := FileURIToPath(uri)
+	if err != nil {
+		return uri
+	}
+	if root != "" {
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel
+		}
+	}
+	return path
+}
+
+// formatLocations groups locations by file: each file's path is followed
+// by its `line:col` hits, indented and in order. Files are sorted by path
+// and positions are 1-based, as editors show them.
+func formatLocations(locs []Location, root string) string {
+	byPath := make(map[string][]Position)
+	for _, loc := range locs {
+		path := displayPath(loc.URI, root)
+		byPath[path] = append(byPath[path], loc.Range.Start)
+	}
+	paths := make([]string, 0, len(byPath))
+	for path := range byPath {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintln(&b, path)
+		positions := byPath[path]
+		slices.SortFunc(positions, func(a, b Position) int {
+			return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Character, b.Character))
+		})
+		for _, pos := range positions {
+			fmt.Fprintf(&b, "  %d:%d\n", pos.Line+1, pos.Character+1)
+		}
+	}
+	return b.String()
+}
+
+// sortLocations sorts locs into the order formatLocations prints them in.
+func sortLocations(locs []Location, root string) {
+	slices.SortStableFunc(locs, func(a, b Location) int {
+		return cmp.Or(
+			strings.Compare(displayPath(a.URI, root), displayPath(b.URI, root)),
+			cmp.Compare(a.Range.Start.Line, b.Range.Start.Line),
+			cmp.Compare(a.Range.Start.Character, b.Range.Start.Character),
+		)
+	})
+}
+
+// countFiles returns how many distinct documents locs point into.
+func countFiles(locs []Location) int {
+	uris := make(map[string]bool)
+	for _, loc := range locs {
+		uris[loc.URI] = true
+	}
+	return len(uris)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatLocations(t *testing.T) {
+	root := filepath.FromSlash("/project")
+	result := decodeResult(t, `[
+		{"uri": "file:///project/util/util.go", "range": {"start": {"line": 6, "character": 13}, "end": {"line": 6, "character": 16}}},
+		{"uri": "file:///project/main.go", "range": {"start": {"line": 39, "character": 1}, "end": {"line": 39, "character": 4}}},
+		{"uri": "file:///project/main.go", "range": {"start": {"line": 15, "character": 8}, "end": {"line": 15, "character": 11}}},
+		{"uri": "file:///elsewhere/lib.go", "range": {"start": {"line": 0, "character": 0}, "end": {"line": 0, "character": 1}}}
+	]`)
+
+	locs, ok := locations(result)
+	if !ok {
+		t.Fatal("Expected a Location array")
+	}
+	if n := countFiles(locs); n != 3 {
+		t.Errorf("Expected 3 files, got %d", n)
+	}
+	expected := filepath.FromSlash("/elsewhere/lib.go") + "\n  1:1\n" +
+		"main.go\n  16:9\n  40:2\n" +
+		filepath.FromSlash("util/util.go") + "\n  7:14\n"
+	if got := formatLocations(locs, root); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestLocations_OtherShapes(t *testing.T) {
+	for _, s := range []string{
+		`null`,
+		`"text"`,
+		`[{"name": "main", "kind": 12}]`,
+		`[{"targetUri": "file:///a.go"}]`,
+		`[{"uri": "file:///a.go", "range": "1:1"}]`,
+	} {
+		if _, ok := locations(decodeResult(t, s)); ok {
+			t.Errorf("Expected %s not to be a Location array", s)
+		}
+	}
+	if locs, ok := locations(decodeResult(t, `{"uri": "file:///a.go", "range": {"start": {"line": 1, "character": 2}, "end": {"line": 1, "character": 3}}}`)); !ok || len(locs) != 1 {
+		t.Errorf("Expected a single Location to be accepted, got %v", locs)
+	}
+}
+
+func TestLocations_LocationLinks(t *testing.T) {
+	root := filepath.FromSlash("/project")
+	asLocations := decodeResult(t, `[
+		{"uri": "file:///project/main.go", "range": {"start": {"line": 9, "character": 5}, "end": {"line": 9, "character": 9}}}
+	]`)
+	asLinks := decodeResult(t, `[
+		{
+			"originSelectionRange": {"start": {"line": 2, "character": 1}, "end": {"line": 2, "character": 5}},
+			"targetUri": "file:///project/main.go",
+			"targetRange": {"start": {"line": 8, "character": 0}, "end": {"line": 12, "character": 1}},
+			"targetSelectionRange": {"start": {"line": 9, "character": 5}, "end": {"line": 9, "character": 9}}
+		}
+	]`)
+
+	expected := "main.go\n  10:6\n"
+	for name, result := range map[string]any{"Location": asLocations, "LocationLink": asLinks} {
+		locs, ok := locations(result)
+		if !ok {
+			t.Fatalf("Expected %s[] to be accepted", name)
+		}
+		if got := formatLocations(locs, root); got != expected {
+			t.Errorf("Expected %s[] to print as:\n%s\ngot:\n%s", name, expected, got)
+		}
+	}
+
+	// Without a selection range, the link's whole target range is used.
+	locs, ok := locations(decodeResult(t, `[{"targetUri": "file:///project/a.go", "targetRange": {"start": {"line": 3, "character": 0}, "end": {"line": 4, "character": 0}}}]`))
+	if !ok || len(locs) != 1 || locs[0].Range.Start != (Position{Line: 3}) {
+		t.Errorf("Expected the target range, got %+v", locs)
+	}
+}
+
+func TestDisplayPath(t *testing.T) {
+	root := filepath.FromSlash("/project")
+	tests := []struct {
+		uri      string
+		expected string
+	}{
+		{"file:///project/a/b.go", filepath.FromSlash("a/b.go")},
+		{"file:///projectx/b.go", filepath.FromSlash("/projectx/b.go")},
+		{"file:///b.go", filepath.FromSlash("/b.go")},
+		{"untitled:Untitled-1", "untitled:Untitled-1"},
+	}
+	for _, tt := range tests {
+		if got := displayPath(tt.uri, root); got != tt.expected {
+			t.Errorf("displayPath(%q) = %q, expected %q", tt.uri, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"maps"
+)
+
+// errRenameNotAllowed is returned when prepareRename answers null, the
+// server's way of saying the position can't be renamed.
+var errRenameNotAllowed = errors.New("rename is not allowed at this position (textDocument/prepareRename returned null)")
+
+// supportsPrepareRename reports whether a server with capabilities answers
+// textDocument/prepareRename. Unknown capabilities, as with -skip-init,
+// count as yes.
+func supportsPrepareRename(capabilities map[string]any) bool {
+	if capabilities == nil {
+		return true
+	}
+	provider, _ := capabilities["renameProvider"].(map[string]any)
+	prepare, _ := provider["prepareProvider"].(bool)
+	return prepare
+}
+
+// renameParams returns params, which hold a textDocument and position, with
+// newName added for textDocument/rename.
+func renameParams(params map[string]any, newName string) map[string]any {
+	renamed := maps.Clone(params)
+	renamed["newName"] = newName
+	return renamed
+}
+
+// rename runs textDocument/prepareRename and, only if it accepts the
+// position, textDocument/rename with newName. It returns the method and
+// response to print: the rename, or prepareRename when it failed with an
+// error response. A null prepareRename result is errRenameNotAllowed.
+func rename(send func(method string, params any) (*JSONRPCResponse, error), prepare bool, params map[string]any, newName string) (string, *JSONRPCResponse, error) {
+	if prepare {
+		response, err := send("textDocument/prepareRename", params)
+		switch {
+		case err != nil:
+			return "textDocument/prepareRename", nil, err
+		case response == nil:
+			// Dry run: there is no answer to check.
+		case response.Error != nil:
+			return "textDocument/prepareRename", response, nil
+		case response.Result == nil:
+			return "textDocument/prepareRename", response, errRenameNotAllowed
+		}
+	}
+	response, err := send("textDocument/rename", renameParams(params, newName))
+	return "textDocument/rename", response, err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSupportsPrepareRename(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities map[string]any
+		expected     bool
+	}{
+		{"unknown", nil, true},
+		{"no rename", map[string]any{}, false},
+		{"rename only", map[string]any{"renameProvider": true}, false},
+		{"prepare", map[string]any{"renameProvider": map[string]any{"prepareProvider": true}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := supportsPrepareRename(tt.capabilities); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRename(t *testing.T) {
+	params := textDocumentParams("/a.go", 1, 2)
+	edit := map[string]any{"changes": map[string]any{}}
+
+	tests := []struct {
+		name           string
+		prepare        bool
+		prepareResult  *JSONRPCResponse
+		expectedMethod string
+		expectedErr    error
+		expectedSent   []string
+	}{
+		{
+			name:           "prepared",
+			prepare:        true,
+			prepareResult:  &JSONRPCResponse{Result: map[string]any{"defaultBehavior": true}},
+			expectedMethod: "textDocument/rename",
+			expectedSent:   []string{"textDocument/prepareRename", "textDocument/rename"},
+		},
+		{
+			name:           "not allowed",
+			prepare:        true,
+			prepareResult:  &JSONRPCResponse{},
+			expectedMethod: "textDocument/prepareRename",
+			expectedErr:    errRenameNotAllowed,
+			expectedSent:   []string{"textDocument/prepareRename"},
+		},
+		{
+			name:           "prepare error",
+			prepare:        true,
+			prepareResult:  &JSONRPCResponse{Error: &JSONRPCError{Code: -32803, Message: "no identifier here"}},
+			expectedMethod: "textDocument/prepareRename",
+			expectedSent:   []string{"textDocument/prepareRename"},
+		},
+		{
+			name:           "without prepare",
+			expectedMethod: "textDocument/rename",
+			expectedSent:   []string{"textDocument/rename"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []string
+			send := func(method string, p any) (*JSONRPCResponse, error) {
+				sent = append(sent, method)
+				if method == "textDocument/prepareRename" {
+					if _, ok := p.(map[string]any)["newName"]; ok {
+						t.Error("prepareRename params must not have newName")
+					}
+					return tt.prepareResult, nil
+				}
+				if got := p.(map[string]any)["newName"]; got != "B" {
+					t.Errorf("Expected newName B, got %v", got)
+				}
+				return &JSONRPCResponse{Result: edit}, nil
+			}
+
+			method, response, err := rename(send, tt.prepare, params, "B")
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if method != tt.expectedMethod {
+				t.Errorf("Expected method %s, got %s", tt.expectedMethod, method)
+			}
+			if method == "textDocument/rename" && response.Result == nil {
+				t.Error("Expected the rename result")
+			}
+			if !slices.Equal(sent, tt.expectedSent) {
+				t.Errorf("Expected requests %v, got %v", tt.expectedSent, sent)
+			}
+		})
+	}
+	if _, ok := params["newName"]; ok {
+		t.Error("rename modified the caller's params")
+	}
+}
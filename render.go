@@ -0,0 +1,67 @@
+package main
+
+import "strings"
+
+// hoverText returns the text of a textDocument/hover result. Besides
+// MarkupContent ({kind, value}), contents may be in one of the deprecated
+// forms: a MarkedString or an array of them, joined by blank lines. ok is
+// false for any other shape.
+func hoverText(result any) (string, bool) {
+	hover, ok := result.(map[string]any)
+	if !ok {
+		return "", false
+	}
+	switch contents := hover["contents"].(type) {
+	case map[string]any:
+		if _, ok := contents["kind"].(string); ok {
+			value, ok := contents["value"].(string)
+			return value, ok
+		}
+		return markedStringText(contents)
+	case []any:
+		texts := make([]string, 0, len(contents))
+		for _, c := range contents {
+			text, ok := markedStringText(c)
+			if !ok {
+				return "", false
+			}
+			if text != "" {
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, "\n\n"), true
+	default:
+		return markedStringText(contents)
+	}
+}
+
+// markedStringText returns the text of a MarkedString: either markdown or
+// a {language, value} code block, which is fenced like code in markdown
+// hovers so that -strip-fences treats both alike.
+func markedStringText(s any) (string, bool) {
+	switch s := s.(type) {
+	case string:
+		return s, true
+	case map[string]any:
+		language, lok := s["language"].(string)
+		value, vok := s["value"].(string)
+		if !lok || !vok {
+			return "", false
+		}
+		return "```" + language + "\n" + value + "\n```", true
+	}
+	return "", false
+}
+
+// stripMarkdownFences removes ``` fence lines, keeping the code inside them.
+func stripMarkdownFences(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
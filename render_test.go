@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestHoverText(t *testing.T) {
+	testCases := []struct {
+		name     string
+		result   string
+		expected string
+		ok       bool
+	}{
+		{"markup", `{"contents":{"kind":"markdown","value":"` + "```go\\nfunc main()\\n```" + `"}}`, "```go\nfunc main()\n```", true},
+		{"plaintext", `{"contents":{"kind":"plaintext","value":"int"},"range":{}}`, "int", true},
+		{"marked string", `{"contents":"text"}`, "text", true},
+		{"code marked string", `{"contents":{"language":"go","value":"func main()"}}`, "```go\nfunc main()\n```", true},
+		{"marked strings", `{"contents":[{"language":"go","value":"var x int"},"","x is a number."]}`, "```go\nvar x int\n```\n\nx is a number.", true},
+		{"no contents", `{"contents":[]}`, "", true},
+		{"bad marked string", `{"contents":[{"language":"go"}]}`, "", false},
+		{"missing contents", `{"range":{}}`, "", false},
+		{"not hover", `[{"uri":"file:///a.go"}]`, "", false},
+		{"null", `null`, "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var result any
+			if err := json.Unmarshal([]byte(tc.result), &result); err != nil {
+				t.Fatal(err)
+			}
+			text, ok := hoverText(result)
+			if ok != tc.ok || text != tc.expected {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tc.expected, tc.ok, text, ok)
+			}
+		})
+	}
+}
+
+func TestStripMarkdownFences(t *testing.T) {
+	input := "```go\nfunc main()\n```\n\nmain is the entry point."
+	expected := "func main()\n\nmain is the entry point."
+	if got := stripMarkdownFences(input); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
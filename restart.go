@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"syscall"
+)
+
+// isConnectionLost reports whether err means the server is gone: the
+// transport hit EOF or a broken pipe, or has already been closed.
+func isConnectionLost(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, os.ErrClosed)
+}
+
+// restartClient replaces a client whose server has gone away. It starts a
+// new one with connect, carries over the handlers and request ids,
+// initializes it unless params is nil, and calls replay so the new server
+// sees the same open documents. old is aborted either way.
+func restartClient(ctx context.Context, old *LSPClient, connect func() (*LSPClient, error), params *InitializeParams, replay func(*LSPClient) error, logger *slog.Logger) (*LSPClient, error) {
+	if err := old.Abort(); err != nil {
+		logger.Debug("Error while aborting LSP server", "error", err)
+	}
+
+	client, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	client.carryOverFrom(old)
+
+	if params != nil {
+		if err := client.Initialize(ctx, *params); err != nil {
+			client.Abort()
+			return nil, err
+		}
+	}
+	if err := replay(client); err != nil {
+		client.Abort()
+		return nil, err
+	}
+	return client, nil
+}
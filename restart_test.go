@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsConnectionLost(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{fmt.Errorf("failed to read header line: %w", io.EOF), true},
+		{fmt.Errorf("failed to write request: %w", &os.PathError{Op: "write", Path: "|1", Err: syscall.EPIPE}), true},
+		{io.ErrClosedPipe, true},
+		{context.DeadlineExceeded, false},
+		{&JSONRPCError{Code: -32601, Message: "method not found"}, false},
+		{errors.New("invalid Content-Length"), false},
+	}
+	for _, tc := range testCases {
+		if got := isConnectionLost(tc.err); got != tc.expected {
+			t.Errorf("isConnectionLost(%v) = %v, expected %v", tc.err, got, tc.expected)
+		}
+	}
+}
+
+func TestRestartClient(t *testing.T) {
+	crashed, crashedConn := newPipeClient(t)
+	crashedConn.Close()
+	crashed.OnNotification("test/event", func(json.RawMessage) {})
+	crashed.id = 7
+
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+	initialized := make(chan int, 1)
+	go serveInitialize(serverConn, 0, initialized)
+
+	connect := func() (*LSPClient, error) {
+		return &LSPClient{
+			transport: clientConn,
+			reader:    bufio.NewReader(clientConn),
+			id:        1,
+			logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		}, nil
+	}
+	replayed := false
+	replay := func(c *LSPClient) error {
+		replayed = true
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	params := newInitializeParams("file:///src")
+	got, err := restartClient(ctx, crashed, connect, &params, replay, crashed.logger)
+	if err != nil {
+		t.Fatalf("restartClient failed: %v", err)
+	}
+	<-initialized
+
+	if !crashed.closed {
+		t.Error("Expected the old client to be aborted")
+	}
+	if !replayed {
+		t.Error("Expected documents to be replayed")
+	}
+	if len(got.notificationHandlers["test/event"]) != 1 {
+		t.Error("Expected notification handlers to carry over to the restarted client")
+	}
+	// initialize took id 7, where the crashed client left off.
+	if got.NextID() != 8 {
+		t.Errorf("Expected request ids to continue at 8, got %d", got.NextID())
+	}
+}
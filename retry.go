@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// initBackoff is the delay before the first initialize retry. It doubles
+// after every further failed attempt.
+var initBackoff = 500 * time.Millisecond
+
+// initializeWithRetries calls Initialize up to attempts times, each bounded by
+// attemptTimeout. A JSON-RPC error means the server is running but not ready
+// yet, so the next attempt reuses the connection. Any other failure, such as
+// a timeout or a broken pipe, means the server is hung or gone, so it is
+// aborted and connect starts a fresh one. The returned client is the one
+// that was last used and must be closed by the caller.
+func initializeWithRetries(ctx context.Context, client *LSPClient, connect func() (*LSPClient, error), params InitializeParams, attempts int, attemptTimeout time.Duration, logger *slog.Logger) (*LSPClient, error) {
+	backoff := initBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		err := client.Initialize(attemptCtx, params)
+		cancel()
+		if err == nil || attempt >= attempts || ctx.Err() != nil {
+			return client, err
+		}
+
+		logger.Warn("Failed to initialize LSP server, retrying", "attempt", attempt, "attempts", attempts, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return client, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		var rpcErr *JSONRPCError
+		if errors.As(err, &rpcErr) {
+			continue
+		}
+
+		logger.Warn("Restarting LSP server", "attempt", attempt+1)
+		if err := client.Abort(); err != nil {
+			logger.Debug("Error while aborting LSP server", "error", err)
+		}
+		next, err := connect()
+		if err != nil {
+			return client, err
+		}
+		next.carryOverFrom(client)
+		client = next
+	}
+}
+
+// carryOverFrom registers the server request and notification handlers
+// of old on c and continues its request ids, so a restarted client behaves
+// like the one it replaces and a -record transcript never repeats an id.
+func (c *LSPClient) carryOverFrom(old *LSPClient) {
+	old.mu.Lock()
+	handlers := old.handlers
+	notificationHandlers := old.notificationHandlers
+	id := old.id
+	old.mu.Unlock()
+
+	c.mu.Lock()
+	c.id = id
+	c.mu.Unlock()
+
+	for method, handler := range handlers {
+		c.HandleServerRequest(method, handler)
+	}
+	for method, list := range notificationHandlers {
+		for _, handler := range list {
+			c.OnNotification(method, handler)
+		}
+	}
+}
+
+// isServerNotInitialized reports whether response is the ServerNotInitialized
+// error servers answer requests sent before initialize with.
+func isServerNotInitialized(response *JSONRPCResponse) bool {
+	return response != nil && response.Error != nil && response.Error.Code == -32002
+}
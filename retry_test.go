@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveInitialize answers initialize requests on conn, failing the first
+// failures of them with ServerNotInitialized-style errors. It reports the
+// number of initialize requests seen on initialized.
+func serveInitialize(conn net.Conn, failures int, initialized chan<- int) {
+	reader := bufio.NewReader(conn)
+	seen := 0
+	for {
+		content, err := readTestFrame(reader)
+		if err != nil {
+			return
+		}
+		var request JSONRPCRequest
+		json.Unmarshal(content, &request)
+		switch request.Method {
+		case "initialize":
+			seen++
+			if seen <= failures {
+				writeTestFrame(conn, JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(*request.ID), Error: &JSONRPCError{Code: -32002, Message: "not ready"}})
+				continue
+			}
+			writeTestFrame(conn, JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(*request.ID), Result: map[string]any{"capabilities": map[string]any{}}})
+		case "initialized":
+			initialized <- seen
+		}
+	}
+}
+
+func withFastBackoff(t *testing.T) {
+	t.Helper()
+	saved := initBackoff
+	initBackoff = time.Millisecond
+	t.Cleanup(func() { initBackoff = saved })
+}
+
+func TestInitializeWithRetries_ReusesConnectionOnError(t *testing.T) {
+	withFastBackoff(t)
+	client, serverConn := newPipeClient(t)
+	initialized := make(chan int, 1)
+	go serveInitialize(serverConn, 2, initialized)
+
+	connect := func() (*LSPClient, error) {
+		t.Error("Expected no restart after a JSON-RPC error")
+		return nil, io.EOF
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got, err := initializeWithRetries(ctx, client, connect, newInitializeParams("file:///src"), 3, time.Second, client.logger)
+	if err != nil {
+		t.Fatalf("Expected the third attempt to succeed, got %v", err)
+	}
+	if got != client {
+		t.Error("Expected the original client to be reused")
+	}
+	if attempts := <-initialized; attempts != 3 {
+		t.Errorf("Expected 3 initialize requests, got %d", attempts)
+	}
+}
+
+func TestInitializeWithRetries_GivesUp(t *testing.T) {
+	withFastBackoff(t)
+	client, serverConn := newPipeClient(t)
+	go serveInitialize(serverConn, 5, make(chan int, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := initializeWithRetries(ctx, client, nil, newInitializeParams("file:///src"), 2, time.Second, client.logger)
+	if err == nil {
+		t.Fatal("Expected an error after running out of attempts")
+	}
+}
+
+func TestInitializeWithRetries_RestartsHungServer(t *testing.T) {
+	withFastBackoff(t)
+	// The first server reads requests but never answers.
+	hung, hungConn := newPipeClient(t)
+	go io.Copy(io.Discard, hungConn)
+	hung.OnNotification("test/event", func(json.RawMessage) {})
+
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+	initialized := make(chan int, 1)
+	go serveInitialize(serverConn, 0, initialized)
+
+	restarts := 0
+	connect := func() (*LSPClient, error) {
+		restarts++
+		return &LSPClient{
+			transport: clientConn,
+			reader:    bufio.NewReader(clientConn),
+			id:        1,
+			logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got, err := initializeWithRetries(ctx, hung, connect, newInitializeParams("file:///src"), 2, 50*time.Millisecond, hung.logger)
+	if err != nil {
+		t.Fatalf("Expected the restarted server to initialize, got %v", err)
+	}
+	if restarts != 1 || got == hung {
+		t.Errorf("Expected exactly one restart, got %d", restarts)
+	}
+	<-initialized
+	if len(got.notificationHandlers["test/event"]) != 1 {
+		t.Error("Expected notification handlers to carry over to the restarted client")
+	}
+	if got.NextID() <= hung.NextID() {
+		t.Errorf("Expected request ids to keep increasing after the restart, got %d after %d", got.NextID(), hung.NextID())
+	}
+	if !hung.closed {
+		t.Error("Expected the hung client to be aborted")
+	}
+}
+
+func TestIsServerNotInitialized(t *testing.T) {
+	tests := []struct {
+		name     string
+		response *JSONRPCResponse
+		expected bool
+	}{
+		{"not initialized", &JSONRPCResponse{Error: &JSONRPCError{Code: -32002, Message: "not initialized"}}, true},
+		{"other error", &JSONRPCResponse{Error: &JSONRPCError{Code: -32601, Message: "not found"}}, false},
+		{"result", &JSONRPCResponse{Result: "ok"}, false},
+		{"dry run", nil, false},
+	}
+	for _, tt := range tests {
+		if got := isServerNotInitialized(tt.response); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
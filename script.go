@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ScriptStep is one line of a -script file.
+type ScriptStep struct {
+	Method string
+	Params any
+
+	// Notification steps are sent without waiting for a response.
+	Notification bool
+}
+
+// isNotificationMethod reports whether method is a known notification.
+// Unknown methods are treated as requests.
+func isNotificationMethod(method string) bool {
+	return knownMethods[method].Notification
+}
+
+// parseScript reads a scenario of one `<method> [params JSON]` per line.
+// Blank lines and lines starting with # are skipped.
+func parseScript(r io.Reader) ([]ScriptStep, error) {
+	var steps []ScriptStep
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		method, rest, _ := strings.Cut(line, " ")
+		step := ScriptStep{Method: method, Notification: isNotificationMethod(method)}
+		if rest = strings.TrimSpace(rest); rest != "" {
+			if err := json.Unmarshal([]byte(rest), &step.Params); err != nil {
+				return nil, fmt.Errorf("line %d: invalid params for %s: %w", lineNo, method, err)
+			}
+		}
+		steps = append(steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("script has no steps")
+	}
+	return steps, nil
+}
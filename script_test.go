@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScript(t *testing.T) {
+	input := `# open, ask, close
+textDocument/didOpen {"textDocument":{"uri":"file:///a.go","languageId":"go","version":1,"text":""}}
+
+textDocument/hover {"textDocument":{"uri":"file:///a.go"},"position":{"line":0,"character":0}}
+workspace/symbol
+custom/request {"x":1}
+`
+	steps, err := parseScript(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseScript failed: %v", err)
+	}
+
+	var methods []string
+	var notifications []bool
+	for _, s := range steps {
+		methods = append(methods, s.Method)
+		notifications = append(notifications, s.Notification)
+	}
+	if expected := []string{"textDocument/didOpen", "textDocument/hover", "workspace/symbol", "custom/request"}; !reflect.DeepEqual(methods, expected) {
+		t.Errorf("Expected methods %v, got %v", expected, methods)
+	}
+	if expected := []bool{true, false, false, false}; !reflect.DeepEqual(notifications, expected) {
+		t.Errorf("Expected notification flags %v, got %v", expected, notifications)
+	}
+	if steps[2].Params != nil {
+		t.Errorf("Expected no params for workspace/symbol, got %v", steps[2].Params)
+	}
+	if expected := map[string]any{"x": float64(1)}; !reflect.DeepEqual(steps[3].Params, expected) {
+		t.Errorf("Expected params %v, got %v", expected, steps[3].Params)
+	}
+}
+
+func TestParseScript_Errors(t *testing.T) {
+	testCases := map[string]string{
+		"bad params": "textDocument/hover {not json}",
+		"empty":      "# nothing\n\n",
+	}
+	for name, input := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseScript(strings.NewReader(input)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
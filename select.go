@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// selectPath extracts the part of v named by a dotted path such as
+// contents.value or [0].location.uri. Object keys are separated by dots
+// and array elements are addressed with [n].
+func selectPath(v any, path string) (any, error) {
+	current := v
+	walked := ""
+	rest := path
+	for rest != "" {
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: missing ]", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid path %q: bad index %q", path, rest[1:end])
+			}
+			walked += rest[:end+1]
+			rest = rest[end+1:]
+
+			array, ok := current.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s is not an array", describePath(walked))
+			}
+			if index >= len(array) {
+				return nil, fmt.Errorf("%s does not exist: the array has %d elements", describePath(walked), len(array))
+			}
+			current = array[index]
+		case rest[0] == '.':
+			if walked == "" {
+				return nil, fmt.Errorf("invalid path %q: leading dot", path)
+			}
+			rest = rest[1:]
+			if rest == "" || rest[0] == '.' || rest[0] == '[' {
+				return nil, fmt.Errorf("invalid path %q: empty key", path)
+			}
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if walked != "" {
+				walked += "."
+			}
+			walked += key
+			rest = rest[end:]
+
+			object, ok := current.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s does not exist: the parent is not an object", describePath(walked))
+			}
+			value, ok := object[key]
+			if !ok {
+				return nil, fmt.Errorf("%s does not exist", describePath(walked))
+			}
+			current = value
+		}
+	}
+	return current, nil
+}
+
+func describePath(path string) string {
+	return fmt.Sprintf("result path %q", path)
+}
+
+// selectsError reports whether path picks from the error of an error
+// response, as in error.data, rather than from a result.
+func selectsError(path string) bool {
+	return path == "error" || strings.HasPrefix(path, "error.") || strings.HasPrefix(path, "error[")
+}
+
+// errorResponseValue returns the error of a response as the JSON value
+// selectPath walks for error paths: {"error": {"code", "message", "data"}}.
+func errorResponseValue(e *JSONRPCError) any {
+	var value any
+	data, _ := json.Marshal(e)
+	json.Unmarshal(data, &value)
+	return map[string]any{"error": value}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectPath(t *testing.T) {
+	var result any
+	json.Unmarshal([]byte(`{
+		"contents": {"kind": "markdown", "value": "func main()"},
+		"items": [{"label": "a"}, {"label": "b", "tags": [1, 2]}],
+		"count": 2
+	}`), &result)
+	var locations any
+	json.Unmarshal([]byte(`[{"location": {"uri": "file:///a.go"}}]`), &locations)
+
+	testCases := []struct {
+		name     string
+		value    any
+		path     string
+		expected any
+	}{
+		{"nested key", result, "contents.value", "func main()"},
+		{"subtree", result, "contents", map[string]any{"kind": "markdown", "value": "func main()"}},
+		{"index after key", result, "items[1].label", "b"},
+		{"double index", result, "items[1].tags[0]", float64(1)},
+		{"number", result, "count", float64(2)},
+		{"leading index", locations, "[0].location.uri", "file:///a.go"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := selectPath(tc.value, tc.path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSelectPath_Errors(t *testing.T) {
+	var result any
+	json.Unmarshal([]byte(`{"contents": {"value": "x"}, "items": [1]}`), &result)
+
+	testCases := []struct {
+		value any
+		path  string
+		want  string
+	}{
+		{result, "contents.missing", `"contents.missing" does not exist`},
+		{result, "items[3]", "has 1 elements"},
+		{result, "contents[0]", "is not an array"},
+		{result, "items[0].x", "parent is not an object"},
+		{nil, "contents", "does not exist"},
+		{result, "items[x]", "bad index"},
+		{result, "items[0", "missing ]"},
+		{result, ".contents", "leading dot"},
+		{result, "contents..value", "empty key"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			_, err := selectPath(tc.value, tc.path)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestSelectsError(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"error":         true,
+		"error.data":    true,
+		"error[0]":      true,
+		"errors":        false,
+		"contents":      false,
+		"[0].error":     false,
+		"errorMessages": false,
+	} {
+		if got := selectsError(path); got != expected {
+			t.Errorf("selectsError(%q) = %v, expected %v", path, got, expected)
+		}
+	}
+}
+
+func TestSelectPath_ErrorResponse(t *testing.T) {
+	e := &JSONRPCError{Code: -32603, Message: "internal error", Data: map[string]any{"stack": "line 1\nline 2"}}
+	value := errorResponseValue(e)
+
+	testCases := []struct {
+		path     string
+		expected any
+	}{
+		{"error.data.stack", "line 1\nline 2"},
+		{"error.message", "internal error"},
+		{"error.code", float64(-32603)},
+	}
+	for _, tc := range testCases {
+		got, err := selectPath(value, tc.path)
+		if err != nil {
+			t.Fatalf("selectPath(%q): %v", tc.path, err)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("selectPath(%q) = %v, expected %v", tc.path, got, tc.expected)
+		}
+	}
+
+	if _, err := selectPath(errorResponseValue(&JSONRPCError{Code: 1, Message: "no data"}), "error.data"); err == nil {
+		t.Error("Expected an error selecting missing data")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// standardTokenTypes and standardTokenModifiers are the token types and
+// modifiers defined by the spec, which clsp advertises.
+var (
+	standardTokenTypes = []string{
+		"namespace", "type", "class", "enum", "interface", "struct", "typeParameter", "parameter",
+		"variable", "property", "enumMember", "event", "function", "method", "macro", "keyword",
+		"modifier", "comment", "string", "number", "regexp", "operator", "decorator",
+	}
+	standardTokenModifiers = []string{
+		"declaration", "definition", "readonly", "static", "deprecated", "abstract", "async",
+		"modification", "documentation", "defaultLibrary",
+	}
+)
+
+// SemanticTokensLegend maps the indices of encoded tokens to names.
+type SemanticTokensLegend struct {
+	TokenTypes     []string `json:"tokenTypes"`
+	TokenModifiers []string `json:"tokenModifiers"`
+}
+
+// semanticTokensLegend returns the legend of the semanticTokensProvider in
+// the server's capabilities.
+func semanticTokensLegend(capabilities map[string]any) (SemanticTokensLegend, bool) {
+	provider, _ := capabilities["semanticTokensProvider"].(map[string]any)
+	object, ok := provider["legend"].(map[string]any)
+	if !ok {
+		return SemanticTokensLegend{}, false
+	}
+	data, _ := json.Marshal(object)
+	var legend SemanticTokensLegend
+	if err := json.Unmarshal(data, &legend); err != nil {
+		return SemanticTokensLegend{}, false
+	}
+	return legend, true
+}
+
+// isSemanticTokens reports whether method is one of the semantic tokens
+// requests.
+func isSemanticTokens(method string) bool {
+	return strings.HasPrefix(method, "textDocument/semanticTokens/")
+}
+
+// semanticTokenData extracts the data array of a SemanticTokens result, as
+// returned by textDocument/semanticTokens/full and /range. ok is false for
+// other shapes, including the edits of a /full/delta result.
+func semanticTokenData(result any) ([]int, bool) {
+	object, ok := result.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	raw, ok := object["data"].([]any)
+	if !ok || len(raw)%5 != 0 {
+		return nil, false
+	}
+	data := make([]int, len(raw))
+	for i, v := range raw {
+		n, ok := v.(float64)
+		if !ok || n < 0 || n != float64(int(n)) {
+			return nil, false
+		}
+		data[i] = int(n)
+	}
+	return data, true
+}
+
+// semanticToken is a decoded token. Line and Character are 0-based, and
+// Character and Length count UTF-16 code units.
+type semanticToken struct {
+	Line, Character, Length int
+	Type                    string
+	Modifiers               []string
+}
+
+// decodeSemanticTokens turns the relative encoding of data, five integers
+// per token, into absolute tokens named by legend. Indices the legend
+// doesn't cover are shown as #n.
+func decodeSemanticTokens(data []int, legend SemanticTokensLegend) []semanticToken {
+	tokens := make([]semanticToken, 0, len(data)/5)
+	line, character := 0, 0
+	for i := 0; i+5 <= len(data); i += 5 {
+		// The start is relative to the previous token's on the same line,
+		// and absolute on a new one.
+		if data[i] > 0 {
+			line += data[i]
+			character = data[i+1]
+		} else {
+			character += data[i+1]
+		}
+		token := semanticToken{
+			Line:      line,
+			Character: character,
+			Length:    data[i+2],
+			Type:      legendName(legend.TokenTypes, data[i+3]),
+		}
+		for bit, mask := 0, data[i+4]; mask != 0; bit, mask = bit+1, mask>>1 {
+			if mask&1 != 0 {
+				token.Modifiers = append(token.Modifiers, legendName(legend.TokenModifiers, bit))
+			}
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func legendName(names []string, i int) string {
+	if i < len(names) {
+		return names[i]
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+// formatSemanticTokens renders one aligned `line:col  length  type
+// modifiers` line per token, with 1-based positions. When text is given,
+// the token's text, located with the position encoding, is appended.
+func formatSemanticTokens(tokens []semanticToken, text *string, encoding string) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, t := range tokens {
+		modifiers := "-"
+		if len(t.Modifiers) > 0 {
+			modifiers = strings.Join(t.Modifiers, ",")
+		}
+		fmt.Fprintf(w, "%d:%d\t%d\t%s\t%s", t.Line+1, t.Character+1, t.Length, t.Type, modifiers)
+		if text != nil {
+			start := positionOffset(*text, Position{Line: t.Line, Character: t.Character}, encoding)
+			end := positionOffset(*text, Position{Line: t.Line, Character: t.Character + t.Length}, encoding)
+			fmt.Fprintf(w, "\t%q", (*text)[start:end])
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	return b.String()
+}
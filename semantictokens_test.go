@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeSemanticTokens(t *testing.T) {
+	legend := SemanticTokensLegend{
+		TokenTypes:     []string{"keyword", "function", "variable"},
+		TokenModifiers: []string{"declaration", "readonly"},
+	}
+	data := []int{
+		0, 0, 7, 0, 0, // package
+		2, 5, 4, 1, 1, // main, declaration
+		0, 6, 1, 2, 3, // x on the same line, declaration and readonly
+		1, 2, 3, 5, 4, // unknown type and modifier
+	}
+	expected := []semanticToken{
+		{Line: 0, Character: 0, Length: 7, Type: "keyword"},
+		{Line: 2, Character: 5, Length: 4, Type: "function", Modifiers: []string{"declaration"}},
+		{Line: 2, Character: 11, Length: 1, Type: "variable", Modifiers: []string{"declaration", "readonly"}},
+		{Line: 3, Character: 2, Length: 3, Type: "#5", Modifiers: []string{"#2"}},
+	}
+	if got := decodeSemanticTokens(data, legend); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestSemanticTokenData(t *testing.T) {
+	data, ok := semanticTokenData(decodeResult(t, `{"resultId":"1","data":[0,1,2,3,4]}`))
+	if !ok || !reflect.DeepEqual(data, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("Expected [0 1 2 3 4], got %v, %v", data, ok)
+	}
+
+	for _, result := range []string{
+		`null`,
+		`{"resultId":"2","edits":[]}`,
+		`{"data":[0,1,2,3]}`,
+		`{"data":[0,1,2,3,"4"]}`,
+		`{"data":[0,1,2,3,-4]}`,
+	} {
+		if _, ok := semanticTokenData(decodeResult(t, result)); ok {
+			t.Errorf("Expected %s not to be semantic tokens", result)
+		}
+	}
+}
+
+func TestSemanticTokensLegend(t *testing.T) {
+	capabilities := decodeResult(t, `{"semanticTokensProvider":{"legend":{"tokenTypes":["type"],"tokenModifiers":["static"]},"full":true}}`).(map[string]any)
+	legend, ok := semanticTokensLegend(capabilities)
+	if !ok || !reflect.DeepEqual(legend, SemanticTokensLegend{TokenTypes: []string{"type"}, TokenModifiers: []string{"static"}}) {
+		t.Errorf("Expected the advertised legend, got %+v, %v", legend, ok)
+	}
+	if _, ok := semanticTokensLegend(nil); ok {
+		t.Error("Expected no legend without capabilities")
+	}
+}
+
+func TestFormatSemanticTokens(t *testing.T) {
+	tokens := []semanticToken{
+		{Line: 0, Character: 0, Length: 7, Type: "keyword"},
+		{Line: 1, Character: 3, Length: 2, Type: "variable", Modifiers: []string{"declaration", "readonly"}},
+	}
+	text := "package main\nx, 😀y := 1\n"
+
+	expected := "1:1  7  keyword   -\n" +
+		"2:4  2  variable  declaration,readonly\n"
+	if got := formatSemanticTokens(tokens, nil, encodingUTF16); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	expected = "1:1  7  keyword   -                     \"package\"\n" +
+		"2:4  2  variable  declaration,readonly  \"😀\"\n"
+	if got := formatSemanticTokens(tokens, &text, encodingUTF16); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
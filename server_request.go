@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ServerRequestHandler answers a request sent by the server, such as
+// workspace/configuration. The returned value becomes the result of the
+// reply. Returning a *JSONRPCError sends that error instead; any other error
+// is reported as an internal error.
+//
+// Handlers run while a response is being read, so they must not send
+// requests themselves.
+type ServerRequestHandler func(params json.RawMessage) (any, error)
+
+// defaultServerRequestHandlers are used for methods without a registered
+// handler whose reply can't simply be null.
+var defaultServerRequestHandlers = map[string]ServerRequestHandler{
+	// The reply must hold one entry per requested item.
+	"workspace/configuration": func(params json.RawMessage) (any, error) {
+		var p struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &JSONRPCError{Code: -32602, Message: err.Error()}
+		}
+		return make([]any, len(p.Items)), nil
+	},
+}
+
+// serverResponse is a reply to a server request. The ID is echoed back
+// verbatim because servers may use string IDs.
+type serverResponse struct {
+	JSONRPC string          `json:"jsonrpc,omitempty"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+}
+
+// HandleServerRequest registers handler for requests the server sends with
+// the given method. Requests without a handler are answered with a null
+// result.
+func (c *LSPClient) HandleServerRequest(method string, handler ServerRequestHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.handlers == nil {
+		c.handlers = make(map[string]ServerRequestHandler)
+	}
+	c.handlers[method] = handler
+}
+
+func (c *LSPClient) serverRequestHandler(method string) ServerRequestHandler {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if handler, ok := c.handlers[method]; ok {
+		return handler
+	}
+	return defaultServerRequestHandlers[method]
+}
+
+func (c *LSPClient) replyToServerRequest(id json.RawMessage, method string, params json.RawMessage) error {
+	reply := serverResponse{
+		JSONRPC: c.jsonrpcField(),
+		ID:      id,
+		Result:  json.RawMessage("null"),
+	}
+
+	if handler := c.serverRequestHandler(method); handler != nil {
+		result, err := handler(params)
+		if err != nil {
+			var rpcErr *JSONRPCError
+			if !errors.As(err, &rpcErr) {
+				rpcErr = &JSONRPCError{Code: -32603, Message: err.Error()}
+			}
+			reply.Result = nil
+			reply.Error = rpcErr
+		} else {
+			data, err := json.Marshal(result)
+			if err != nil {
+				return fmt.Errorf("failed to marshal reply to %s: %w", method, err)
+			}
+			reply.Result = data
+		}
+	}
+
+	c.logger.Debug("Replying to LSP server request", "method", method, "id", string(id), "hasError", reply.Error != nil)
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reply to %s: %w", method, err)
+	}
+	if err := c.writeFrame(data); err != nil {
+		return fmt.Errorf("failed to write reply to %s: %w", method, err)
+	}
+	return nil
+}
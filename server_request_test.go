@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// exchangeServerRequest makes the server send serverRequest while the client
+// waits on a request, and returns the client's reply to it.
+func exchangeServerRequest(t *testing.T, client *LSPClient, serverConn net.Conn, serverRequest map[string]any) serverResponse {
+	t.Helper()
+
+	replies := make(chan serverResponse, 1)
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		content, err := readTestFrame(reader)
+		if err != nil {
+			return
+		}
+		var request JSONRPCRequest
+		json.Unmarshal(content, &request)
+
+		writeTestFrame(serverConn, serverRequest)
+
+		content, err = readTestFrame(reader)
+		if err != nil {
+			return
+		}
+		var reply serverResponse
+		json.Unmarshal(content, &reply)
+		replies <- reply
+
+		writeTestFrame(serverConn, JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(*request.ID), Result: "done"})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := client.SendRequest(ctx, "test/method", nil)
+	if err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+	if response.Result != "done" {
+		t.Errorf("Expected result done, got %v", response.Result)
+	}
+
+	select {
+	case reply := <-replies:
+		return reply
+	default:
+		t.Fatal("Server never received a reply")
+		return serverResponse{}
+	}
+}
+
+func TestServerRequest_DefaultNullReply(t *testing.T) {
+	client, serverConn := newPipeClient(t)
+
+	reply := exchangeServerRequest(t, client, serverConn, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      "srv-1",
+		"method":  "window/showMessageRequest",
+		"params":  map[string]any{"type": 3, "message": "pick one"},
+	})
+
+	if string(reply.ID) != `"srv-1"` {
+		t.Errorf("Expected reply ID \"srv-1\", got %s", reply.ID)
+	}
+	if string(reply.Result) != "null" {
+		t.Errorf("Expected null result, got %s", reply.Result)
+	}
+	if reply.Error != nil {
+		t.Errorf("Expected no error, got %v", reply.Error)
+	}
+}
+
+func TestServerRequest_WorkspaceConfiguration(t *testing.T) {
+	client, serverConn := newPipeClient(t)
+
+	reply := exchangeServerRequest(t, client, serverConn, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      7,
+		"method":  "workspace/configuration",
+		"params":  map[string]any{"items": []any{map[string]any{"section": "gopls"}, map[string]any{"section": "go"}}},
+	})
+
+	if string(reply.Result) != "[null,null]" {
+		t.Errorf("Expected one null per item, got %s", reply.Result)
+	}
+}
+
+func TestServerRequest_RegisteredHandler(t *testing.T) {
+	client, serverConn := newPipeClient(t)
+	client.HandleServerRequest("custom/ask", func(params json.RawMessage) (any, error) {
+		return map[string]any{"answer": 42}, nil
+	})
+	client.HandleServerRequest("custom/fail", func(params json.RawMessage) (any, error) {
+		return nil, errors.New("boom")
+	})
+
+	reply := exchangeServerRequest(t, client, serverConn, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "custom/ask",
+	})
+	if string(reply.Result) != `{"answer":42}` {
+		t.Errorf("Expected handler result, got %s", reply.Result)
+	}
+
+	reply = exchangeServerRequest(t, client, serverConn, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  "custom/fail",
+	})
+	if reply.Error == nil || reply.Error.Code != -32603 || reply.Error.Message != "boom" {
+		t.Errorf("Expected internal error boom, got %+v", reply.Error)
+	}
+	if reply.Result != nil {
+		t.Errorf("Expected no result alongside an error, got %s", reply.Result)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	client, serverConn := newPipeClient(t)
+	var notified json.RawMessage
+	client.OnNotification("window/logMessage", func(params json.RawMessage) {
+		notified = params
+	})
+
+	// A message with a method is a request even if it also has a result.
+	replies := make(chan serverResponse, 1)
+	go func() {
+		content, err := readTestFrame(bufio.NewReader(serverConn))
+		if err != nil {
+			return
+		}
+		var reply serverResponse
+		json.Unmarshal(content, &reply)
+		replies <- reply
+	}()
+	response, err := client.dispatch([]byte(`{"jsonrpc":"2.0","id":3,"method":"custom/ask","result":"stray"}`))
+	if err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	if response != nil {
+		t.Errorf("Expected a server request, got response %+v", response)
+	}
+	select {
+	case reply := <-replies:
+		if string(reply.ID) != "3" {
+			t.Errorf("Expected a reply to id 3, got %s", reply.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server never received a reply")
+	}
+
+	response, err = client.dispatch([]byte(`{"jsonrpc":"2.0","method":"window/logMessage","params":{"message":"hi"}}`))
+	if err != nil || response != nil {
+		t.Errorf("Expected a notification, got %+v, %v", response, err)
+	}
+	if string(notified) != `{"message":"hi"}` {
+		t.Errorf("Expected notification params, got %s", notified)
+	}
+
+	response, err = client.dispatch([]byte(`{"jsonrpc":"2.0","id":"4","result":{"ok":true}}`))
+	if err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	if response == nil || !response.ID.Matches(4) || response.Result.(map[string]any)["ok"] != true {
+		t.Errorf("Expected the response to id 4, got %+v", response)
+	}
+
+	response, err = client.dispatch([]byte(`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`))
+	if err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	if response == nil || response.ID.String() != "null" || response.Error == nil || response.Error.Code != -32700 {
+		t.Errorf("Expected an error response with a null id, got %+v", response)
+	}
+
+	for _, content := range []string{`{"jsonrpc":`, `{"id":{"nested":1},"result":1}`} {
+		if _, err := client.dispatch([]byte(content)); err == nil {
+			t.Errorf("Expected an error for %s", content)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// flagChoices lists the values of flags that take one of a fixed set, for
+// shell completion.
+var flagChoices = map[string][]string{
+	"format":            {"pretty", "json", "ndjson", "raw", "text", "completion", "diagnostics", "references", "diff", "signature", "tokens"},
+	"color":             {"auto", "always", "never"},
+	"trace":             {"off", "messages", "verbose"},
+	"log-format":        {"text", "json"},
+	"capabilities-mode": {"merge", "replace"},
+	"completion":        {"bash", "zsh", "fish"},
+	"call-hierarchy":    {"incoming", "outgoing"},
+}
+
+// methodFlags are the flags that take an LSP method name.
+var methodFlags = []string{"method", "wait-for"}
+
+// completionFlag is a flag as the completion scripts see it.
+type completionFlag struct {
+	name    string
+	usage   string
+	kind    string // "bool", "method", "choice", "string" (a path, usually) or "other"
+	choices []string
+}
+
+func completionFlags(fs *flag.FlagSet) []completionFlag {
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		typeName, usage := flag.UnquoteUsage(f)
+		cf := completionFlag{name: f.Name, usage: usage}
+		switch {
+		case typeName == "":
+			cf.kind = "bool"
+		case slices.Contains(methodFlags, f.Name):
+			cf.kind = "method"
+		case flagChoices[f.Name] != nil:
+			cf.kind, cf.choices = "choice", flagChoices[f.Name]
+		case typeName == "string" || typeName == "value":
+			cf.kind = "string"
+		default:
+			cf.kind = "other"
+		}
+		flags = append(flags, cf)
+	})
+	return flags
+}
+
+// writeCompletion writes a completion script for shell that completes the
+// flags of fs, the values of flags with fixed choices and the known
+// method names.
+func writeCompletion(w io.Writer, shell string, fs *flag.FlagSet) error {
+	flags := completionFlags(fs)
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, flags)
+	case "zsh":
+		writeZshCompletion(w, flags)
+	case "fish":
+		writeFishCompletion(w, flags)
+	default:
+		return fmt.Errorf("unknown shell %q (want bash, zsh or fish)", shell)
+	}
+	return nil
+}
+
+func methodNames() []string {
+	names := make([]string, len(commonMethods))
+	for i, m := range commonMethods {
+		names[i] = m.Name
+	}
+	return names
+}
+
+func writeBashCompletion(w io.Writer, flags []completionFlag) {
+	// compgen -W expands its word list, so the $ of $/cancelRequest and
+	// friends must be escaped.
+	methods := strings.ReplaceAll(strings.Join(methodNames(), " "), "$", `\$`)
+
+	var names, methodCases, noFileCases []string
+	choiceCases := make(map[string]string)
+	for _, f := range flags {
+		names = append(names, "-"+f.name)
+		switch f.kind {
+		case "method":
+			methodCases = append(methodCases, "-"+f.name)
+		case "choice":
+			choiceCases["-"+f.name] = strings.Join(f.choices, " ")
+		case "other":
+			noFileCases = append(noFileCases, "-"+f.name)
+		}
+	}
+
+	fmt.Fprintln(w, "# bash completion for clsp")
+	fmt.Fprintln(w, "_clsp() {")
+	fmt.Fprintln(w, `    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"`)
+	fmt.Fprintln(w, `    case "$prev" in`)
+	fmt.Fprintf(w, "        %s)\n", strings.Join(methodCases, "|"))
+	fmt.Fprintf(w, "            COMPREPLY=($(compgen -W '%s' -- \"$cur\"))\n", methods)
+	fmt.Fprintln(w, "            return ;;")
+	for _, f := range flags {
+		if choices, ok := choiceCases["-"+f.name]; ok {
+			fmt.Fprintf(w, "        -%s)\n", f.name)
+			fmt.Fprintf(w, "            COMPREPLY=($(compgen -W '%s' -- \"$cur\"))\n", choices)
+			fmt.Fprintln(w, "            return ;;")
+		}
+	}
+	if len(noFileCases) > 0 {
+		fmt.Fprintf(w, "        %s)\n", strings.Join(noFileCases, "|"))
+		fmt.Fprintln(w, "            return ;;")
+	}
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w, `    if [[ "$cur" == -* ]]; then`)
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W '%s' -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintln(w, "        return")
+	fmt.Fprintln(w, "    fi")
+	fmt.Fprintln(w, `    COMPREPLY=($(compgen -f -- "$cur"))`)
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o filenames -F _clsp clsp")
+}
+
+// zshQuote quotes s for a single-quoted zsh string inside an _arguments
+// spec, where brackets and colons are special.
+func zshQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	for _, special := range []string{"[", "]", ":"} {
+		s = strings.ReplaceAll(s, special, `\`+special)
+	}
+	return strings.ReplaceAll(s, "'", `'\''`)
+}
+
+func writeZshCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprintln(w, "#compdef clsp")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "_clsp_methods() {")
+	fmt.Fprintln(w, "    local -a methods")
+	fmt.Fprintln(w, "    methods=(")
+	for _, m := range commonMethods {
+		fmt.Fprintf(w, "        '%s:%s'\n", zshQuote(m.Name), zshQuote(m.Description))
+	}
+	fmt.Fprintln(w, "    )")
+	fmt.Fprintln(w, "    _describe -t methods 'LSP method' methods")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "_arguments \\")
+	var specs []string
+	for _, f := range flags {
+		spec := fmt.Sprintf("-%s[%s]", f.name, zshQuote(f.usage))
+		switch f.kind {
+		case "method":
+			spec += ":method:_clsp_methods"
+		case "choice":
+			spec += fmt.Sprintf(":%s:(%s)", f.name, strings.Join(f.choices, " "))
+		case "string":
+			spec += ":" + f.name + ":_files"
+		case "other":
+			spec += ":" + f.name + ": "
+		}
+		specs = append(specs, "'"+spec+"'")
+	}
+	fmt.Fprintf(w, "    %s\n", strings.Join(specs, " \\\n    "))
+}
+
+// fishQuote quotes s as a single-quoted fish string.
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+func writeFishCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprintln(w, "# fish completion for clsp")
+	fmt.Fprintln(w, "function __clsp_methods")
+	io.WriteString(w, `    printf '%s\t%s\n'`)
+	for _, m := range commonMethods {
+		fmt.Fprintf(w, " \\\n        %s %s", fishQuote(m.Name), fishQuote(m.Description))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "end")
+	fmt.Fprintln(w, "complete -c clsp -f")
+	for _, f := range flags {
+		line := fmt.Sprintf("complete -c clsp -o %s -d %s", f.name, fishQuote(f.usage))
+		switch f.kind {
+		case "method":
+			line += " -x -a '(__clsp_methods)'"
+		case "choice":
+			line += " -x -a " + fishQuote(strings.Join(f.choices, " "))
+		case "string":
+			line += " -r -F"
+		case "other":
+			line += " -x"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
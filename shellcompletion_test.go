@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCompletionFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("clsp", flag.ContinueOnError)
+	fs.String("method", "", "LSP method to call")
+	fs.String("format", "pretty", "Output format")
+	fs.String("file", "", "Build params for this file")
+	fs.Bool("quiet", false, "Only output result data, no 'headers' [or] labels")
+	fs.Duration("timeout", time.Second, "Request timeout")
+	return fs
+}
+
+func TestCompletionFlags(t *testing.T) {
+	kinds := make(map[string]string)
+	for _, f := range completionFlags(testCompletionFlagSet()) {
+		kinds[f.name] = f.kind
+	}
+	expected := map[string]string{"method": "method", "format": "choice", "file": "string", "quiet": "bool", "timeout": "other"}
+	for name, kind := range expected {
+		if kinds[name] != kind {
+			t.Errorf("Expected -%s to be %s, got %s", name, kind, kinds[name])
+		}
+	}
+}
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		t.Run(shell, func(t *testing.T) {
+			var b strings.Builder
+			if err := writeCompletion(&b, shell, testCompletionFlagSet()); err != nil {
+				t.Fatal(err)
+			}
+			script := b.String()
+			for _, want := range []string{"textDocument/hover", "method", "quiet", "ndjson"} {
+				if !strings.Contains(script, want) {
+					t.Errorf("Expected %q in the script:\n%s", want, script)
+				}
+			}
+
+			// Check the syntax when the shell is installed.
+			path, err := exec.LookPath(shell)
+			if err != nil {
+				return
+			}
+			file := filepath.Join(t.TempDir(), "clsp."+shell)
+			if err := os.WriteFile(file, []byte(script), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if out, err := exec.Command(path, "-n", file).CombinedOutput(); err != nil {
+				t.Errorf("%s -n failed: %v\n%s", shell, err, out)
+			}
+		})
+	}
+
+	if err := writeCompletion(&strings.Builder{}, "powershell", testCompletionFlagSet()); err == nil {
+		t.Error("Expected an error for an unknown shell")
+	}
+}
+
+func TestBashCompletion_Methods(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+	var b strings.Builder
+	if err := writeCompletion(&b, "bash", testCompletionFlagSet()); err != nil {
+		t.Fatal(err)
+	}
+	script := b.String() + `
+COMP_WORDS=(clsp -method '$/setT'); COMP_CWORD=2; _clsp; echo "${COMPREPLY[@]}"
+COMP_WORDS=(clsp -method textDocument/hov); _clsp; echo "${COMPREPLY[@]}"
+COMP_WORDS=(clsp -format nd); _clsp; echo "${COMPREPLY[@]}"
+COMP_WORDS=(clsp -qu); COMP_CWORD=1; _clsp; echo "${COMPREPLY[@]}"
+`
+	out, err := exec.Command(bash, "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash failed: %v\n%s", err, out)
+	}
+	expected := "$/setTrace\ntextDocument/hover\nndjson\n-quiet\n"
+	if string(out) != expected {
+		t.Errorf("Expected completions %q, got %q", expected, out)
+	}
+}
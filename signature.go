@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type SignatureHelp struct {
+	Signatures      []SignatureInformation `json:"signatures"`
+	ActiveSignature *int                   `json:"activeSignature,omitempty"`
+	ActiveParameter *int                   `json:"activeParameter,omitempty"`
+}
+
+type SignatureInformation struct {
+	Label         string                 `json:"label"`
+	Documentation any                    `json:"documentation,omitempty"`
+	Parameters    []ParameterInformation `json:"parameters,omitempty"`
+	// ActiveParameter overrides the one of SignatureHelp for this
+	// signature.
+	ActiveParameter *int `json:"activeParameter,omitempty"`
+}
+
+type ParameterInformation struct {
+	// Label is a substring of the signature label, or its [start, end)
+	// offsets in code units of the position encoding.
+	Label         any `json:"label"`
+	Documentation any `json:"documentation,omitempty"`
+}
+
+// signatureHelp extracts a textDocument/signatureHelp result. null, which
+// servers return where no call is being typed, is help without
+// signatures. ok is false for other shapes.
+func signatureHelp(result any) (*SignatureHelp, bool) {
+	if result == nil {
+		return &SignatureHelp{}, true
+	}
+	object, ok := result.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	if _, ok := object["signatures"].([]any); !ok {
+		return nil, false
+	}
+	data, _ := json.Marshal(object)
+	var help SignatureHelp
+	if err := json.Unmarshal(data, &help); err != nil {
+		return nil, false
+	}
+	return &help, true
+}
+
+// documentationText returns the text of a string or MarkupContent
+// documentation.
+func documentationText(doc any) string {
+	switch d := doc.(type) {
+	case string:
+		return d
+	case map[string]any:
+		value, _ := d["value"].(string)
+		return value
+	}
+	return ""
+}
+
+// parameterRange returns the byte range of param within the signature
+// label. A string label is searched for after the opening parenthesis so
+// that a parameter named like the function isn't matched in its name.
+func parameterRange(label string, param ParameterInformation, encoding string) (start, end int, ok bool) {
+	switch l := param.Label.(type) {
+	case string:
+		from := strings.IndexByte(label, '(') + 1
+		i := strings.Index(label[from:], l)
+		if l == "" || i < 0 {
+			return 0, 0, false
+		}
+		return from + i, from + i + len(l), true
+	case []any:
+		if len(l) != 2 {
+			return 0, 0, false
+		}
+		a, aok := l[0].(float64)
+		b, bok := l[1].(float64)
+		if !aok || !bok || b < a {
+			return 0, 0, false
+		}
+		return positionOffset(label, Position{Character: int(a)}, encoding), positionOffset(label, Position{Character: int(b)}, encoding), true
+	}
+	return 0, 0, false
+}
+
+// formatSignatureHelp prints one line per signature, the active one marked
+// with "> " and its active parameter underlined with carets (and
+// highlighted when color is set), followed by the documentation of the
+// signature and the active parameter. Label offsets are in encoding.
+func formatSignatureHelp(help *SignatureHelp, color bool, encoding string) string {
+	if len(help.Signatures) == 0 {
+		return "No signatures\n"
+	}
+	activeSignature := 0
+	if help.ActiveSignature != nil {
+		activeSignature = *help.ActiveSignature
+	}
+
+	var b strings.Builder
+	for i, sig := range help.Signatures {
+		if i != activeSignature {
+			fmt.Fprintf(&b, "  %s\n", sig.Label)
+			continue
+		}
+
+		activeParameter := 0
+		if help.ActiveParameter != nil {
+			activeParameter = *help.ActiveParameter
+		}
+		if sig.ActiveParameter != nil {
+			activeParameter = *sig.ActiveParameter
+		}
+		var param *ParameterInformation
+		start, end, ok := 0, 0, false
+		if activeParameter >= 0 && activeParameter < len(sig.Parameters) {
+			param = &sig.Parameters[activeParameter]
+			start, end, ok = parameterRange(sig.Label, *param, encoding)
+		}
+
+		if !ok {
+			fmt.Fprintf(&b, "> %s\n", sig.Label)
+		} else {
+			label := sig.Label
+			if color {
+				label = label[:start] + colorHighlight + label[start:end] + colorReset + label[end:]
+			}
+			fmt.Fprintf(&b, "> %s\n", label)
+			fmt.Fprintf(&b, "  %s%s\n",
+				strings.Repeat(" ", utf8.RuneCountInString(sig.Label[:start])),
+				strings.Repeat("^", max(utf8.RuneCountInString(sig.Label[start:end]), 1)))
+		}
+
+		if doc := strings.TrimSpace(documentationText(sig.Documentation)); doc != "" {
+			for _, line := range strings.Split(doc, "\n") {
+				if line == "" {
+					b.WriteString("\n")
+					continue
+				}
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+		if param != nil {
+			if doc := strings.TrimSpace(documentationText(param.Documentation)); doc != "" && ok {
+				fmt.Fprintf(&b, "    %s: %s\n", sig.Label[start:end], strings.ReplaceAll(doc, "\n", " "))
+			}
+		}
+	}
+	return b.String()
+}
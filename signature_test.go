@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+func TestFormatSignatureHelp(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   string
+		color    bool
+		expected string
+	}{
+		{
+			name:     "null",
+			result:   `null`,
+			expected: "No signatures\n",
+		},
+		{
+			name:     "no signatures",
+			result:   `{"signatures":[]}`,
+			expected: "No signatures\n",
+		},
+		{
+			name:   "string parameter labels",
+			result: `{"signatures":[{"label":"Printf(format string, a ...any) (n int, err error)","documentation":{"kind":"markdown","value":"Printf formats.\n\nIt returns n."},"parameters":[{"label":"format string"},{"label":"a ...any","documentation":"the values"}]}],"activeSignature":0,"activeParameter":1}`,
+			expected: "> Printf(format string, a ...any) (n int, err error)\n" +
+				"                        ^^^^^^^^\n" +
+				"    Printf formats.\n" +
+				"\n" +
+				"    It returns n.\n" +
+				"    a ...any: the values\n",
+		},
+		{
+			name:   "offset labels in UTF-16",
+			result: `{"signatures":[{"label":"f(😀 int, b int)","parameters":[{"label":[2,8]},{"label":[10,15]}]}],"activeParameter":0}`,
+			expected: "> f(😀 int, b int)\n" +
+				"    ^^^^^\n",
+		},
+		{
+			name:   "parameter named like the function",
+			result: `{"signatures":[{"label":"x(x int)","parameters":[{"label":"x int"}]}]}`,
+			expected: "> x(x int)\n" +
+				"    ^^^^^\n",
+		},
+		{
+			name:   "per-signature active parameter and other signatures",
+			result: `{"signatures":[{"label":"f()"},{"label":"f(a, b)","parameters":[{"label":"a"},{"label":"b"}],"activeParameter":1}],"activeSignature":1,"activeParameter":0}`,
+			expected: "  f()\n" +
+				"> f(a, b)\n" +
+				"       ^\n",
+		},
+		{
+			name:     "active parameter out of range",
+			result:   `{"signatures":[{"label":"f()"}],"activeParameter":3}`,
+			expected: "> f()\n",
+		},
+		{
+			name:   "color",
+			result: `{"signatures":[{"label":"f(a, b)","parameters":[{"label":"a"},{"label":"b"}]}]}`,
+			color:  true,
+			expected: "> f(" + colorHighlight + "a" + colorReset + ", b)\n" +
+				"    ^\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			help, ok := signatureHelp(decodeResult(t, test.result))
+			if !ok {
+				t.Fatal("Expected a signature help result")
+			}
+			if got := formatSignatureHelp(help, test.color, encodingUTF16); got != test.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestSignatureHelpRejectsOtherShapes(t *testing.T) {
+	for _, result := range []string{`[]`, `{"contents":"hover"}`, `"text"`} {
+		if _, ok := signatureHelp(decodeResult(t, result)); ok {
+			t.Errorf("Expected %s not to be a signature help result", result)
+		}
+	}
+}
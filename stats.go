@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// durationStats summarizes the durations of repeated requests.
+type durationStats struct {
+	Count  int
+	Min    time.Duration
+	Median time.Duration
+	P95    time.Duration
+	Max    time.Duration
+}
+
+// summarizeDurations computes stats over durations using nearest-rank
+// percentiles. It returns the zero value for no durations.
+func summarizeDurations(durations []time.Duration) durationStats {
+	if len(durations) == 0 {
+		return durationStats{}
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	return durationStats{
+		Count:  len(sorted),
+		Min:    sorted[0],
+		Median: percentile(sorted, 50),
+		P95:    percentile(sorted, 95),
+		Max:    sorted[len(sorted)-1],
+	}
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * n)
+	return sorted[max(rank, 1)-1]
+}
+
+func (s durationStats) String() string {
+	round := func(d time.Duration) time.Duration { return d.Round(time.Microsecond) }
+	return fmt.Sprintf("%d requests: min %v, median %v, p95 %v, max %v", s.Count, round(s.Min), round(s.Median), round(s.P95), round(s.Max))
+}
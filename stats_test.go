@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarizeDurations(t *testing.T) {
+	var durations []time.Duration
+	for i := 20; i >= 1; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+
+	stats := summarizeDurations(durations)
+	expected := durationStats{
+		Count:  20,
+		Min:    time.Millisecond,
+		Median: 10 * time.Millisecond,
+		P95:    19 * time.Millisecond,
+		Max:    20 * time.Millisecond,
+	}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+	if durations[0] != 20*time.Millisecond {
+		t.Error("Expected the input to be left unsorted")
+	}
+
+	single := summarizeDurations([]time.Duration{time.Second})
+	if single.Min != time.Second || single.Median != time.Second || single.P95 != time.Second || single.Max != time.Second {
+		t.Errorf("Expected every stat to be 1s for a single duration, got %+v", single)
+	}
+
+	if empty := summarizeDurations(nil); empty != (durationStats{}) {
+		t.Errorf("Expected zero stats for no durations, got %+v", empty)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// symbolKinds names the LSP SymbolKind values, which start at 1.
+var symbolKinds = []string{
+	"", "File", "Module", "Namespace", "Package", "Class", "Method", "Property",
+	"Field", "Constructor", "Enum", "Interface", "Function", "Variable",
+	"Constant", "String", "Number", "Boolean", "Array", "Object", "Key", "Null",
+	"EnumMember", "Struct", "Event", "Operator", "TypeParameter",
+}
+
+func symbolKindName(kind float64) string {
+	if i := int(kind); i > 0 && i < len(symbolKinds) {
+		return symbolKinds[i]
+	}
+	return strconv.Itoa(int(kind))
+}
+
+// flatSymbol is one entry of a flattened documentSymbol result. Line and
+// Character are 0-based, as sent by the server.
+type flatSymbol struct {
+	Name      string
+	Kind      string
+	Line      int
+	Character int
+	Depth     int
+}
+
+// flattenSymbols walks a textDocument/documentSymbol result depth first.
+// It accepts both the hierarchical DocumentSymbol[] shape and the flat
+// SymbolInformation[] shape; ok is false for anything else.
+func flattenSymbols(result any) ([]flatSymbol, bool) {
+	items, ok := result.([]any)
+	if !ok {
+		return nil, false
+	}
+	var symbols []flatSymbol
+	if !appendSymbols(&symbols, items, 0) {
+		return nil, false
+	}
+	return symbols, true
+}
+
+func appendSymbols(symbols *[]flatSymbol, items []any, depth int) bool {
+	for _, item := range items {
+		symbol, ok := item.(map[string]any)
+		if !ok {
+			return false
+		}
+		name, ok := symbol["name"].(string)
+		if !ok {
+			return false
+		}
+		kind, _ := symbol["kind"].(float64)
+
+		// DocumentSymbol points at its name with selectionRange;
+		// SymbolInformation only has a location.
+		var start map[string]any
+		if r, ok := symbol["selectionRange"].(map[string]any); ok {
+			start, _ = r["start"].(map[string]any)
+		} else if location, ok := symbol["location"].(map[string]any); ok {
+			if r, ok := location["range"].(map[string]any); ok {
+				start, _ = r["start"].(map[string]any)
+			}
+		}
+		line, _ := start["line"].(float64)
+		character, _ := start["character"].(float64)
+
+		*symbols = append(*symbols, flatSymbol{
+			Name:      name,
+			Kind:      symbolKindName(kind),
+			Line:      int(line),
+			Character: int(character),
+			Depth:     depth,
+		})
+
+		if children, ok := symbol["children"].([]any); ok {
+			if !appendSymbols(symbols, children, depth+1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// formatSymbols renders one `name  kind  line:col` line per symbol,
+// indented by depth. Positions are 1-based, as editors show them.
+func formatSymbols(symbols []flatSymbol) string {
+	var b strings.Builder
+	for _, s := range symbols {
+		fmt.Fprintf(&b, "%s%s  %s  %d:%d\n", strings.Repeat("  ", s.Depth), s.Name, s.Kind, s.Line+1, s.Character+1)
+	}
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFlattenSymbols(t *testing.T) {
+	testCases := []struct {
+		name     string
+		result   string
+		expected string
+		ok       bool
+	}{
+		{
+			"document symbols",
+			`[{"name":"Server","kind":23,"range":{},"selectionRange":{"start":{"line":4,"character":5}},
+			   "children":[{"name":"addr","kind":8,"selectionRange":{"start":{"line":5,"character":1}}}]},
+			  {"name":"main","kind":12,"selectionRange":{"start":{"line":9,"character":5}}}]`,
+			"Server  Struct  5:6\n  addr  Field  6:2\nmain  Function  10:6\n",
+			true,
+		},
+		{
+			"symbol information",
+			`[{"name":"main","kind":12,"location":{"uri":"file:///a.go","range":{"start":{"line":2,"character":0}}}}]`,
+			"main  Function  3:1\n",
+			true,
+		},
+		{"unknown kind", `[{"name":"x","kind":99}]`, "x  99  1:1\n", true},
+		{"empty", `[]`, "", true},
+		{"not symbols", `[{"uri":"file:///a.go"}]`, "", false},
+		{"null", `null`, "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var result any
+			if err := json.Unmarshal([]byte(tc.result), &result); err != nil {
+				t.Fatal(err)
+			}
+			symbols, ok := flattenSymbols(result)
+			if ok != tc.ok {
+				t.Fatalf("Expected ok %v, got %v", tc.ok, ok)
+			}
+			if got := formatSymbols(symbols); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
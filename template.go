@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// placeholderPattern matches the ${name} placeholders of a params template.
+var placeholderPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.-]*)\}`)
+
+// templateVars returns the placeholder values for a params template: file
+// (the document URI), path, line and character from -file/-pos, with -var
+// assignments on top. Position placeholders are only set when a position
+// was given; character is the byte column, as the template is filled in
+// before the server has chosen its position encoding.
+func templateVars(path string, pos *Position, assignments []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	if path != "" {
+		vars["file"] = PathToFileURI(path)
+		vars["path"] = path
+	}
+	if pos != nil {
+		vars["line"] = strconv.Itoa(pos.Line)
+		vars["character"] = strconv.Itoa(pos.Character)
+	}
+	for _, assignment := range assignments {
+		key, value, ok := strings.Cut(assignment, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid -var %q, want KEY=VALUE", assignment)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// expandTemplate replaces every ${name} in template with vars[name].
+// Values are escaped as JSON string contents, so they are safe inside
+// quotes and numbers can be substituted unquoted. Placeholders without a
+// value are an error.
+func expandTemplate(template string, vars map[string]string) (string, error) {
+	var unresolved []string
+	expanded := placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		value, ok := vars[name]
+		if !ok {
+			if !slices.Contains(unresolved, placeholder) {
+				unresolved = append(unresolved, placeholder)
+			}
+			return placeholder
+		}
+		quoted, _ := json.Marshal(value)
+		return string(quoted[1 : len(quoted)-1])
+	})
+	if len(unresolved) > 0 {
+		return "", fmt.Errorf("unresolved placeholders %s; set them with -var KEY=VALUE or -file/-line/-character", strings.Join(unresolved, ", "))
+	}
+	return expanded, nil
+}
+
+// loadParamsTemplate reads a params template from path and returns the
+// params with its placeholders filled in from vars.
+func loadParamsTemplate(path string, vars map[string]string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := expandTemplate(string(data), vars)
+	if err != nil {
+		return nil, err
+	}
+	var params any
+	if err := json.Unmarshal([]byte(expanded), &params); err != nil {
+		return nil, fmt.Errorf("failed to parse expanded template JSON: %w", err)
+	}
+	return params, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	vars := map[string]string{"file": "file:///a b.go", "line": "3", "name": `say "hi"`}
+
+	got, err := expandTemplate(`{"uri":"${file}","line":${line},"name":"${name}"}`, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"uri":"file:///a b.go","line":3,"name":"say \"hi\""}`; got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	_, err = expandTemplate(`{"line":${line},"a":"${missing}","b":"${missing}","c":${other}}`, vars)
+	if err == nil || !strings.Contains(err.Error(), "${missing}, ${other}") {
+		t.Errorf("Expected each unresolved placeholder once, got %v", err)
+	}
+}
+
+func TestTemplateVars(t *testing.T) {
+	vars, err := templateVars("main.go", &Position{Line: 1, Character: 2}, []string{"line=9", "query=a=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["file"] != PathToFileURI("main.go") || vars["path"] != "main.go" {
+		t.Errorf("Unexpected file vars %v", vars)
+	}
+	if vars["line"] != "9" || vars["character"] != "2" || vars["query"] != "a=b" {
+		t.Errorf("Expected -var to override built-in values, got %v", vars)
+	}
+
+	if vars, _ := templateVars("", nil, nil); len(vars) != 0 {
+		t.Errorf("Expected no vars without -file, got %v", vars)
+	}
+	if _, err := templateVars("", nil, []string{"novalue"}); err == nil {
+		t.Error("Expected an error for a -var without =")
+	}
+}
+
+func TestLoadParamsTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "params.json")
+	if err := os.WriteFile(path, []byte(`{"position":{"line":${line},"character":${character}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	params, err := loadParamsTemplate(path, map[string]string{"line": "4", "character": "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"position": map[string]any{"line": 4.0, "character": 0.0}}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected %v, got %v", expected, params)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// positionOffset returns the byte offset of pos in text. Characters count
+// code units of encoding, UTF-16 when it's empty. Positions past the end
+// of a line mean its end, and lines past the end of text mean the end of
+// text.
+func positionOffset(text string, pos Position, encoding string) int {
+	offset := 0
+	for range pos.Line {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i < 0 {
+			return len(text)
+		}
+		offset += i + 1
+	}
+
+	units := 0
+	for offset < len(text) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r == '\n' || (r == '\r' && strings.HasPrefix(text[offset:], "\r\n")) {
+			break
+		}
+		units += runeUnits(r, size, encoding)
+		offset += size
+	}
+	return offset
+}
+
+// applyTextEdits returns text with edits applied. Edits refer to the
+// original text and may come in any order; edits inserting at the same
+// position are applied in the order given. Overlapping edits are an
+// error, as the spec forbids them. Positions are in encoding.
+func applyTextEdits(text string, edits []TextEdit, encoding string) (string, error) {
+	type span struct {
+		start, end int
+		newText    string
+	}
+	spans := make([]span, len(edits))
+	for i, edit := range edits {
+		start, end := positionOffset(text, edit.Range.Start, encoding), positionOffset(text, edit.Range.End, encoding)
+		if end < start {
+			return "", fmt.Errorf("edit %d has its end before its start", i)
+		}
+		spans[i] = span{start, end, edit.NewText}
+	}
+	slices.SortStableFunc(spans, func(a, b span) int {
+		return cmp.Compare(a.start, b.start)
+	})
+
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		if s.start < last {
+			return "", fmt.Errorf("overlapping edits at offset %d", s.start)
+		}
+		b.WriteString(text[last:s.start])
+		b.WriteString(s.newText)
+		last = s.end
+	}
+	b.WriteString(text[last:])
+	return b.String(), nil
+}
+
+// textEdits extracts a TextEdit[] result, as returned by the formatting
+// requests. ok is false for other shapes.
+func textEdits(result any) ([]TextEdit, bool) {
+	raw, ok := result.([]any)
+	if !ok {
+		return nil, false
+	}
+	edits := make([]TextEdit, 0, len(raw))
+	for _, entry := range raw {
+		object, ok := entry.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if _, ok := object["newText"].(string); !ok {
+			return nil, false
+		}
+		if _, ok := object["range"].(map[string]any); !ok {
+			return nil, false
+		}
+		data, _ := json.Marshal(object)
+		var edit TextEdit
+		if err := json.Unmarshal(data, &edit); err != nil {
+			return nil, false
+		}
+		edits = append(edits, edit)
+	}
+	return edits, true
+}
+
+// paramsDocumentURI returns the textDocument.uri of request params, or ""
+// if they have none.
+func paramsDocumentURI(params any) string {
+	object, _ := params.(map[string]any)
+	switch document := object["textDocument"].(type) {
+	case TextDocumentIdentifier:
+		return document.URI
+	case map[string]any:
+		uri, _ := document["uri"].(string)
+		return uri
+	}
+	return ""
+}
+
+// formatEditsDiff applies edits to text and returns the change as a
+// unified diff of name. Positions are in encoding.
+func formatEditsDiff(text string, edits []TextEdit, name, encoding string) (string, error) {
+	edited, err := applyTextEdits(text, edits, encoding)
+	if err != nil {
+		return "", fmt.Errorf("failed to apply edits: %w", err)
+	}
+	oldName, newName := "a/"+name, "b/"+name
+	if filepath.IsAbs(name) {
+		oldName, newName = name, name
+	}
+	return unifiedDiff(oldName, newName, text, edited), nil
+}
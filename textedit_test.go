@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+)
+
+func edit(startLine, startChar, endLine, endChar int, newText string) TextEdit {
+	return TextEdit{
+		Range:   Range{Start: Position{Line: startLine, Character: startChar}, End: Position{Line: endLine, Character: endChar}},
+		NewText: newText,
+	}
+}
+
+func TestPositionOffset(t *testing.T) {
+	text := "ab\r\n😀x\ny"
+	tests := []struct {
+		pos      Position
+		expected int
+	}{
+		{Position{0, 0}, 0},
+		{Position{0, 2}, 2},
+		{Position{0, 9}, 2}, // past the end of the line, before \r\n
+		{Position{1, 0}, 4},
+		{Position{1, 2}, 8}, // the emoji is two UTF-16 code units
+		{Position{1, 3}, 9},
+		{Position{2, 1}, 11},
+		{Position{5, 0}, 11},
+	}
+	for _, tt := range tests {
+		if got := positionOffset(text, tt.pos, encodingUTF16); got != tt.expected {
+			t.Errorf("positionOffset(%v) = %d, expected %d", tt.pos, got, tt.expected)
+		}
+	}
+}
+
+func TestPositionOffset_Encodings(t *testing.T) {
+	text := "é😀x" // 2, 4 and 1 bytes
+	tests := []struct {
+		encoding  string
+		character int
+		expected  int
+	}{
+		{encodingUTF8, 2, 2},
+		{encodingUTF8, 6, 6},
+		{encodingUTF16, 3, 6}, // é is one unit, the emoji two
+		{encodingUTF32, 2, 6},
+		{encodingUTF32, 3, 7},
+	}
+	for _, tt := range tests {
+		if got := positionOffset(text, Position{Character: tt.character}, tt.encoding); got != tt.expected {
+			t.Errorf("positionOffset(%d, %s) = %d, expected %d", tt.character, tt.encoding, got, tt.expected)
+		}
+	}
+}
+
+func TestApplyTextEdits(t *testing.T) {
+	text := "package main\nfunc  main() {}\n"
+
+	tests := []struct {
+		name     string
+		edits    []TextEdit
+		expected string
+	}{
+		{"none", nil, text},
+		{"in order", []TextEdit{edit(0, 0, 0, 7, "pkg"), edit(1, 4, 1, 6, " ")}, "pkg main\nfunc main() {}\n"},
+		{"reverse order", []TextEdit{edit(1, 4, 1, 6, " "), edit(0, 0, 0, 7, "pkg")}, "pkg main\nfunc main() {}\n"},
+		{"inserts at one position keep their order", []TextEdit{edit(1, 0, 1, 0, "a"), edit(1, 0, 1, 0, "b")}, "package main\nabfunc  main() {}\n"},
+		{"adjacent", []TextEdit{edit(0, 0, 0, 4, "x"), edit(0, 4, 0, 7, "y")}, "xy main\nfunc  main() {}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyTextEdits(text, tt.edits, encodingUTF16)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := applyTextEdits(text, []TextEdit{edit(0, 0, 0, 5, ""), edit(0, 3, 0, 7, "")}, encodingUTF16); err == nil {
+		t.Error("Expected an error for overlapping edits")
+	}
+}
+
+func TestTextEdits(t *testing.T) {
+	edits, ok := textEdits(decodeResult(t, `[{"range": {"start": {"line": 1, "character": 2}, "end": {"line": 1, "character": 4}}, "newText": "x"}]`))
+	if !ok || len(edits) != 1 || edits[0] != edit(1, 2, 1, 4, "x") {
+		t.Errorf("Unexpected edits %v", edits)
+	}
+	for _, s := range []string{`null`, `{}`, `[{"uri": "file:///a.go", "range": {}}]`} {
+		if _, ok := textEdits(decodeResult(t, s)); ok {
+			t.Errorf("Expected %s not to be a TextEdit array", s)
+		}
+	}
+}
+
+func TestParamsDocumentURI(t *testing.T) {
+	if got := paramsDocumentURI(textDocumentParams("/a.go", -1, 0)); got != PathToFileURI("/a.go") {
+		t.Errorf("Unexpected URI %q", got)
+	}
+	if got := paramsDocumentURI(decodeResult(t, `{"textDocument": {"uri": "file:///b.go"}}`)); got != "file:///b.go" {
+		t.Errorf("Unexpected URI %q", got)
+	}
+	if got := paramsDocumentURI(nil); got != "" {
+		t.Errorf("Expected no URI, got %q", got)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type SetTraceParams struct {
+	Value string `json:"value"`
+}
+
+type LogTraceParams struct {
+	Message string `json:"message"`
+	Verbose string `json:"verbose,omitempty"` // only with -trace verbose
+}
+
+// printLogTrace writes $/logTrace notifications from the server to w as
+// they arrive.
+func printLogTrace(client *LSPClient, w io.Writer) {
+	client.OnNotification("$/logTrace", func(params json.RawMessage) {
+		var trace LogTraceParams
+		if err := json.Unmarshal(params, &trace); err != nil {
+			return
+		}
+		fmt.Fprintln(w, formatLogTrace(trace))
+	})
+}
+
+func formatLogTrace(trace LogTraceParams) string {
+	s := "[trace] " + trace.Message
+	if verbose := strings.TrimRight(trace.Verbose, "\n"); verbose != "" {
+		s += "\n" + verbose
+	}
+	return s
+}
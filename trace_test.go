@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestFormatLogTrace(t *testing.T) {
+	tests := []struct {
+		name     string
+		trace    LogTraceParams
+		expected string
+	}{
+		{"message only", LogTraceParams{Message: "Received request 'textDocument/hover - (1)'."}, "[trace] Received request 'textDocument/hover - (1)'."},
+		{"verbose", LogTraceParams{Message: "Sending response", Verbose: "Result: null\n"}, "[trace] Sending response\nResult: null"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatLogTrace(tt.trace); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
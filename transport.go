@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// stdioTransport joins the stdin and stdout pipes of a server subprocess
+// into a single io.ReadWriteCloser.
+type stdioTransport struct {
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+func (t *stdioTransport) Read(p []byte) (int, error) {
+	return t.stdout.Read(p)
+}
+
+func (t *stdioTransport) Write(p []byte) (int, error) {
+	return t.stdin.Write(p)
+}
+
+func (t *stdioTransport) Close() error {
+	return errors.Join(t.stdin.Close(), t.stdout.Close())
+}
+
+// dryRunTransport sends writes to w and has nothing to read.
+type dryRunTransport struct {
+	w io.Writer
+}
+
+func (t *dryRunTransport) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (t *dryRunTransport) Write(p []byte) (int, error) {
+	return t.w.Write(p)
+}
+
+func (t *dryRunTransport) Close() error {
+	return nil
+}
+
+// replayTransport reads recorded server messages from r and discards
+// everything written to it.
+type replayTransport struct {
+	r io.Reader
+}
+
+func (t *replayTransport) Read(p []byte) (int, error) {
+	return t.r.Read(p)
+}
+
+func (t *replayTransport) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (t *replayTransport) Close() error {
+	return nil
+}
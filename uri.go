@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PathToFileURI converts a filesystem path to a file:// URI, resolving
+// relative paths against the working directory. Characters such as spaces
+// are percent-encoded, and Windows paths take the file:///C:/... form.
+func PathToFileURI(path string) string {
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+	return fileURIFromAbs(filepath.ToSlash(path))
+}
+
+// fileURIFromAbs builds a file URI from an absolute, slash-separated path.
+func fileURIFromAbs(path string) string {
+	// Windows paths start with a drive letter and need a leading slash.
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// FileURIToPath converts a file:// URI back to a filesystem path.
+func FileURIToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("not a file URI: %s", uri)
+	}
+	path := u.Path
+	// Drop the slash in front of Windows drive letters: /C:/x -> C:/x.
+	if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// isURI reports whether s looks like a URI rather than a filesystem path.
+// Single-letter schemes are treated as Windows drive letters.
+func isURI(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && len(u.Scheme) > 1
+}
+
+// resolveRoot interprets the -root value, which may be either a URI or a
+// directory path, and returns the root URI plus the matching filesystem path
+// (empty for non-file URIs). An empty root means the working directory.
+func resolveRoot(root string) (uri, path string, err error) {
+	if root == "" {
+		if root, err = os.Getwd(); err != nil {
+			return "", "", err
+		}
+	}
+	if isURI(root) {
+		path, err := FileURIToPath(root)
+		if err != nil {
+			return root, "", nil
+		}
+		return root, path, nil
+	}
+	path, err = filepath.Abs(root)
+	if err != nil {
+		return "", "", err
+	}
+	return PathToFileURI(path), path, nil
+}
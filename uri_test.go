@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileURIFromAbs(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"/home/user/main.go", "file:///home/user/main.go"},
+		{"/home/user/my project/main.go", "file:///home/user/my%20project/main.go"},
+		{"/tmp/a#b?c.go", "file:///tmp/a%23b%3Fc.go"},
+		{"/tmp/100%.go", "file:///tmp/100%25.go"},
+		{"C:/Users/me/main.go", "file:///C:/Users/me/main.go"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			if got := fileURIFromAbs(tc.path); got != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestPathToFileURI_Relative(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fileURIFromAbs(filepath.ToSlash(filepath.Join(wd, "main.go")))
+	if got := PathToFileURI("main.go"); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestFileURIToPath(t *testing.T) {
+	testCases := []struct {
+		uri      string
+		expected string
+		wantErr  bool
+	}{
+		{"file:///home/user/main.go", "/home/user/main.go", false},
+		{"file:///home/user/my%20project/main.go", "/home/user/my project/main.go", false},
+		{"file:///C:/Users/me/main.go", filepath.FromSlash("C:/Users/me/main.go"), false},
+		{"https://example.com/main.go", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.uri, func(t *testing.T) {
+			got, err := FileURIToPath(tc.uri)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error state: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestResolveRoot(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		root         string
+		expectedURI  string
+		expectedPath string
+	}{
+		{"", PathToFileURI(wd), wd},
+		{"./myproject", PathToFileURI(filepath.Join(wd, "myproject")), filepath.Join(wd, "myproject")},
+		{"file:///path/to/project", "file:///path/to/project", filepath.FromSlash("/path/to/project")},
+		{"jdt://contents/project", "jdt://contents/project", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.root, func(t *testing.T) {
+			uri, path, err := resolveRoot(tc.root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uri != tc.expectedURI || path != tc.expectedPath {
+				t.Errorf("Expected (%s, %s), got (%s, %s)", tc.expectedURI, tc.expectedPath, uri, path)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// formatVersion describes the build for bug reports: the module version,
+// the VCS revision it was built from and the Go toolchain. info is nil
+// when the binary carries no build information.
+func formatVersion(info *debug.BuildInfo) string {
+	version, goVersion := "unknown", runtime.Version()
+	settings := make(map[string]string)
+	if info != nil {
+		version, goVersion = info.Main.Version, info.GoVersion
+		for _, s := range info.Settings {
+			settings[s.Key] = s.Value
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "clsp %s\n", version)
+	if revision := settings["vcs.revision"]; revision != "" {
+		var notes []string
+		if t := settings["vcs.time"]; t != "" {
+			notes = append(notes, t)
+		}
+		if settings["vcs.modified"] == "true" {
+			notes = append(notes, "modified")
+		}
+		if len(notes) > 0 {
+			revision += " (" + strings.Join(notes, ", ") + ")"
+		}
+		fmt.Fprintf(&b, "revision: %s\n", revision)
+	}
+	goos, goarch := runtime.GOOS, runtime.GOARCH
+	if settings["GOOS"] != "" && settings["GOARCH"] != "" {
+		goos, goarch = settings["GOOS"], settings["GOARCH"]
+	}
+	fmt.Fprintf(&b, "go: %s %s/%s\n", goVersion, goos, goarch)
+	return b.String()
+}
+
+// clientVersion returns the version clsp reports in its clientInfo: the
+// module version, which is "(devel)" for local builds.
+func clientVersion(info *debug.BuildInfo) string {
+	if info == nil || info.Main.Version == "" {
+		return "unknown"
+	}
+	return info.Main.Version
+}
+
+// buildInfo returns the build information embedded in the binary, or nil.
+func buildInfo() *debug.BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	return info
+}
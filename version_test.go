@@ -0,0 +1,61 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+func TestFormatVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     *debug.BuildInfo
+		expected string
+	}{
+		{
+			name: "release",
+			info: &debug.BuildInfo{
+				GoVersion: "go1.24.4",
+				Main:      debug.Module{Path: "github.com/knsh14/clsp", Version: "v1.2.0"},
+				Settings:  []debug.BuildSetting{{Key: "GOOS", Value: "linux"}, {Key: "GOARCH", Value: "amd64"}},
+			},
+			expected: "clsp v1.2.0\ngo: go1.24.4 linux/amd64\n",
+		},
+		{
+			name: "checkout",
+			info: &debug.BuildInfo{
+				GoVersion: "go1.24.4",
+				Main:      debug.Module{Path: "github.com/knsh14/clsp", Version: "(devel)"},
+				Settings: []debug.BuildSetting{
+					{Key: "GOOS", Value: "darwin"},
+					{Key: "GOARCH", Value: "arm64"},
+					{Key: "vcs.revision", Value: "0123abcd"},
+					{Key: "vcs.time", Value: "2025-06-01T10:00:00Z"},
+					{Key: "vcs.modified", Value: "true"},
+				},
+			},
+			expected: "clsp (devel)\nrevision: 0123abcd (2025-06-01T10:00:00Z, modified)\ngo: go1.24.4 darwin/arm64\n",
+		},
+		{
+			name:     "no build info",
+			expected: "clsp unknown\ngo: " + runtime.Version() + " " + runtime.GOOS + "/" + runtime.GOARCH + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatVersion(tt.info); got != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestClientVersion(t *testing.T) {
+	info := &debug.BuildInfo{Main: debug.Module{Path: "github.com/knsh14/clsp", Version: "v1.2.0"}}
+	if got := clientVersion(info); got != "v1.2.0" {
+		t.Errorf("Expected v1.2.0, got %q", got)
+	}
+	if got := clientVersion(nil); got != "unknown" {
+		t.Errorf("Expected unknown, got %q", got)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+)
+
+// Notification is a notification received from the server.
+type Notification struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// notificationWaiter catches the first notification with a given method
+// whose params contain want. It is registered before the request is sent,
+// so a notification the server sends before its response is not missed.
+type notificationWaiter struct {
+	method string
+	want   any // nil matches any params
+	found  chan Notification
+}
+
+func waitForNotification(client *LSPClient, method string, want any) *notificationWaiter {
+	w := &notificationWaiter{method: method, want: want, found: make(chan Notification, 1)}
+	client.OnNotification(method, w.handle)
+	return w
+}
+
+func (w *notificationWaiter) handle(params json.RawMessage) {
+	if w.want != nil {
+		var have any
+		if err := json.Unmarshal(params, &have); err != nil || !containsJSON(have, w.want) {
+			return
+		}
+	}
+	select {
+	case w.found <- Notification{Method: w.method, Params: params}:
+	default: // only the first match counts
+	}
+}
+
+// Wait reads and dispatches messages from client until the notification
+// has arrived, ignoring unrelated responses and notifications. It fails
+// if ctx ends first.
+func (w *notificationWaiter) Wait(ctx context.Context, client *LSPClient) (*Notification, error) {
+	client.callMu.Lock()
+	defer client.callMu.Unlock()
+
+	for {
+		select {
+		case n := <-w.found:
+			return &n, nil
+		default:
+		}
+
+		content, err := client.readMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("timed out waiting for %s: %w", w.method, err)
+			}
+			return nil, client.explainExit(err)
+		}
+		response, err := client.dispatch(content)
+		if err != nil {
+			return nil, err
+		}
+		if response != nil {
+			client.logger.Debug("Ignoring response while waiting for a notification", "id", response.ID, "method", w.method)
+		}
+	}
+}
+
+// containsJSON reports whether have contains want: objects match when
+// every key of want matches in have, arrays element by element, and other
+// values when they are equal.
+func containsJSON(have, want any) bool {
+	switch want := want.(type) {
+	case map[string]any:
+		object, ok := have.(map[string]any)
+		if !ok {
+			return false
+		}
+		for key, value := range want {
+			if v, ok := object[key]; !ok || !containsJSON(v, value) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		array, ok := have.([]any)
+		if !ok || len(array) < len(want) {
+			return false
+		}
+		for i, value := range want {
+			if !containsJSON(array[i], value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(have, want)
+	}
+}
+
+// printNotification prints a notification caught by -wait-for or -linger.
+func printNotification(n *Notification, opts outputOptions) {
+	switch opts.format {
+	case "json", "ndjson":
+		writeJSONLine(os.Stdout, n)
+	case "raw":
+		fmt.Println(string(n.Params))
+	default: // pretty
+		if !opts.quiet {
+			fmt.Printf("Notification %s:\n", n.Method)
+		}
+		var params any
+		json.Unmarshal(n.Params, &params)
+		printJSON(params, opts.color)
+	}
+}
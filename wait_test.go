@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func publishDiagnostics(uri string, n int) map[string]any {
+	diagnostics := make([]any, n)
+	for i := range diagnostics {
+		diagnostics[i] = map[string]any{"message": "problem"}
+	}
+	return map[string]any{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics", "params": map[string]any{"uri": uri, "diagnostics": diagnostics}}
+}
+
+func TestNotificationWaiter(t *testing.T) {
+	client, server := newFakeServer(t)
+	server.on("textDocument/hover",
+		fakeReply{
+			Messages: []any{publishDiagnostics("file:///other.go", 1)},
+			After: []any{
+				JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(99), Result: "stale"},
+				map[string]any{"jsonrpc": "2.0", "method": "window/logMessage", "params": map[string]any{"type": 3, "message": "x"}},
+				publishDiagnostics("file:///a.go", 0),
+				publishDiagnostics("file:///a.go", 2),
+			},
+		},
+	)
+
+	waiter := waitForNotification(client, "textDocument/publishDiagnostics", map[string]any{"uri": "file:///a.go", "diagnostics": []any{map[string]any{}}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SendRequest(ctx, "textDocument/hover", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	notification, err := waiter.Wait(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params PublishDiagnosticsParams
+	json.Unmarshal(notification.Params, &params)
+	if params.URI != "file:///a.go" || len(params.Diagnostics) != 2 {
+		t.Errorf("Expected the non-empty diagnostics of a.go, got %+v", params)
+	}
+}
+
+func TestNotificationWaiter_BeforeResponse(t *testing.T) {
+	client, server := newFakeServer(t)
+	server.on("textDocument/hover", fakeReply{Messages: []any{publishDiagnostics("file:///a.go", 1)}})
+
+	waiter := waitForNotification(client, "textDocument/publishDiagnostics", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SendRequest(ctx, "textDocument/hover", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waiter.Wait(ctx, client); err != nil {
+		t.Errorf("Expected the notification read with the response to count, got %v", err)
+	}
+}
+
+func TestNotificationWaiter_Timeout(t *testing.T) {
+	client, _ := newFakeServer(t)
+	waiter := waitForNotification(client, "$/progress", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := waiter.Wait(ctx, client); err == nil {
+		t.Error("Expected a timeout error")
+	}
+}
+
+func TestContainsJSON(t *testing.T) {
+	var have any
+	json.Unmarshal([]byte(`{"token":"1","value":{"kind":"end","message":"done"},"list":[1,2,3]}`), &have)
+
+	tests := []struct {
+		want     string
+		expected bool
+	}{
+		{`{}`, true},
+		{`{"value":{"kind":"end"}}`, true},
+		{`{"value":{"kind":"begin"}}`, false},
+		{`{"missing":null}`, false},
+		{`{"list":[1,2]}`, true},
+		{`{"list":[2]}`, false},
+		{`{"token":1}`, false},
+	}
+	for _, tt := range tests {
+		var want any
+		json.Unmarshal([]byte(tt.want), &want)
+		if got := containsJSON(have, want); got != tt.expected {
+			t.Errorf("containsJSON(%s) = %v, expected %v", tt.want, got, tt.expected)
+		}
+	}
+}
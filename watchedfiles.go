@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FileChangeType is the kind of a workspace/didChangeWatchedFiles event.
+type FileChangeType int
+
+const (
+	FileCreated FileChangeType = 1
+	FileChanged FileChangeType = 2
+	FileDeleted FileChangeType = 3
+)
+
+var fileChangeTypes = map[string]FileChangeType{
+	"created": FileCreated,
+	"changed": FileChanged,
+	"deleted": FileDeleted,
+}
+
+type FileEvent struct {
+	URI  string         `json:"uri"`
+	Type FileChangeType `json:"type"`
+}
+
+type DidChangeWatchedFilesParams struct {
+	Changes []FileEvent `json:"changes"`
+}
+
+// parseFileEvent parses a -changed-file value of the form <uri|path>:<type>,
+// where type is created, changed or deleted. The file need not exist, as
+// deleted files don't.
+func parseFileEvent(value string) (FileEvent, error) {
+	i := strings.LastIndex(value, ":")
+	if i <= 0 {
+		return FileEvent{}, fmt.Errorf("%q is not <path>:<created|changed|deleted>", value)
+	}
+	location, kind := value[:i], value[i+1:]
+	changeType, ok := fileChangeTypes[kind]
+	if !ok {
+		return FileEvent{}, fmt.Errorf("unknown change type %q in %q (want created, changed or deleted)", kind, value)
+	}
+	uri := location
+	if !isURI(location) {
+		uri = PathToFileURI(location)
+	}
+	return FileEvent{URI: uri, Type: changeType}, nil
+}
+
+func parseFileEvents(values []string) ([]FileEvent, error) {
+	events := make([]FileEvent, 0, len(values))
+	for _, value := range values {
+		event, err := parseFileEvent(value)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFileEvent(t *testing.T) {
+	abs, _ := filepath.Abs("main.go")
+	tests := []struct {
+		value    string
+		expected FileEvent
+	}{
+		{"main.go:changed", FileEvent{URI: PathToFileURI(abs), Type: FileChanged}},
+		{"/tmp/new.go:created", FileEvent{URI: "file:///tmp/new.go", Type: FileCreated}},
+		{"file:///tmp/old.go:deleted", FileEvent{URI: "file:///tmp/old.go", Type: FileDeleted}},
+		{"/tmp/a:b.go:changed", FileEvent{URI: "file:///tmp/a:b.go", Type: FileChanged}},
+	}
+	for _, test := range tests {
+		got, err := parseFileEvent(test.value)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("Expected %+v for %q, got %+v", test.expected, test.value, got)
+		}
+	}
+
+	for _, value := range []string{"main.go", ":changed", "main.go:modified", "main.go:"} {
+		if _, err := parseFileEvent(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// messageFramer sends and receives whole messages for transports that
+// delimit messages themselves, so no Content-Length header is used.
+type messageFramer interface {
+	WriteMessage(body []byte) error
+	// ReadMessage fails for messages larger than limit bytes.
+	ReadMessage(limit int) ([]byte, error)
+}
+
+// websocketGUID is appended to the handshake key to compute the accept
+// value (RFC 6455, section 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsConn is the client end of a WebSocket connection. Each JSON-RPC
+// message travels as one text message, as browser-based servers expect.
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMu sync.Mutex // frames must not interleave
+	pending []byte     // rest of the message being consumed through Read
+}
+
+// NewLSPClientWebSocket connects to an LSP server at a ws:// or wss://
+// URL.
+func NewLSPClientWebSocket(ctx context.Context, rawURL string, logger *slog.Logger) (*LSPClient, error) {
+	ws, err := dialWebSocket(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &LSPClient{
+		transport: ws,
+		framer:    ws,
+		reader:    bufio.NewReader(ws),
+		id:        1,
+		logger:    logger,
+	}, nil
+}
+
+func dialWebSocket(ctx context.Context, rawURL string) (*wsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebSocket URL: %w", err)
+	}
+	var port string
+	switch u.Scheme {
+	case "ws":
+		port = "80"
+	case "wss":
+		port = "443"
+	default:
+		return nil, fmt.Errorf("invalid WebSocket URL %q: scheme must be ws or wss", rawURL)
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var conn net.Conn
+	if u.Scheme == "wss" {
+		d := tls.Dialer{Config: &tls.Config{ServerName: u.Hostname()}}
+		conn, err = d.DialContext(ctx, "tcp", address)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &wsConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := ws.handshake(ctx, u); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("WebSocket handshake failed: %w", err)
+	}
+	return ws, nil
+}
+
+// handshake upgrades the connection from HTTP to WebSocket.
+func (ws *wsConn) handshake(ctx context.Context, u *url.URL) error {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	httpURL := *u
+	httpURL.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, httpURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	// Only the handshake may be cut short by ctx; afterwards the
+	// connection lives on its own.
+	stop := context.AfterFunc(ctx, func() { ws.conn.Close() })
+	defer stop()
+
+	if err := req.Write(ws.conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(ws.reader, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("server answered %s", resp.Status)
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		return errors.New("server did not upgrade to websocket")
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return errors.New("invalid Sec-WebSocket-Accept")
+	}
+	return nil
+}
+
+// websocketAccept returns the Sec-WebSocket-Accept value for key.
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (ws *wsConn) WriteMessage(body []byte) error {
+	return ws.writeFrame(wsText, body)
+}
+
+// writeFrame sends payload as a single masked frame, as clients must.
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode} // FIN
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, 0x80|byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 0x80|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 0x80|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	mask := make([]byte, 4)
+	rand.Read(mask)
+	header = append(header, mask...)
+
+	frame := make([]byte, len(header)+len(payload))
+	copy(frame, header)
+	for i, b := range payload {
+		frame[len(header)+i] = b ^ mask[i%4]
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// ReadMessage returns the next text or binary message, joining fragments
+// and answering pings on the way. A close frame ends the stream with
+// io.EOF.
+func (ws *wsConn) ReadMessage(limit int) ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, opcode, payload, err := ws.readFrame(limit - len(message))
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsPing:
+			if err := ws.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			ws.writeFrame(wsClose, nil)
+			return nil, io.EOF
+		case wsText, wsBinary:
+			if started {
+				return nil, errors.New("new WebSocket message before the previous one ended")
+			}
+			started = true
+		case wsContinuation:
+			if !started {
+				return nil, errors.New("WebSocket continuation frame without a message")
+			}
+		default:
+			return nil, fmt.Errorf("unknown WebSocket opcode %#x", opcode)
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads one frame, refusing payloads over limit bytes before
+// allocating them.
+func (ws *wsConn) readFrame(limit int) (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.reader, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > uint64(max(limit, 0)) {
+		return false, 0, nil, fmt.Errorf("WebSocket frame of %d bytes exceeds the message size limit (see -max-message-size)", length)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// Read returns the contents of incoming messages back to back. The client
+// reads through ReadMessage; Read only makes wsConn an io.ReadWriteCloser.
+func (ws *wsConn) Read(p []byte) (int, error) {
+	for len(ws.pending) == 0 {
+		message, err := ws.ReadMessage(defaultMaxMessageSize)
+		if err != nil {
+			return 0, err
+		}
+		ws.pending = message
+	}
+	n := copy(p, ws.pending)
+	ws.pending = ws.pending[n:]
+	return n, nil
+}
+
+// Write sends p as one message.
+func (ws *wsConn) Write(p []byte) (int, error) {
+	if err := ws.WriteMessage(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close sends a close frame and closes the connection without waiting
+// for the server to answer it.
+func (ws *wsConn) Close() error {
+	ws.writeFrame(wsClose, nil)
+	return ws.conn.Close()
+}
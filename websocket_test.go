@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readClientFrame reads one masked frame sent by the client.
+func readClientFrame(r *bufio.Reader) (opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	length := int(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return head[0] & 0x0F, payload, nil
+}
+
+// writeServerFrame writes an unmasked frame, as servers send them.
+func writeServerFrame(w io.Writer, fin bool, opcode byte, payload []byte) error {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	header := []byte{first}
+	if len(payload) < 126 {
+		header = append(header, byte(len(payload)))
+	} else {
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	}
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+// newWebSocketServer starts an HTTP server that upgrades to WebSocket and
+// hands the connection to serve.
+func newWebSocketServer(t *testing.T, serve func(conn net.Conn, r *bufio.Reader)) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Sec-WebSocket-Version") != "13" {
+			http.Error(w, "bad version", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + websocketAccept(req.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		rw.Flush()
+		serve(conn, rw.Reader)
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/lsp"
+}
+
+func TestWebsocketAccept(t *testing.T) {
+	// The example from RFC 6455, section 1.3.
+	if got := websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected accept value %s", got)
+	}
+}
+
+func TestLSPClientWebSocket_RoundTrip(t *testing.T) {
+	pongs := make(chan string, 1)
+	url := newWebSocketServer(t, func(conn net.Conn, r *bufio.Reader) {
+		opcode, payload, err := readClientFrame(r)
+		if err != nil || opcode != wsText {
+			return
+		}
+		if strings.HasPrefix(string(payload), "Content-Length") {
+			return // must be a bare JSON message
+		}
+		var request JSONRPCRequest
+		json.Unmarshal(payload, &request)
+
+		writeServerFrame(conn, true, wsPing, []byte("hi"))
+		body, _ := json.Marshal(JSONRPCResponse{JSONRPC: "2.0", ID: NumericID(*request.ID), Result: request.Method})
+		half := len(body) / 2
+		writeServerFrame(conn, false, wsText, body[:half])
+		writeServerFrame(conn, true, wsContinuation, body[half:])
+
+		if opcode, payload, err := readClientFrame(r); err == nil && opcode == wsPong {
+			pongs <- string(payload)
+		}
+		readClientFrame(r) // close
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := NewLSPClientWebSocket(ctx, url, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Abort()
+
+	response, err := client.SendRequest(ctx, "test/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Result != "test/echo" {
+		t.Errorf("Expected the fragmented response to be joined, got %v", response.Result)
+	}
+	select {
+	case payload := <-pongs:
+		if payload != "hi" {
+			t.Errorf("Expected the pong to echo the ping payload, got %q", payload)
+		}
+	case <-ctx.Done():
+		t.Error("Expected a pong")
+	}
+}
+
+func TestLSPClientWebSocket_MessageLimit(t *testing.T) {
+	url := newWebSocketServer(t, func(conn net.Conn, r *bufio.Reader) {
+		writeServerFrame(conn, true, wsText, []byte(strings.Repeat("x", 200)))
+		readClientFrame(r)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := NewLSPClientWebSocket(ctx, url, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Abort()
+	client.maxMessageSize = 100
+
+	if _, err := client.readFrame(); err == nil || !strings.Contains(err.Error(), "message size limit") {
+		t.Errorf("Expected a size limit error, got %v", err)
+	}
+}
+
+func TestLSPClientWebSocket_HandshakeFailure(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if _, err := NewLSPClientWebSocket(ctx, "ws"+strings.TrimPrefix(server.URL, "http"), logger); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected a handshake error, got %v", err)
+	}
+	if _, err := NewLSPClientWebSocket(ctx, "http://localhost/", logger); err == nil {
+		t.Error("Expected an error for a non-WebSocket URL")
+	}
+}
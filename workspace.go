@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// parseWorkspaceFolder parses a -workspace-folder value of the form
+// <uri|dir>[=name]. Without a name, the last element of the path is used.
+func parseWorkspaceFolder(value string) (WorkspaceFolder, error) {
+	location, name := value, ""
+	if i := strings.LastIndex(value, "="); i >= 0 {
+		location, name = value[:i], value[i+1:]
+	}
+	if location == "" {
+		return WorkspaceFolder{}, fmt.Errorf("empty workspace folder in %q", value)
+	}
+
+	uri, dir, err := resolveRoot(location)
+	if err != nil {
+		return WorkspaceFolder{}, err
+	}
+
+	if name == "" {
+		if dir != "" {
+			name = filepath.Base(dir)
+		} else if u, err := url.Parse(uri); err == nil {
+			name = path.Base(u.Path)
+		}
+	}
+	return WorkspaceFolder{URI: uri, Name: name}, nil
+}
+
+func parseWorkspaceFolders(values []string) ([]WorkspaceFolder, error) {
+	folders := make([]WorkspaceFolder, 0, len(values))
+	for _, value := range values {
+		folder, err := parseWorkspaceFolder(value)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+	return folders, nil
+}
+
+// applyWorkspaceFolders adds folders to params, advertises workspace folder
+// support and answers the server's workspace/workspaceFolders requests. When
+// useFirstAsRoot is set, rootUri and rootPath point at the first folder for
+// servers that don't understand workspace folders.
+func applyWorkspaceFolders(client *LSPClient, params *InitializeParams, folders []WorkspaceFolder, useFirstAsRoot bool) {
+	params.WorkspaceFolders = folders
+	if useFirstAsRoot {
+		params.RootURI = folders[0].URI
+		params.RootPath, _ = FileURIToPath(folders[0].URI)
+	}
+
+	params.Capabilities = mergeCapabilities(params.Capabilities, map[string]any{
+		"workspace": map[string]any{"workspaceFolders": true},
+	})
+	client.HandleServerRequest("workspace/workspaceFolders", func(json.RawMessage) (any, error) {
+		return folders, nil
+	})
+}
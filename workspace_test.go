@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseWorkspaceFolder(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		value    string
+		expected WorkspaceFolder
+	}{
+		{"./tools", WorkspaceFolder{URI: PathToFileURI(filepath.Join(wd, "tools")), Name: "tools"}},
+		{"./tools=Tools Module", WorkspaceFolder{URI: PathToFileURI(filepath.Join(wd, "tools")), Name: "Tools Module"}},
+		{"file:///src/api", WorkspaceFolder{URI: "file:///src/api", Name: "api"}},
+		{"file:///src/api=backend", WorkspaceFolder{URI: "file:///src/api", Name: "backend"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			folder, err := parseWorkspaceFolder(tc.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if folder != tc.expected {
+				t.Errorf("Expected %+v, got %+v", tc.expected, folder)
+			}
+		})
+	}
+
+	if _, err := parseWorkspaceFolder("=name"); err == nil {
+		t.Error("Expected an error for a folder without a location")
+	}
+}
+
+func TestApplyWorkspaceFolders(t *testing.T) {
+	client, _ := newPipeClient(t)
+	folders := []WorkspaceFolder{
+		{URI: "file:///src/api", Name: "api"},
+		{URI: "file:///src/web", Name: "web"},
+	}
+
+	params := newInitializeParams("file:///src")
+	applyWorkspaceFolders(client, &params, folders, true)
+
+	if params.RootURI != "file:///src/api" {
+		t.Errorf("Expected rootUri to be the first folder, got %s", params.RootURI)
+	}
+	if len(params.WorkspaceFolders) != 2 {
+		t.Errorf("Expected 2 workspace folders, got %d", len(params.WorkspaceFolders))
+	}
+	workspace := params.Capabilities["workspace"].(map[string]any)
+	if workspace["workspaceFolders"] != true {
+		t.Error("Expected workspaceFolders capability to be advertised")
+	}
+
+	params = newInitializeParams("file:///src")
+	applyWorkspaceFolders(client, &params, folders, false)
+	if params.RootURI != "file:///src" {
+		t.Errorf("Expected an explicit root to be kept, got %s", params.RootURI)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// WorkspaceEdit is the result of textDocument/rename and the edit of a
+// code action. When DocumentChanges is present it is used instead of
+// Changes, as the spec asks.
+type WorkspaceEdit struct {
+	Changes         map[string][]TextEdit `json:"changes,omitempty"`
+	DocumentChanges []documentChange      `json:"documentChanges,omitempty"`
+}
+
+// documentChange is one entry of documentChanges: a TextDocumentEdit when
+// Kind is empty, otherwise a create, rename or delete file operation.
+type documentChange struct {
+	Kind string `json:"kind,omitempty"`
+
+	// TextDocumentEdit
+	TextDocument *TextDocumentIdentifier `json:"textDocument,omitempty"`
+	Edits        []TextEdit              `json:"edits,omitempty"`
+
+	// CreateFile and DeleteFile
+	URI string `json:"uri,omitempty"`
+	// RenameFile
+	OldURI string `json:"oldUri,omitempty"`
+	NewURI string `json:"newUri,omitempty"`
+
+	Options struct {
+		Overwrite         bool `json:"overwrite,omitempty"`
+		IgnoreIfExists    bool `json:"ignoreIfExists,omitempty"`
+		Recursive         bool `json:"recursive,omitempty"`
+		IgnoreIfNotExists bool `json:"ignoreIfNotExists,omitempty"`
+	} `json:"options"`
+}
+
+// workspaceEdit extracts a WorkspaceEdit from result, which is either the
+// edit itself or a code action carrying one. ok is false for other shapes.
+func workspaceEdit(result any) (*WorkspaceEdit, bool) {
+	object, ok := result.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	if edit, ok := object["edit"].(map[string]any); ok {
+		object = edit
+	}
+	_, hasChanges := object["changes"].(map[string]any)
+	_, hasDocumentChanges := object["documentChanges"].([]any)
+	if !hasChanges && !hasDocumentChanges {
+		return nil, false
+	}
+	data, _ := json.Marshal(object)
+	var edit WorkspaceEdit
+	if err := json.Unmarshal(data, &edit); err != nil {
+		return nil, false
+	}
+	return &edit, true
+}
+
+// stagedFile is the pending state of one file while an edit is applied in
+// memory.
+type stagedFile struct {
+	content  string
+	exists   bool
+	mode     fs.FileMode
+	onDisk   bool // the file existed before the edit
+	isDir    bool // an existing directory; only deleting it is supported
+	modified bool
+}
+
+// editStage applies a WorkspaceEdit to copies of the files it touches, so
+// that an edit that fails halfway leaves the disk untouched.
+type editStage struct {
+	files    map[string]*stagedFile
+	summary  []string
+	encoding string // the position encoding of the edits
+}
+
+func (s *editStage) file(path string) (*stagedFile, error) {
+	if f, ok := s.files[path]; ok {
+		return f, nil
+	}
+	f := &stagedFile{mode: 0o644}
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	case info.IsDir():
+		f.exists, f.onDisk, f.isDir = true, true, true
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f.content, f.exists, f.onDisk, f.mode = string(data), true, true, info.Mode().Perm()
+	}
+	s.files[path] = f
+	return f, nil
+}
+
+func (s *editStage) editFile(uri string, edits []TextEdit) error {
+	path, err := FileURIToPath(uri)
+	if err != nil {
+		return err
+	}
+	f, err := s.file(path)
+	if err != nil {
+		return err
+	}
+	if !f.exists || f.isDir {
+		return fmt.Errorf("cannot edit %s: no such file", path)
+	}
+	if f.content, err = applyTextEdits(f.content, edits, s.encoding); err != nil {
+		return fmt.Errorf("cannot edit %s: %w", path, err)
+	}
+	f.modified = true
+	s.summary = append(s.summary, fmt.Sprintf("modified %s (%d edits)", path, len(edits)))
+	return nil
+}
+
+func (s *editStage) apply(change documentChange) error {
+	switch change.Kind {
+	case "":
+		if change.TextDocument == nil {
+			return errors.New("document change without textDocument")
+		}
+		return s.editFile(change.TextDocument.URI, change.Edits)
+
+	case "create":
+		path, err := FileURIToPath(change.URI)
+		if err != nil {
+			return err
+		}
+		f, err := s.file(path)
+		if err != nil {
+			return err
+		}
+		if f.exists && !change.Options.Overwrite {
+			if change.Options.IgnoreIfExists {
+				return nil
+			}
+			return fmt.Errorf("cannot create %s: file exists", path)
+		}
+		if f.isDir {
+			return fmt.Errorf("cannot create %s: is a directory", path)
+		}
+		f.content, f.exists, f.modified = "", true, true
+		s.summary = append(s.summary, "created "+path)
+
+	case "rename":
+		oldPath, err := FileURIToPath(change.OldURI)
+		if err != nil {
+			return err
+		}
+		newPath, err := FileURIToPath(change.NewURI)
+		if err != nil {
+			return err
+		}
+		from, err := s.file(oldPath)
+		if err != nil {
+			return err
+		}
+		to, err := s.file(newPath)
+		if err != nil {
+			return err
+		}
+		if !from.exists {
+			return fmt.Errorf("cannot rename %s: no such file", oldPath)
+		}
+		if from.isDir || to.isDir {
+			return fmt.Errorf("cannot rename %s: renaming directories is not supported", oldPath)
+		}
+		if to.exists && !change.Options.Overwrite {
+			if change.Options.IgnoreIfExists {
+				return nil
+			}
+			return fmt.Errorf("cannot rename %s: %s exists", oldPath, newPath)
+		}
+		to.content, to.exists, to.mode, to.modified = from.content, true, from.mode, true
+		from.content, from.exists, from.modified = "", false, true
+		s.summary = append(s.summary, fmt.Sprintf("renamed %s -> %s", oldPath, newPath))
+
+	case "delete":
+		path, err := FileURIToPath(change.URI)
+		if err != nil {
+			return err
+		}
+		f, err := s.file(path)
+		if err != nil {
+			return err
+		}
+		if !f.exists {
+			if change.Options.IgnoreIfNotExists {
+				return nil
+			}
+			return fmt.Errorf("cannot delete %s: no such file", path)
+		}
+		if f.isDir && !change.Options.Recursive {
+			if entries, err := os.ReadDir(path); err != nil || len(entries) > 0 {
+				return fmt.Errorf("cannot delete %s: directory is not empty and recursive is not set", path)
+			}
+		}
+		f.content, f.exists, f.isDir, f.modified = "", false, false, true
+		s.summary = append(s.summary, "deleted "+path)
+
+	default:
+		return fmt.Errorf("unknown document change kind %q", change.Kind)
+	}
+	return nil
+}
+
+// commit writes the staged state to disk: removed files and directories
+// first, then every file that was written, in path order.
+func (s *editStage) commit() error {
+	paths := slices.Sorted(maps.Keys(s.files))
+	for _, path := range paths {
+		f := s.files[path]
+		if f.modified && !f.exists && f.onDisk {
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, path := range paths {
+		f := s.files[path]
+		if !f.modified || !f.exists {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(f.content), f.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyWorkspaceEdit applies edit to the files on disk and writes a line
+// per change to summary. Nothing is written unless every change applies.
+// Changes entries are applied in URI order, documentChanges in the order
+// given. Positions are in encoding.
+func applyWorkspaceEdit(edit *WorkspaceEdit, encoding string, summary io.Writer) error {
+	stage := &editStage{files: make(map[string]*stagedFile), encoding: encoding}
+	if edit.DocumentChanges != nil {
+		for i, change := range edit.DocumentChanges {
+			if err := stage.apply(change); err != nil {
+				return fmt.Errorf("document change %d: %w", i, err)
+			}
+		}
+	} else {
+		for _, uri := range slices.Sorted(maps.Keys(edit.Changes)) {
+			if err := stage.editFile(uri, edit.Changes[uri]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := stage.commit(); err != nil {
+		return err
+	}
+	for _, line := range stage.summary {
+		fmt.Fprintln(summary, line)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkspaceEdit(t *testing.T) {
+	changes := `{"changes": {"file:///a.go": [{"range": {"start": {"line": 0, "character": 0}, "end": {"line": 0, "character": 1}}, "newText": "x"}]}}`
+	edit, ok := workspaceEdit(decodeResult(t, changes))
+	if !ok || len(edit.Changes["file:///a.go"]) != 1 {
+		t.Errorf("Unexpected edit %+v", edit)
+	}
+
+	action := `{"title": "Rename file", "kind": "refactor", "edit": {"documentChanges": [{"kind": "rename", "oldUri": "file:///a.go", "newUri": "file:///b.go"}]}}`
+	edit, ok = workspaceEdit(decodeResult(t, action))
+	if !ok || len(edit.DocumentChanges) != 1 || edit.DocumentChanges[0].NewURI != "file:///b.go" {
+		t.Errorf("Unexpected edit %+v", edit)
+	}
+
+	for _, s := range []string{`null`, `[]`, `{"title": "Organize imports", "command": "x"}`} {
+		if _, ok := workspaceEdit(decodeResult(t, s)); ok {
+			t.Errorf("Expected %s not to be a WorkspaceEdit", s)
+		}
+	}
+}
+
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func readTestFile(t *testing.T, path string) (string, bool) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), true
+}
+
+func TestApplyWorkspaceEdit_Changes(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"a.go": "var old = old\n", "b.go": "use(old)\n"})
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+
+	edit := &WorkspaceEdit{Changes: map[string][]TextEdit{
+		PathToFileURI(a): {edit(0, 10, 0, 13, "new"), edit(0, 4, 0, 7, "new")},
+		PathToFileURI(b): {edit(0, 4, 0, 7, "new")},
+	}}
+	var summary bytes.Buffer
+	if err := applyWorkspaceEdit(edit, encodingUTF16, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := readTestFile(t, a); got != "var new = new\n" {
+		t.Errorf("Unexpected a.go %q", got)
+	}
+	if got, _ := readTestFile(t, b); got != "use(new)\n" {
+		t.Errorf("Unexpected b.go %q", got)
+	}
+	expected := "modified " + a + " (2 edits)\nmodified " + b + " (1 edits)\n"
+	if summary.String() != expected {
+		t.Errorf("Expected summary %q, got %q", expected, summary.String())
+	}
+}
+
+func TestApplyWorkspaceEdit_DocumentChanges(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"a.go": "package a\n", "gone.go": "x\n"})
+	a, b, c, gone := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go"), filepath.Join(dir, "sub", "c.go"), filepath.Join(dir, "gone.go")
+
+	edit := &WorkspaceEdit{DocumentChanges: []documentChange{
+		{Kind: "rename", OldURI: PathToFileURI(a), NewURI: PathToFileURI(b)},
+		// Edits after a rename address the new name.
+		{TextDocument: &TextDocumentIdentifier{URI: PathToFileURI(b)}, Edits: []TextEdit{edit(0, 8, 0, 9, "b")}},
+		{Kind: "create", URI: PathToFileURI(c)},
+		{TextDocument: &TextDocumentIdentifier{URI: PathToFileURI(c)}, Edits: []TextEdit{edit(0, 0, 0, 0, "package sub\n")}},
+		{Kind: "delete", URI: PathToFileURI(gone)},
+	}}
+	var summary bytes.Buffer
+	if err := applyWorkspaceEdit(edit, encodingUTF16, &summary); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := readTestFile(t, a); ok {
+		t.Error("Expected a.go to be renamed away")
+	}
+	if got, _ := readTestFile(t, b); got != "package b\n" {
+		t.Errorf("Unexpected b.go %q", got)
+	}
+	if got, _ := readTestFile(t, c); got != "package sub\n" {
+		t.Errorf("Unexpected sub/c.go %q", got)
+	}
+	if _, ok := readTestFile(t, gone); ok {
+		t.Error("Expected gone.go to be deleted")
+	}
+	if lines := strings.Count(summary.String(), "\n"); lines != 5 {
+		t.Errorf("Expected a summary line per change, got:\n%s", summary.String())
+	}
+}
+
+func TestApplyWorkspaceEdit_FailureWritesNothing(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"a.go": "package a\n", "b.go": "package b\n"})
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+
+	tests := []struct {
+		name    string
+		changes []documentChange
+	}{
+		{"create existing", []documentChange{
+			{TextDocument: &TextDocumentIdentifier{URI: PathToFileURI(a)}, Edits: []TextEdit{edit(0, 0, 0, 7, "")}},
+			{Kind: "create", URI: PathToFileURI(b)},
+		}},
+		{"rename onto existing", []documentChange{
+			{Kind: "rename", OldURI: PathToFileURI(a), NewURI: PathToFileURI(b)},
+		}},
+		{"delete missing", []documentChange{
+			{Kind: "delete", URI: PathToFileURI(a)},
+			{Kind: "delete", URI: PathToFileURI(filepath.Join(dir, "missing.go"))},
+		}},
+		{"edit missing", []documentChange{
+			{TextDocument: &TextDocumentIdentifier{URI: PathToFileURI(filepath.Join(dir, "missing.go"))}},
+		}},
+		{"overlapping edits", []documentChange{
+			{TextDocument: &TextDocumentIdentifier{URI: PathToFileURI(a)}, Edits: []TextEdit{edit(0, 0, 0, 5, ""), edit(0, 2, 0, 7, "")}},
+		}},
+		{"unknown kind", []documentChange{{Kind: "chmod", URI: PathToFileURI(a)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := applyWorkspaceEdit(&WorkspaceEdit{DocumentChanges: tt.changes}, encodingUTF16, &bytes.Buffer{}); err == nil {
+				t.Fatal("Expected an error")
+			}
+			if got, _ := readTestFile(t, a); got != "package a\n" {
+				t.Errorf("a.go changed to %q", got)
+			}
+			if got, _ := readTestFile(t, b); got != "package b\n" {
+				t.Errorf("b.go changed to %q", got)
+			}
+		})
+	}
+}
+
+func TestApplyWorkspaceEdit_IgnoreOptions(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"a.go": "package a\n"})
+	a := filepath.Join(dir, "a.go")
+
+	create := documentChange{Kind: "create", URI: PathToFileURI(a)}
+	create.Options.IgnoreIfExists = true
+	remove := documentChange{Kind: "delete", URI: PathToFileURI(filepath.Join(dir, "missing.go"))}
+	remove.Options.IgnoreIfNotExists = true
+
+	var summary bytes.Buffer
+	if err := applyWorkspaceEdit(&WorkspaceEdit{DocumentChanges: []documentChange{create, remove}}, encodingUTF16, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := readTestFile(t, a); got != "package a\n" {
+		t.Errorf("a.go changed to %q", got)
+	}
+	if summary.Len() != 0 {
+		t.Errorf("Expected no changes, got %q", summary.String())
+	}
+
+	create.Options.Overwrite = true
+	if err := applyWorkspaceEdit(&WorkspaceEdit{DocumentChanges: []documentChange{create}}, encodingUTF16, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := readTestFile(t, a); got != "" {
+		t.Errorf("Expected create with overwrite to empty a.go, got %q", got)
+	}
+}